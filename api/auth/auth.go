@@ -0,0 +1,117 @@
+/*
+Package auth provides the gin middleware requiring the users of the
+catalog to sign in with HTTP Basic authentication, which most e-readers
+support.
+*/
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"bookarr/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// userKey is the context key of the name of the signed in user.
+	userKey = "bookarr.user"
+	// prefixKey is the context key of the token path prefix of the request.
+	prefixKey = "bookarr.prefix"
+)
+
+// tokenPath starts the catalog paths holding a device token, e.g.
+// /opds/v1/t/<token>/Author.
+const tokenPath = "/t/"
+
+// Basic returns the middleware checking the credentials of every request
+// against db and challenging clients without valid ones for realm. While
+// there are no users, the catalog is open to everyone.
+func Basic(db *users.DB, realm string) gin.HandlerFunc {
+	challenge := fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm)
+	return func(c *gin.Context) {
+		if User(c) != "" {
+			// signed in with a token
+			c.Next()
+			return
+		}
+		if name, password, ok := c.Request.BasicAuth(); ok {
+			u, err := db.Authenticate(name, password)
+			if err == nil {
+				c.Set(userKey, u.Name)
+				c.Next()
+				return
+			}
+			if !errors.Is(err, users.ErrInvalid) {
+				log.Printf("auth Authenticate err: %s", err)
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+		}
+
+		empty, err := db.Empty()
+		if err != nil {
+			log.Printf("auth Empty err: %s", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if empty {
+			c.Next()
+			return
+		}
+		c.Header("WWW-Authenticate", challenge)
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}
+
+// Token returns the middleware signing in the requests whose path parameter
+// starts with /t/<token>, for readers that can't do HTTP authentication. The
+// token is removed from the parameter, and handlers put it back in the links
+// they make with Prefix. Paths where t is followed by anything but a known
+// token are left alone, so a library folder called t stays reachable. It
+// must run before Basic.
+func Token(db *users.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rest, ok := strings.CutPrefix(c.Param("path"), tokenPath)
+		if !ok {
+			c.Next()
+			return
+		}
+		secret, rest, _ := strings.Cut(rest, "/")
+		t, err := db.UseToken(secret)
+		if errors.Is(err, users.ErrInvalid) {
+			c.Next()
+			return
+		}
+		if err != nil {
+			log.Printf("auth UseToken err: %s", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		for i := range c.Params {
+			if c.Params[i].Key == "path" {
+				c.Params[i].Value = "/" + rest
+			}
+		}
+		c.Set(userKey, t.User)
+		c.Set(prefixKey, tokenPath+secret)
+		c.Next()
+	}
+}
+
+// Prefix returns what to insert after the base URL of the catalog in the
+// links of the response, so they keep the token of the request.
+func Prefix(c *gin.Context) string {
+	return c.GetString(prefixKey)
+}
+
+// User returns the name of the signed in user, or an empty string when the
+// catalog is open.
+func User(c *gin.Context) string {
+	return c.GetString(userKey)
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"bookarr/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestToken(t *testing.T) {
+	db, err := users.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Add("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	secret, _, err := db.AddToken("alice", "Kobo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/opds/*path", Token(db), Basic(db, "bookarr"), func(c *gin.Context) {
+		c.String(http.StatusOK, "%s %s %s", User(c), Prefix(c), c.Param("path"))
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/opds/t/" + secret + "/Author/", http.StatusOK, "alice /t/" + secret + " /Author/"},
+		{"/opds/t/Novels/book.epub", http.StatusUnauthorized, ""},
+		{"/opds/Author/", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status || tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+
+	// a folder called t is reachable with a password
+	req := httptest.NewRequest(http.MethodGet, "/opds/t/Novels/book.epub", nil)
+	req.SetBasicAuth("alice", "secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if want := "alice  /t/Novels/book.epub"; w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("GET folder t = %d %q, want 200 %q", w.Code, w.Body.String(), want)
+	}
+}
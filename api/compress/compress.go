@@ -0,0 +1,268 @@
+/*
+Package compress provides a gin middleware compressing feeds and other text
+responses with zstd or gzip, whichever the client prefers. Book files,
+images and other binary content are sent as they are: they are compressed
+already, and compressing them would break range requests.
+*/
+package compress
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultMinSize is the size under which responses are not compressed unless
+// configured with WithMinSize: the saving does not pay for the overhead.
+const defaultMinSize = 1024
+
+// encodings are the supported content codings, most preferred first.
+var encodings = []string{"zstd", "gzip"}
+
+// Option configures the middleware.
+type Option func(*config)
+
+type config struct {
+	minSize int
+}
+
+// WithMinSize compresses only the responses of at least n bytes.
+func WithMinSize(n int) Option {
+	return func(cfg *config) {
+		cfg.minSize = n
+	}
+}
+
+// New returns the middleware compressing responses with the encoding
+// negotiated from the Accept-Encoding header of the request.
+func New(opts ...Option) gin.HandlerFunc {
+	cfg := &config{minSize: defaultMinSize}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(c *gin.Context) {
+		w := &writer{
+			ResponseWriter: c.Writer,
+			encoding:       negotiate(c.GetHeader("Accept-Encoding")),
+			minSize:        cfg.minSize,
+			head:           c.Request.Method == http.MethodHead,
+		}
+		c.Writer = w
+		defer func() {
+			w.close()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// negotiate returns the preferred encoding accepted by the Accept-Encoding
+// header, or an empty string when the response is best sent uncompressed.
+func negotiate(header string) string {
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		quality[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range encodings {
+		q, ok := quality[enc]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether content of contentType is worth compressing:
+// text, XML and JSON documents, which feeds are.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+xml"),
+		strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/xml",
+		mediaType == "application/json",
+		mediaType == "application/javascript":
+		return true
+	}
+	return false
+}
+
+// writer buffers the start of the response until it knows whether it is
+// large enough to be compressed.
+type writer struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+	head     bool
+
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.decided {
+		return w.write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < w.minSize {
+		return len(p), nil
+	}
+	if err := w.flushBuffer(len(w.buf)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *writer) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *writer) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(w.size())
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *writer) Flush() {
+	if !w.decided {
+		w.flushBuffer(w.size())
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *writer) write(p []byte) (int, error) {
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// size returns the size of the response known so far. HEAD responses have no
+// body but declare the length of the one GET would have.
+func (w *writer) size() int {
+	if n, err := strconv.Atoi(w.Header().Get("Content-Length")); err == nil && w.head {
+		return n
+	}
+	return len(w.buf)
+}
+
+// flushBuffer decides on the compression of a response of size bytes and
+// writes what was buffered.
+func (w *writer) flushBuffer(size int) error {
+	w.decide(size)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.write(buf)
+	return err
+}
+
+// decide sets up the encoder when the response is to be compressed, before
+// its headers are written.
+func (w *writer) decide(size int) {
+	w.decided = true
+	h := w.Header()
+	if w.Status() != http.StatusOK || h.Get("Content-Encoding") != "" || h.Get("Accept-Ranges") != "" {
+		return
+	}
+	if !compressible(h.Get("Content-Type")) {
+		return
+	}
+	h.Add("Vary", "Accept-Encoding")
+	if w.encoding == "" || size < w.minSize {
+		return
+	}
+
+	h.Set("Content-Encoding", w.encoding)
+	h.Del("Content-Length")
+	// the compressed representation differs from the identity one, weak
+	// tags still match If-None-Match, RFC 9110 section 8.8.3.3
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	if w.head {
+		return
+	}
+	switch w.encoding {
+	case "zstd":
+		w.enc = newZstd(w.ResponseWriter)
+	case "gzip":
+		w.enc = newGzip(w.ResponseWriter)
+	}
+}
+
+// close writes what is left of the response.
+func (w *writer) close() {
+	if !w.decided {
+		w.flushBuffer(w.size())
+	}
+	if w.enc != nil {
+		w.enc.Close()
+	}
+}
+
+var (
+	gzipPool = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zstdPool = sync.Pool{New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}}
+)
+
+// pooled returns an encoder to its pool when closed.
+type pooled struct {
+	io.WriteCloser
+	release func()
+}
+
+func (p *pooled) Close() error {
+	err := p.WriteCloser.Close()
+	p.release()
+	return err
+}
+
+func (p *pooled) Flush() error {
+	return p.WriteCloser.(interface{ Flush() error }).Flush()
+}
+
+func newGzip(w io.Writer) io.WriteCloser {
+	gz := gzipPool.Get().(*gzip.Writer)
+	gz.Reset(w)
+	return &pooled{WriteCloser: gz, release: func() { gzipPool.Put(gz) }}
+}
+
+func newZstd(w io.Writer) io.WriteCloser {
+	enc := zstdPool.Get().(*zstd.Encoder)
+	enc.Reset(w)
+	return &pooled{WriteCloser: enc, release: func() { zstdPool.Put(enc) }}
+}
@@ -0,0 +1,99 @@
+package compress
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip, deflate, br", "gzip"},
+		{"gzip, zstd", "zstd"},
+		{"zstd;q=0.5, gzip", "gzip"},
+		{"zstd;q=0, gzip;q=0", ""},
+		{"*", "zstd"},
+		{"*;q=0.1, gzip;q=0.2", "gzip"},
+		{"GZIP", "gzip"},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.header); got != tt.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	feed := "<feed>" + strings.Repeat("<entry/>", 500) + "</feed>"
+	router := gin.New()
+	router.Use(New(WithMinSize(100)))
+	router.GET("/feed", func(c *gin.Context) {
+		c.Header("ETag", `"feed"`)
+		c.Data(http.StatusOK, "application/atom+xml;profile=opds-catalog", []byte(feed))
+	})
+	router.GET("/small", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/atom+xml", []byte("<feed/>"))
+	})
+	router.GET("/book.epub", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/epub+zip", []byte(feed))
+	})
+
+	tests := []struct {
+		path, accept, encoding string
+	}{
+		{"/feed", "gzip", "gzip"},
+		{"/feed", "zstd, gzip", "zstd"},
+		{"/feed", "", ""},
+		{"/small", "gzip", ""},
+		{"/book.epub", "gzip", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s with %q: Content-Encoding = %q, want %q", tt.path, tt.accept, got, tt.encoding)
+			continue
+		}
+		var body io.Reader = w.Body
+		switch tt.encoding {
+		case "gzip":
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = gz
+		case "zstd":
+			dec, err := zstd.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dec.Close()
+			body = dec
+		}
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("%s with %q: %s", tt.path, tt.accept, err)
+		}
+		if tt.path == "/feed" && string(b) != feed {
+			t.Errorf("%s with %q: body differs", tt.path, tt.accept)
+		}
+		if tt.encoding != "" && w.Header().Get("ETag") != `W/"feed"` {
+			t.Errorf("%s with %q: ETag = %s", tt.path, tt.accept, w.Header().Get("ETag"))
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Package httpcache answers conditional requests. Feeds and files carry an
+ETag and a Last-Modified date, and clients polling the catalog get a
+304 Not Modified instead of the whole document when nothing changed.
+*/
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bookarr/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag returns a strong entity tag computed from body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Write serves body, a document generated for the request, which last
+// changed at modified. It answers 304 Not Modified when the client already
+// has it. modified may be the zero time when unknown.
+func Write(c *gin.Context, contentType string, body []byte, modified time.Time) {
+	etag := ETag(body)
+	c.Header("ETag", etag)
+	if !modified.IsZero() {
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c.Request, etag, modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	// set explicitly so HEAD requests, which get no body, report it too
+	c.Header("Content-Length", strconv.Itoa(len(body)))
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// ServeFile serves file, answering conditional and range requests. Files can
+// be large, so rather than hashing the content the ETag is made of the
+// modification time and length, which change whenever the content does.
+// The caller closes the reader.
+func ServeFile(c *gin.Context, file *storage.File) {
+	if file.ContentType != "" {
+		c.Header("Content-Type", file.ContentType)
+	}
+	if !file.ModTime.IsZero() {
+		c.Header("ETag", fmt.Sprintf(`"%x-%x"`, file.ModTime.UnixNano(), file.ContentLength))
+	}
+	http.ServeContent(c.Writer, c.Request, "", file.ModTime, file.Reader)
+}
+
+// notModified reports whether the client holding the document tagged etag,
+// last changed at modified, can use its copy. If-None-Match takes precedence
+// over If-Modified-Since, RFC 9110 section 13.2.2.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, etag)
+	}
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have a resolution of one second
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// etagMatch reports whether the If-None-Match list inm holds etag, using the
+// weak comparison the header calls for.
+func etagMatch(inm, etag string) bool {
+	for _, t := range strings.Split(inm, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
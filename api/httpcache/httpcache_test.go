@@ -0,0 +1,41 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+	etag := ETag([]byte("feed"))
+
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		want   bool
+	}{
+		{"unconditional", http.MethodGet, nil, false},
+		{"same etag", http.MethodGet, map[string]string{"If-None-Match": etag}, true},
+		{"etag in list", http.MethodGet, map[string]string{"If-None-Match": `"a", W/` + etag}, true},
+		{"any etag", http.MethodHead, map[string]string{"If-None-Match": "*"}, true},
+		{"other etag", http.MethodGet, map[string]string{"If-None-Match": `"a"`}, false},
+		{"not modified since", http.MethodGet, map[string]string{"If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT"}, true},
+		{"modified since", http.MethodGet, map[string]string{"If-Modified-Since": "Wed, 01 May 2024 11:59:59 GMT"}, false},
+		{"etag wins", http.MethodGet, map[string]string{"If-None-Match": `"a"`, "If-Modified-Since": "Wed, 01 May 2024 12:00:00 GMT"}, false},
+		{"post", http.MethodPost, map[string]string{"If-None-Match": etag}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := notModified(r, etag, modified); got != tt.want {
+				t.Errorf("notModified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Package catalog holds what the OPDS, REST and web handlers share: scoping the
+library to the signed in user, and reading and writing the query parameters
+that page, sort and filter listings.
+*/
+package catalog
+
+import (
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bookarr/api/auth"
+	"bookarr/storage"
+	"bookarr/storage/acl"
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scope returns store and idx as the user signed in to c may see them, with
+// the folders and books rules deny them hidden. They are returned unchanged
+// when no rule applies to the user.
+func Scope(c *gin.Context, rules *acl.Rules, store storage.Store, idx *index.Index) (storage.Store, *index.Index) {
+	policy := rules.For(auth.User(c))
+	if policy == nil {
+		return store, idx
+	}
+	return acl.NewStore(store, policy), idx.Filter(func(b index.Book) bool { return policy.AllowEntry(b.Path, b.Entry) })
+}
+
+// QueryInt returns the integer query parameter key clamped to [lo, hi], or
+// def when it is missing or malformed.
+func QueryInt(c *gin.Context, key string, def, lo, hi int) int {
+	n, err := strconv.Atoi(c.Query(key))
+	if err != nil {
+		return def
+	}
+	return min(max(n, lo), hi)
+}
+
+// Query parameters selecting facets.
+const (
+	SortParam     = "sort"
+	LanguageParam = "lang"
+	FormatParam   = "format"
+	CoverParam    = "cover"
+)
+
+// SortFacets are the orders offered to catalog clients, with their titles.
+var SortFacets = []struct {
+	Order storage.SortOrder
+	Title string
+}{
+	{storage.SortTitle, "Title"},
+	{storage.SortAuthor, "Author"},
+	{storage.SortAdded, "Date added"},
+	{storage.SortPublished, "Publication date"},
+	{storage.SortSeries, "Series"},
+}
+
+// ListOptions reads the facets selected in the request.
+func ListOptions(c *gin.Context) storage.ListOptions {
+	return storage.ListOptions{
+		Sort:     storage.SortOrder(c.Query(SortParam)),
+		Language: c.Query(LanguageParam),
+		Format:   c.Query(FormatParam),
+		HasCover: c.Query(CoverParam) == "1",
+	}
+}
+
+// FacetQuery returns the query parameters selecting opts.
+func FacetQuery(opts storage.ListOptions) url.Values {
+	q := url.Values{}
+	if opts.Sort != storage.SortDefault {
+		q.Set(SortParam, string(opts.Sort))
+	}
+	if opts.Language != "" {
+		q.Set(LanguageParam, opts.Language)
+	}
+	if opts.Format != "" {
+		q.Set(FormatParam, opts.Format)
+	}
+	if opts.HasCover {
+		q.Set(CoverParam, "1")
+	}
+	return q
+}
+
+// FeedHref returns the address of the feed at urlPath below baseUrl with the
+// query q.
+func FeedHref(baseUrl *url.URL, urlPath string, q url.Values) string {
+	href := baseUrl.JoinPath(urlPath).String()
+	if len(q) > 0 {
+		href += "?" + q.Encode()
+	}
+	return href
+}
+
+// Counts tallies the facet values of the books of a folder.
+type Counts struct {
+	Books  int
+	Covers int
+	// Languages and Formats count the books by lower-cased language and by
+	// media type. Books in several formats count once per format.
+	Languages map[string]int
+	Formats   map[string]int
+}
+
+// Count tallies the facet values of the books in entries. Folders are
+// skipped.
+func Count(entries []storage.Entry) Counts {
+	n := Counts{Languages: make(map[string]int), Formats: make(map[string]int)}
+	for _, e := range entries {
+		if e.Aquisition == "subsection" {
+			continue
+		}
+		n.Books++
+		if lang := e.Metadata.GetLanguage(); lang != "" {
+			n.Languages[strings.ToLower(lang)]++
+		}
+		if e.Metadata.HasCover() {
+			n.Covers++
+		}
+		if len(e.Files) == 0 {
+			n.Formats[storage.MediaType(e.Type)]++
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, f := range e.Files {
+			if t := storage.MediaType(f.Type); !seen[t] {
+				seen[t] = true
+				n.Formats[t]++
+			}
+		}
+	}
+	return n
+}
+
+// SortedKeys returns the keys of m in order.
+func SortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// FormatTitle returns a readable name for a media type, e.g. "EPUB".
+func FormatTitle(mediaType string) string {
+	if f, ok := storage.FormatByMIMEType(mediaType); ok {
+		return f.Name
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return strings.ToUpper(strings.TrimPrefix(exts[0], "."))
+	}
+	return mediaType
+}
@@ -0,0 +1,55 @@
+package catalog
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"bookarr/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryInt(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", 5},
+		{"n=x", 5},
+		{"n=3", 3},
+		{"n=-4", 1},
+		{"n=99", 10},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/?"+tt.query, nil)
+		if got := QueryInt(c, "n", 5, 1, 10); got != tt.want {
+			t.Errorf("QueryInt(%q) = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestFacetQuery(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/?sort=title&lang=en&format=application%2Fpdf&cover=1&page=2", nil)
+	if got, want := FacetQuery(ListOptions(c)).Encode(), "cover=1&format=application%2Fpdf&lang=en&sort=title"; got != want {
+		t.Errorf("FacetQuery(ListOptions()) = %s, want %s", got, want)
+	}
+}
+
+func TestCount(t *testing.T) {
+	entries := []storage.Entry{
+		{Name: "Folder", Aquisition: "subsection", Metadata: &storage.NOOPMetadata{}},
+		{Name: "a.epub", Metadata: &storage.NOOPMetadata{}, Files: []storage.BookFile{
+			{Name: "a.epub", Type: "application/epub+zip"},
+			{Name: "a.pdf", Type: "application/pdf"},
+		}},
+		{Name: "b.pdf", Metadata: &storage.NOOPMetadata{}, Files: []storage.BookFile{
+			{Name: "b.pdf", Type: "application/pdf"},
+		}},
+	}
+	n := Count(entries)
+	if n.Books != 2 || n.Formats["application/pdf"] != 2 || n.Formats["application/epub+zip"] != 1 {
+		t.Errorf("Count() = %+v", n)
+	}
+}
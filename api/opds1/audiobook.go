@@ -0,0 +1,172 @@
+package opds1
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bookarr/api/httpcache"
+	opdsv1 "bookarr/opds/v1"
+	opdsv2 "bookarr/opds/v2"
+	"bookarr/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetManifest serves the Readium audiobook manifest of the audiobook at the
+// request path, with or without a trailing /manifest.json.
+func (h *opdsv1Handler) GetManifest(c *gin.Context) {
+	urlPath := strings.TrimSuffix(c.Param("path"), "/manifest.json")
+
+	entry, err := h.storage.Entry(urlPath)
+	if err != nil {
+		log.Printf("GetManifest err: %s", err)
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+	am, ok := entry.Metadata.(storage.AudioMetadata)
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	baseUrl := &url.URL{Path: h.baseURL}
+	manifest := makeAudiobookManifest(baseUrl, urlPath, entry, am)
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		log.Printf("GetManifest Marshal err: %s", err)
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+	httpcache.Write(c, opdsv2.AudiobookMediaType, content, entry.Updated)
+}
+
+// trackHref returns the location of a track. Single file audiobooks are their
+// own track.
+func trackHref(baseUrl *url.URL, urlPath string, track storage.Track) string {
+	if track.Name == "" {
+		return baseUrl.JoinPath(urlPath).String()
+	}
+	return baseUrl.JoinPath(urlPath, track.Name).String()
+}
+
+func makeAudiobookManifest(baseUrl *url.URL, urlPath string, entry *storage.Entry, am storage.AudioMetadata) *opdsv2.Publication {
+	title := am.GetTitle()
+	if title == "" {
+		title = entry.Name
+	}
+	modified := entry.Updated
+
+	p := &opdsv2.Publication{
+		Context: opdsv2.Context,
+		Metadata: opdsv2.Metadata{
+			Type:        opdsv2.AudiobookType,
+			ConformsTo:  opdsv2.AudiobookProfile,
+			Identifier:  am.GetIdentifier(),
+			Title:       title,
+			Language:    am.GetLanguage(),
+			Description: am.GetDescription(),
+			Modified:    &modified,
+			Duration:    am.GetDuration().Seconds(),
+		},
+		Links: []opdsv2.Link{{
+			Rel:  "self",
+			Href: baseUrl.JoinPath(urlPath, "manifest.json").String(),
+			Type: opdsv2.AudiobookMediaType,
+		}},
+	}
+	if am.GetCreator() != "" {
+		p.Metadata.Author = []opdsv2.Contributor{{Name: am.GetCreator()}}
+	}
+	if am.GetNarrator() != "" {
+		p.Metadata.Narrator = []opdsv2.Contributor{{Name: am.GetNarrator()}}
+	}
+	if am.GetPublisher() != "" {
+		p.Metadata.Publisher = []opdsv2.Contributor{{Name: am.GetPublisher()}}
+	}
+
+	tracks := am.GetTracks()
+	for _, track := range tracks {
+		p.ReadingOrder = append(p.ReadingOrder, opdsv2.Link{
+			Href:     trackHref(baseUrl, urlPath, track),
+			Type:     track.ContentType,
+			Title:    track.Title,
+			Duration: track.Duration.Seconds(),
+		})
+	}
+	for _, chapter := range am.GetChapters() {
+		if chapter.Track >= len(tracks) {
+			continue
+		}
+		href := trackHref(baseUrl, urlPath, tracks[chapter.Track])
+		p.TOC = append(p.TOC, opdsv2.Link{
+			Href:  href + "#t=" + strconv.FormatFloat(chapter.Start.Seconds(), 'f', -1, 64),
+			Title: chapter.Title,
+		})
+	}
+	if am.HasCover() {
+		p.Resources = append(p.Resources, opdsv2.Link{
+			Rel:  "cover",
+			Href: baseUrl.JoinPath(urlPath, "cover").String(),
+			Type: "image/jpeg",
+		})
+	}
+	return p
+}
+
+// addAudioLinks adds the manifest and track links of an audiobook entry and
+// lists its chapters in the entry content.
+func addAudioLinks(e *opdsv1.Entry, baseUrl *url.URL, urlPath, name string, entry storage.Entry, am storage.AudioMetadata) {
+	if entry.Type == opdsv2.AudiobookMediaType {
+		// the entry itself resolves to the manifest, list the tracks next to it
+		for _, track := range am.GetTracks() {
+			e.Link = append(e.Link, opdsv1.Link{
+				Type:   track.ContentType,
+				Title:  track.Title,
+				Href:   baseUrl.JoinPath(urlPath, name, track.Name).String(),
+				Rel:    "http://opds-spec.org/acquisition",
+				Length: strconv.FormatInt(track.ContentLength, 10),
+			})
+		}
+	} else {
+		e.Link = append(e.Link, opdsv1.Link{
+			Type:  opdsv2.AudiobookMediaType,
+			Title: "Audiobook manifest",
+			Href:  baseUrl.JoinPath(urlPath, name, "manifest.json").String(),
+			Rel:   "http://opds-spec.org/acquisition",
+		})
+	}
+
+	var b strings.Builder
+	if d := strings.TrimSpace(am.GetDescription()); d != "" {
+		if d[0] == '<' {
+			b.WriteString(d)
+		} else {
+			b.WriteString("<p>" + html.EscapeString(d) + "</p>")
+		}
+	}
+	b.WriteString("<p>")
+	if am.GetNarrator() != "" {
+		b.WriteString("Narrated by " + html.EscapeString(am.GetNarrator()) + ". ")
+	}
+	b.WriteString("Duration " + formatDuration(am.GetDuration()) + ".</p>")
+	if chapters := am.GetChapters(); len(chapters) > 1 {
+		b.WriteString("<ol>")
+		for _, chapter := range chapters {
+			b.WriteString("<li>" + html.EscapeString(chapter.Title) + " (" + formatDuration(chapter.Duration) + ")</li>")
+		}
+		b.WriteString("</ol>")
+	}
+	e.Content = safeDescription(b.String())
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -0,0 +1,174 @@
+package opds1
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	opdsv1 "bookarr/opds/v1"
+	"bookarr/storage"
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+// browsePath is the root of the virtual navigation built from the index, so
+// the catalog can be browsed by author or series whatever the folder layout.
+const browsePath = "browse"
+
+// recentCount is the number of books in the recently added and updated
+// feeds.
+const recentCount = 100
+
+// recentFeeds are acquisition feeds of the books that changed last.
+var recentFeeds = []struct {
+	name  string
+	title string
+	rel   string
+	order storage.SortOrder
+}{
+	{"new", "Recently added", "http://opds-spec.org/sort/new", storage.SortAdded},
+	{"updated", "Recently updated", "subsection", storage.SortUpdated},
+}
+
+// isBrowse reports whether urlPath belongs to the virtual navigation.
+func isBrowse(urlPath string) bool {
+	return urlPath == "/"+browsePath || strings.HasPrefix(urlPath, "/"+browsePath+"/")
+}
+
+// groupURL returns the address of the books of the group key of view. The
+// key is escaped as a single segment, since names such as "AC/DC" hold
+// slashes.
+func groupURL(baseUrl *url.URL, view, key string) *url.URL {
+	u := baseUrl.JoinPath(browsePath, view)
+	u.RawPath = u.EscapedPath() + "/" + url.PathEscape(key)
+	u.Path += "/" + key
+	return u
+}
+
+// browseEntries returns the navigation entries leading to every view, shown
+// at the top of the root feed. They are updated with the newest book.
+func (h *opdsv1Handler) browseEntries(baseUrl *url.URL) []*opdsv1.Entry {
+	updated := opdsv1.Time(h.index.Updated())
+	var out []*opdsv1.Entry
+	for _, r := range recentFeeds {
+		href := baseUrl.JoinPath(browsePath, r.name)
+		out = append(out, &opdsv1.Entry{
+			Title:   r.title,
+			ID:      href.EscapedPath(),
+			Updated: updated,
+			Link: []opdsv1.Link{
+				{Type: opdsv1.FeedAcquisitionLinkType, Href: href.String(), Rel: r.rel},
+			},
+		})
+	}
+	for _, v := range index.Views {
+		href := baseUrl.JoinPath(browsePath, v.Name)
+		out = append(out, &opdsv1.Entry{
+			Title:   v.Title,
+			ID:      href.EscapedPath(),
+			Updated: updated,
+			Link: []opdsv1.Link{
+				{Type: opdsv1.FeedNavigationLinkType, Href: href.String(), Rel: "subsection"},
+			},
+		})
+	}
+	return out
+}
+
+// GetBrowse serves the virtual navigation: the list of views at /browse, the
+// groups of a view at /browse/<view> and the books of a group at
+// /browse/<view>/<key>.
+func (h *opdsv1Handler) GetBrowse(c *gin.Context) {
+	urlPath := c.Param("path")
+	baseUrl := &url.URL{Path: h.baseURL}
+
+	parts := strings.SplitN(strings.TrimPrefix(urlPath, "/"+browsePath), "/", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		feed := opdsv1.NewFeed("Browse", "", &url.URL{Path: urlPath}, baseUrl)
+		for _, e := range h.browseEntries(baseUrl) {
+			feed.AddEntry(e)
+		}
+		keepProfile(c, feed)
+		writeFeed(c, opdsv1.FeedNavigationLinkType, feed)
+		return
+	}
+
+	for _, r := range recentFeeds {
+		if parts[1] == r.name && len(parts) == 2 {
+			h.getRecent(c, r.title, r.order)
+			return
+		}
+	}
+
+	view, ok := index.ViewByName(parts[1])
+	if !ok {
+		c.XML(http.StatusNotFound, nil)
+		return
+	}
+	if len(parts) == 3 && parts[2] != "" {
+		h.getBrowseGroup(c, view, parts[2])
+		return
+	}
+
+	groups := h.index.Groups(view)
+	feed := opdsv1.NewFeed(view.Title, "", &url.URL{Path: urlPath}, baseUrl)
+	page := h.addPageLinks(c, feed, baseUrl, urlPath, opdsv1.FeedNavigationLinkType, len(groups), nil)
+	for _, g := range groups[page.start:page.end()] {
+		href := groupURL(baseUrl, view.Name, g.Key)
+		feed.AddEntry(&opdsv1.Entry{
+			Title:   g.Key,
+			ID:      href.EscapedPath(),
+			Updated: opdsv1.Time(g.Updated),
+			Link: []opdsv1.Link{
+				{Type: opdsv1.FeedAcquisitionLinkType, Href: href.String(), Rel: "subsection", Count: g.Count},
+			},
+			Content: &opdsv1.Content{Type: "text", Content: booksCount(g.Count)},
+		})
+	}
+	keepProfile(c, feed)
+	writeFeed(c, opdsv1.FeedNavigationLinkType, feed)
+}
+
+func (h *opdsv1Handler) getBrowseGroup(c *gin.Context, view index.View, key string) {
+	urlPath := c.Param("path")
+	baseUrl := &url.URL{Path: h.baseURL}
+
+	books := h.index.Group(view, key)
+	if len(books) == 0 {
+		c.XML(http.StatusNotFound, nil)
+		return
+	}
+
+	feed := opdsv1.NewFeed(key, view.Title, &url.URL{Path: urlPath}, baseUrl)
+	page := h.addPageLinks(c, feed, baseUrl, urlPath, opdsv1.FeedAcquisitionLinkType, len(books), nil)
+	profile := profileFor(c)
+	for _, b := range books[page.start:page.end()] {
+		feed.AddEntry(h.makeEntry(baseUrl, b.Dir(), b.Entry, profile))
+	}
+	keepProfile(c, feed)
+	writeFeed(c, opdsv1.FeedAcquisitionLinkType, feed)
+}
+
+func (h *opdsv1Handler) getRecent(c *gin.Context, title string, order storage.SortOrder) {
+	urlPath := c.Param("path")
+	baseUrl := &url.URL{Path: h.baseURL}
+
+	books := h.index.Recent(order, recentCount)
+	feed := opdsv1.NewFeed(title, "", &url.URL{Path: urlPath}, baseUrl)
+	page := h.addPageLinks(c, feed, baseUrl, urlPath, opdsv1.FeedAcquisitionLinkType, len(books), nil)
+	profile := profileFor(c)
+	for _, b := range books[page.start:page.end()] {
+		feed.AddEntry(h.makeEntry(baseUrl, b.Dir(), b.Entry, profile))
+	}
+	keepProfile(c, feed)
+	writeFeed(c, opdsv1.FeedAcquisitionLinkType, feed)
+}
+
+func booksCount(n int) string {
+	if n == 1 {
+		return "1 book"
+	}
+	return fmt.Sprintf("%d books", n)
+}
@@ -0,0 +1,23 @@
+package opds1
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestGroupURL(t *testing.T) {
+	baseUrl := &url.URL{Path: "/opds/v1"}
+	for key, want := range map[string]string{
+		"Tolkien, J.R.R.": "/opds/v1/browse/author/Tolkien%2C%20J.R.R.",
+		"AC/DC":           "/opds/v1/browse/author/AC%2FDC",
+		"50%":             "/opds/v1/browse/author/50%25",
+	} {
+		u := groupURL(baseUrl, "author", key)
+		if got := u.String(); got != want {
+			t.Errorf("groupURL(%q) = %s, want %s", key, got, want)
+		}
+		if u.Path != "/opds/v1/browse/author/"+key {
+			t.Errorf("groupURL(%q).Path = %s", key, u.Path)
+		}
+	}
+}
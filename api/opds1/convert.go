@@ -0,0 +1,193 @@
+package opds1
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"bookarr/api/httpcache"
+	"bookarr/convert"
+	opdsv1 "bookarr/opds/v1"
+	"bookarr/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// conversionFor returns the conversion named by the last element of urlPath.
+func (h *opdsv1Handler) conversionFor(urlPath string) (convert.Conversion, bool) {
+	if !h.conversions {
+		return convert.Conversion{}, false
+	}
+	return convert.ByName(path.Base(urlPath))
+}
+
+// deviceConversion returns the conversion the device profile of the request
+// prefers over the book at urlPath.
+func (h *opdsv1Handler) deviceConversion(c *gin.Context, urlPath string) (convert.Conversion, bool) {
+	p := profileFor(c)
+	if !h.conversions || p == nil {
+		return convert.Conversion{}, false
+	}
+	name, ok := p.Conversion(mime.TypeByExtension(filepath.Ext(urlPath)))
+	if !ok {
+		return convert.Conversion{}, false
+	}
+	return convert.ByName(name)
+}
+
+// addConversionLinks adds an acquisition link for every conversion that
+// accepts the type of the file name, unless the entry already links to a
+// file of the target type.
+func (h *opdsv1Handler) addConversionLinks(e *opdsv1.Entry, baseUrl *url.URL, urlPath, name, contentType string) {
+	if !h.conversions {
+		return
+	}
+	for _, conv := range convert.For(contentType) {
+		if hasLinkType(e, conv.To) {
+			continue
+		}
+		e.Link = append(e.Link, opdsv1.Link{
+			Type:  conv.To,
+			Title: conv.Title,
+			Href:  baseUrl.JoinPath(urlPath, name, conv.Name).String(),
+			Rel:   "http://opds-spec.org/acquisition",
+		})
+	}
+}
+
+func hasLinkType(e *opdsv1.Entry, contentType string) bool {
+	for _, l := range e.Link {
+		if l.Type == contentType && strings.HasPrefix(l.Rel, acquisitionRel) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetConverted serves the book at urlPath converted by conv. The result is
+// streamed to the client while it is written to the cache, so later requests
+// for the same source are served from disk with ranges and validators. A HEAD
+// request converts the book into the cache first so it is answered with the
+// length and validators of the later GET. Without a cache, conversions are
+// only streamed and answered with Accept-Ranges: none and no length.
+func (h *opdsv1Handler) GetConverted(c *gin.Context, urlPath string, conv convert.Conversion) {
+	file := h.storage.File(urlPath)
+	if file == nil {
+		c.XML(http.StatusNotFound, nil)
+		return
+	}
+	defer file.Reader.Close()
+
+	if !conv.Accepts(file.ContentType) {
+		c.XML(http.StatusNotFound, nil)
+		return
+	}
+
+	name := strings.TrimSuffix(path.Base(urlPath), filepath.Ext(urlPath)) + conv.Extension
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+
+	src, ok := file.Reader.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(file.Reader)
+		if err != nil {
+			log.Printf("GetConverted ReadAll err: %s", err)
+			c.Header("Content-Disposition", "")
+			c.XML(http.StatusInternalServerError, nil)
+			return
+		}
+		src = bytes.NewReader(data)
+	}
+
+	key, err := convert.Key(conv, io.NewSectionReader(src, 0, file.ContentLength))
+	if err != nil {
+		log.Printf("GetConverted Key err: %s", err)
+		c.Header("Content-Disposition", "")
+		c.XML(http.StatusInternalServerError, nil)
+		return
+	}
+	if h.serveCached(c, key, conv) {
+		return
+	}
+
+	if c.Request.Method == http.MethodHead {
+		if h.cache == nil {
+			c.Header("Content-Type", conv.To)
+			c.Header("Accept-Ranges", "none")
+			c.Status(http.StatusOK)
+			return
+		}
+		entry, err := h.cache.Create(key)
+		if err == nil {
+			if err = conv.Converter.Convert(entry, src, file.ContentLength); err != nil {
+				entry.Abort()
+			} else {
+				err = entry.Commit()
+			}
+		}
+		if err == nil && h.serveCached(c, key, conv) {
+			return
+		}
+		log.Printf("GetConverted %s err: %v", conv.Name, err)
+		c.Header("Content-Disposition", "")
+		c.XML(http.StatusInternalServerError, nil)
+		return
+	}
+
+	var w io.Writer = c.Writer
+	var entry *convert.Entry
+	if h.cache != nil {
+		if entry, err = h.cache.Create(key); err != nil {
+			log.Printf("GetConverted cache.Create err: %s", err)
+			entry = nil
+		} else {
+			w = io.MultiWriter(c.Writer, entry)
+		}
+	}
+
+	c.Header("Content-Type", conv.To)
+	c.Header("Accept-Ranges", "none")
+	c.Status(http.StatusOK)
+	if err := conv.Converter.Convert(w, src, file.ContentLength); err != nil {
+		log.Printf("GetConverted %s err: %s", conv.Name, err)
+		if entry != nil {
+			entry.Abort()
+		}
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.Header("Accept-Ranges", "")
+			c.XML(http.StatusInternalServerError, nil)
+		}
+		return
+	}
+
+	if entry != nil {
+		if err := entry.Commit(); err != nil {
+			log.Printf("GetConverted cache.Commit err: %s", err)
+		}
+	}
+}
+
+// serveCached serves the conversion stored under key, reporting whether it
+// was in the cache.
+func (h *opdsv1Handler) serveCached(c *gin.Context, key string, conv convert.Conversion) bool {
+	if h.cache == nil {
+		return false
+	}
+	f, err := h.cache.Open(key)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	httpcache.ServeFile(c, &storage.File{ContentType: conv.To, ContentLength: stat.Size(), Reader: f, ModTime: stat.ModTime()})
+	return true
+}
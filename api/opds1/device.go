@@ -0,0 +1,84 @@
+package opds1
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"bookarr/device"
+	opdsv1 "bookarr/opds/v1"
+
+	"github.com/gin-gonic/gin"
+)
+
+// profileParam picks a device profile explicitly, overriding the User-Agent.
+const profileParam = "profile"
+
+const acquisitionRel = "http://opds-spec.org/acquisition"
+
+// profileFor returns the device profile of the request, or nil when the
+// client is unknown.
+func profileFor(c *gin.Context) *device.Profile {
+	if name := c.Query(profileParam); name != "" {
+		return device.ByName(name)
+	}
+	return device.Detect(c.Request.UserAgent())
+}
+
+// applyProfile puts the acquisition links of e in the order preferred by
+// the device and drops the formats it can not open. Entries with no
+// supported format are left untouched so the book stays reachable.
+func applyProfile(e *opdsv1.Entry, p *device.Profile) {
+	if p == nil {
+		return
+	}
+
+	var supported, others []opdsv1.Link
+	for _, l := range e.Link {
+		switch {
+		case !strings.HasPrefix(l.Rel, acquisitionRel):
+			others = append(others, l)
+		case p.Rank(l.Type) >= 0:
+			supported = append(supported, l)
+		}
+	}
+	if len(supported) == 0 {
+		return
+	}
+
+	sort.SliceStable(supported, func(i, j int) bool {
+		return p.Rank(supported[i].Type) < p.Rank(supported[j].Type)
+	})
+	e.Link = append(supported, others...)
+}
+
+// keepProfile adds the profile query parameter to the catalog links of feed,
+// so a profile picked explicitly sticks while browsing.
+func keepProfile(c *gin.Context, feed *opdsv1.Feed) {
+	addProfile(c, feed.Link)
+	for _, e := range feed.Entry {
+		addProfile(c, e.Link)
+	}
+}
+
+// addProfile adds the profile query parameter of the request, if any, to the
+// catalog links among links.
+func addProfile(c *gin.Context, links []opdsv1.Link) {
+	name := c.Query(profileParam)
+	if name == "" {
+		return
+	}
+	for i, l := range links {
+		if !strings.HasPrefix(l.Type, "application/atom+xml") {
+			continue
+		}
+		u, err := url.Parse(l.Href)
+		if err != nil {
+			continue
+		}
+		q := u.Query()
+		q.Set(profileParam, name)
+		u.RawQuery = q.Encode()
+		links[i].Href = u.String()
+	}
+}
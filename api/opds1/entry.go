@@ -0,0 +1,120 @@
+package opds1
+
+import (
+	"encoding/xml"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"bookarr/api/httpcache"
+	"bookarr/device"
+	opdsv1 "bookarr/opds/v1"
+	"bookarr/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// entryPath is appended to the path of a book to get its complete entry
+// document.
+const entryPath = "entry"
+
+// makeEntry builds the partial entry of the store entry found in the folder
+// urlPath, as listed in feeds. The description, contributors and rights are
+// left to the complete entry, linked with rel="alternate".
+func (h opdsv1Handler) makeEntry(baseUrl *url.URL, urlPath string, entry storage.Entry, profile *device.Profile) *opdsv1.Entry {
+	e := h.completeEntry(baseUrl, urlPath, entry, profile)
+	e.Link = append(e.Link, opdsv1.Link{
+		Rel:  "alternate",
+		Type: opdsv1.EntryLinkType,
+		Href: baseUrl.JoinPath(urlPath, entry.Name, entryPath).String(),
+	})
+	e.Content = nil
+	e.Contributors = nil
+	e.Rights = ""
+	if len(e.Identifier) > 1 {
+		e.Identifier = e.Identifier[:1]
+	}
+	return e
+}
+
+// isEntryDocument reports whether urlPath addresses the complete entry of a
+// book, returning the path of the book.
+func (h *opdsv1Handler) isEntryDocument(urlPath string) (string, bool) {
+	book, ok := strings.CutSuffix(urlPath, "/"+entryPath)
+	if !ok {
+		return "", false
+	}
+	switch h.storage.PathType(book) {
+	case storage.PathTypeFile, storage.PathTypeAudiobook:
+		return book, true
+	}
+	return "", false
+}
+
+// GetEntry serves the complete entry document of the book at bookPath,
+// with the links to related feeds.
+func (h *opdsv1Handler) GetEntry(c *gin.Context, bookPath string) {
+	baseUrl := &url.URL{Path: h.baseURL}
+	dir, name := path.Split(bookPath)
+	dir = strings.TrimSuffix(dir, "/")
+
+	entries, err := h.storage.List(dir, storage.ListOptions{})
+	if err != nil {
+		log.Printf("GetEntry List err: %s", err)
+		c.XML(http.StatusNotFound, nil)
+		return
+	}
+	var entry *storage.Entry
+	for i := range entries {
+		if entries[i].Name == name {
+			entry = &entries[i]
+			break
+		}
+		for _, f := range entries[i].Files {
+			if f.Name == name {
+				entry = &entries[i]
+			}
+		}
+	}
+	if entry == nil {
+		c.XML(http.StatusNotFound, nil)
+		return
+	}
+
+	e := h.completeEntry(baseUrl, dir, *entry, profileFor(c))
+	e.Link = append(e.Link, relatedLinks(baseUrl, *entry)...)
+	addProfile(c, e.Link)
+
+	content, err := opdsv1.Marshal(e)
+	if err != nil {
+		log.Printf("opdsv1.Marshal err: %s", err)
+		c.XML(http.StatusInternalServerError, nil)
+		return
+	}
+	httpcache.Write(c, opdsv1.EntryLinkType, append([]byte(xml.Header), content...), entry.Updated)
+}
+
+// relatedLinks links the feeds of the other books of the authors and series
+// of entry.
+func relatedLinks(baseUrl *url.URL, entry storage.Entry) []opdsv1.Link {
+	var links []opdsv1.Link
+	for _, a := range storage.Authors(entry.Metadata) {
+		links = append(links, opdsv1.Link{
+			Rel:   "related",
+			Type:  opdsv1.FeedAcquisitionLinkType,
+			Title: "Books by " + a.Name,
+			Href:  groupURL(baseUrl, "author", a.SortAs).String(),
+		})
+	}
+	if series, _ := storage.Series(entry.Metadata); series != "" {
+		links = append(links, opdsv1.Link{
+			Rel:   "related",
+			Type:  opdsv1.FeedAcquisitionLinkType,
+			Title: "Series: " + series,
+			Href:  groupURL(baseUrl, "series", series).String(),
+		})
+	}
+	return links
+}
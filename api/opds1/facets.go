@@ -0,0 +1,66 @@
+package opds1
+
+import (
+	"net/url"
+	"strings"
+
+	"bookarr/api/internal/catalog"
+	opdsv1 "bookarr/opds/v1"
+	"bookarr/storage"
+)
+
+const facetRel = "http://opds-spec.org/facet"
+
+// addFacets adds the OPDS facet links of the folder urlPath to feed. The
+// language, format and cover groups list the values found in entries, the
+// unfiltered content of the folder, and are left out when there is nothing
+// to choose from.
+func addFacets(feed *opdsv1.Feed, baseUrl *url.URL, urlPath string, opts storage.ListOptions, entries []storage.Entry) {
+	facet := func(group, title string, active bool, count int, sel storage.ListOptions) {
+		feed.Link = append(feed.Link, opdsv1.Link{
+			Rel:         facetRel,
+			Type:        opdsv1.FeedAcquisitionLinkType,
+			Title:       title,
+			Href:        catalog.FeedHref(baseUrl, urlPath, catalog.FacetQuery(sel)),
+			FacetGroup:  group,
+			ActiveFacet: active,
+			Count:       count,
+		})
+	}
+
+	for _, f := range catalog.SortFacets {
+		sel := opts
+		sel.Sort = f.Order
+		facet("Sort by", f.Title, opts.Sort == f.Order, 0, sel)
+	}
+
+	n := catalog.Count(entries)
+
+	group := func(name, all string, values map[string]int, active string, set func(*storage.ListOptions, string), title func(string) string) {
+		if len(values) < 2 && active == "" {
+			return
+		}
+		sel := opts
+		set(&sel, "")
+		facet(name, all, active == "", n.Books, sel)
+		for _, v := range catalog.SortedKeys(values) {
+			sel := opts
+			set(&sel, v)
+			facet(name, title(v), strings.EqualFold(active, v), values[v], sel)
+		}
+	}
+	group("Language", "All languages", n.Languages, opts.Language,
+		func(o *storage.ListOptions, v string) { o.Language = v },
+		func(v string) string { return v })
+	group("Format", "All formats", n.Formats, opts.Format,
+		func(o *storage.ListOptions, v string) { o.Format = v },
+		catalog.FormatTitle)
+
+	if (n.Covers > 0 && n.Covers < n.Books) || opts.HasCover {
+		sel := opts
+		sel.HasCover = false
+		facet("Cover", "All books", !opts.HasCover, n.Books, sel)
+		sel.HasCover = true
+		facet("Cover", "With cover", opts.HasCover, n.Covers, sel)
+	}
+}
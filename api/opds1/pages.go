@@ -0,0 +1,126 @@
+package opds1
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"bookarr/api/httpcache"
+	"bookarr/api/internal/catalog"
+	opdsv1 "bookarr/opds/v1"
+	"bookarr/storage"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+)
+
+// OPDS Page Streaming Extension 1.2, https://anansi-project.github.io/docs/opds-pse/specs/v1.2
+const (
+	pseStreamRel = "http://vaemendis.net/opds-pse/stream"
+	// pagesPath is appended to the path of a book, followed by the page
+	// number, to get a page image.
+	pagesPath = "pages"
+)
+
+// addPageStreamLink lets readers stream the count pages of the book name
+// in the folder urlPath. The link is a URI template, expanded by the reader.
+func addPageStreamLink(e *opdsv1.Entry, baseUrl *url.URL, urlPath, name string, count int) {
+	e.Link = append(e.Link, opdsv1.Link{
+		Rel:       pseStreamRel,
+		Type:      "image/jpeg",
+		Href:      baseUrl.JoinPath(urlPath, name, pagesPath).String() + "/{pageNumber}?maxWidth={maxWidth}",
+		PageCount: count,
+	})
+}
+
+// isPageRequest reports whether urlPath addresses a page of a book,
+// returning the path of the book and the page number.
+func (h *opdsv1Handler) isPageRequest(urlPath string) (string, int, bool) {
+	dir, number := path.Split(urlPath)
+	book, ok := strings.CutSuffix(strings.TrimSuffix(dir, "/"), "/"+pagesPath)
+	if !ok {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+	if h.storage.PathType(book) != storage.PathTypeFile {
+		return "", 0, false
+	}
+	return book, n, true
+}
+
+// maxPagePixels bounds the size of the pages GetPage decodes to scale them
+// down, so a crafted archive can't exhaust the memory of the server.
+const maxPagePixels = 64 << 20
+
+// GetPage serves page n of the book at bookPath. When the maxWidth
+// parameter is smaller than the page, the page is scaled down and served as
+// JPEG, which saves bandwidth on phones. Pages that can't be read or are
+// too large to decode safely are refused rather than scaled.
+func (h *opdsv1Handler) GetPage(c *gin.Context, bookPath string, n int) {
+	ps, ok := h.storage.(storage.PageStore)
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	page := ps.Page(bookPath, n)
+	if page == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer page.Reader.Close()
+
+	maxWidth := catalog.QueryInt(c, "maxWidth", 0, 0, math.MaxInt)
+	if maxWidth == 0 {
+		httpcache.ServeFile(c, page)
+		return
+	}
+
+	data, err := io.ReadAll(page.Reader)
+	if err != nil {
+		log.Printf("GetPage read err: %s", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("GetPage decode config err: %s", err)
+		c.Status(http.StatusUnprocessableEntity)
+		return
+	}
+	if cfg.Width <= maxWidth {
+		httpcache.Write(c, page.ContentType, data, page.ModTime)
+		return
+	}
+	if cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxPagePixels {
+		log.Printf("GetPage %s page %d: %dx%d is too large to scale", bookPath, n, cfg.Width, cfg.Height)
+		c.Status(http.StatusUnprocessableEntity)
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("GetPage decode err: %s", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, maxWidth, max(b.Dy()*maxWidth/b.Dx(), 1)))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	httpcache.Write(c, "image/jpeg", buf.Bytes(), page.ModTime)
+}
@@ -0,0 +1,96 @@
+package opds1
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+
+	"bookarr/api/internal/catalog"
+	opdsv1 "bookarr/opds/v1"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPageSize is the number of entries per feed page unless configured
+// with WithPageSize.
+const defaultPageSize = 100
+
+// paging is the slice of a feed being served.
+type paging struct {
+	// start is the offset of the first entry of the page.
+	start int
+	size  int
+	total int
+}
+
+// newPaging returns the page starting at the entry offset start, clamped to
+// the entries available. A size of zero disables paging.
+func newPaging(start, size, total int) paging {
+	if size <= 0 {
+		return paging{start: 0, size: total, total: total}
+	}
+	if start >= total {
+		start = max((total-1)/size*size, 0)
+	}
+	return paging{start: max(start, 0), size: size, total: total}
+}
+
+// end returns the offset after the last entry of the page.
+func (p paging) end() int {
+	return min(p.start+p.size, p.total)
+}
+
+// last returns the offset of the first entry of the last page.
+func (p paging) last() int {
+	if p.total == 0 {
+		return 0
+	}
+	return (p.total - 1) / p.size * p.size
+}
+
+// addLinks adds the OpenSearch paging elements and the first, previous, next
+// and last links of RFC 5005 to feed. href returns the address of the page
+// starting at an offset.
+func (p paging) addLinks(feed *opdsv1.Feed, linkType string, href func(start int) string) {
+	feed.SearchResult = uint(p.total)
+	feed.ItemsPerPage = uint(p.size)
+	feed.StartIndex = uint(p.start + 1)
+
+	if p.size == 0 || p.total <= p.size {
+		return
+	}
+	link := func(rel string, start int) {
+		feed.Link = append(feed.Link, opdsv1.Link{Rel: rel, Type: linkType, Href: href(start)})
+	}
+	link("first", 0)
+	if p.start > 0 {
+		link("previous", max(p.start-p.size, 0))
+	}
+	if p.end() < p.total {
+		link("next", p.start+p.size)
+	}
+	link("last", p.last())
+}
+
+// addPageLinks selects the page of a feed of total entries requested with
+// the page parameter and adds the paging links, which keep the query q.
+func (h *opdsv1Handler) addPageLinks(c *gin.Context, feed *opdsv1.Feed, baseUrl *url.URL, urlPath, linkType string, total int, q url.Values) paging {
+	page := newPaging((catalog.QueryInt(c, "page", 1, 1, math.MaxInt)-1)*h.pageSize, h.pageSize, total)
+	if h.pageSize > 0 && page.total > page.size {
+		pageHref := func(start int) string {
+			pq := url.Values{}
+			for k, v := range q {
+				pq[k] = v
+			}
+			pq.Set("page", strconv.Itoa(start/page.size+1))
+			return catalog.FeedHref(baseUrl, urlPath, pq)
+		}
+		for i := range feed.Link {
+			if feed.Link[i].Rel == "self" {
+				feed.Link[i].Href = pageHref(page.start)
+			}
+		}
+		page.addLinks(feed, linkType, pageHref)
+	}
+	return page
+}
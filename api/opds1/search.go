@@ -0,0 +1,70 @@
+package opds1
+
+import (
+	"encoding/xml"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"bookarr/api/httpcache"
+	"bookarr/api/internal/catalog"
+	opdsv1 "bookarr/opds/v1"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchCount = 50
+	maxSearchCount     = 200
+)
+
+// GetOpenSearch serves the OpenSearch description of the catalog.
+func (h *opdsv1Handler) GetOpenSearch(c *gin.Context) {
+	baseUrl := &url.URL{Path: h.baseURL}
+	content, err := xml.Marshal(opdsv1.NewOpenSearchDescription("bookarr", baseUrl))
+	if err != nil {
+		log.Printf("GetOpenSearch xml.Marshal err: %s", err)
+		c.XML(http.StatusInternalServerError, nil)
+		return
+	}
+	httpcache.Write(c, opdsv1.FeedSearchLinkType, append([]byte(xml.Header), content...), time.Time{})
+}
+
+// GetSearch serves an acquisition feed with the books matching the q
+// parameter. Results are paged with the OpenSearch start (1-based) and count
+// parameters.
+func (h *opdsv1Handler) GetSearch(c *gin.Context) {
+	query := c.Query("q")
+	start := catalog.QueryInt(c, "start", 1, 1, math.MaxInt)
+	count := catalog.QueryInt(c, "count", defaultSearchCount, 1, maxSearchCount)
+
+	results := h.index.Search(query)
+	page := newPaging(start-1, count, len(results))
+
+	baseUrl := &url.URL{Path: h.baseURL}
+	selfUrl := &url.URL{Path: "/" + opdsv1.SearchPath}
+	feed := opdsv1.NewFeed("Search results for "+query, "", selfUrl, baseUrl)
+
+	pageHref := func(start int) string {
+		q := url.Values{"q": {query}, "start": {strconv.Itoa(start + 1)}, "count": {strconv.Itoa(count)}}
+		return baseUrl.JoinPath(opdsv1.SearchPath).String() + "?" + q.Encode()
+	}
+	for i := range feed.Link {
+		if feed.Link[i].Rel == "self" {
+			feed.Link[i].Type = opdsv1.FeedAcquisitionLinkType
+			feed.Link[i].Href = pageHref(page.start)
+		}
+	}
+	page.addLinks(feed, opdsv1.FeedAcquisitionLinkType, pageHref)
+
+	profile := profileFor(c)
+	for _, b := range results[page.start:page.end()] {
+		feed.AddEntry(h.makeEntry(baseUrl, b.Dir(), b.Entry, profile))
+	}
+	keepProfile(c, feed)
+
+	writeFeed(c, opdsv1.FeedAcquisitionLinkType, feed)
+}
@@ -6,43 +6,101 @@ package opds1
 import (
 	"encoding/xml"
 	"log"
-	"mime"
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"bookarr/api/auth"
+	"bookarr/api/httpcache"
+	"bookarr/api/internal/catalog"
+	"bookarr/convert"
+	"bookarr/device"
 	opdsv1 "bookarr/opds/v1"
 	"bookarr/storage"
+	"bookarr/storage/acl"
+	"bookarr/storage/index"
 
 	"github.com/gin-gonic/gin"
 )
 
-func init() {
-	_ = mime.AddExtensionType(".mobi", "application/x-mobipocket-ebook")
-	_ = mime.AddExtensionType(".epub", "application/epub+zip")
-	_ = mime.AddExtensionType(".cbz", "application/x-cbz")
-	_ = mime.AddExtensionType(".cbr", "application/x-cbr")
-	_ = mime.AddExtensionType(".fb2", "text/fb2+xml")
-	_ = mime.AddExtensionType(".pdf", "application/pdf")
+type opdsv1Handler struct {
+	baseURL     string
+	storage     storage.Store
+	conversions bool
+	cache       *convert.Cache
+	index       *index.Index
+	pageSize    int
+	acl         *acl.Rules
 }
 
-type opdsv1Handler struct {
-	baseURL string
-	storage storage.Store
+// Option configures optional features of the handler.
+type Option func(*opdsv1Handler)
+
+// WithConversions publishes acquisition links for the registered
+// conversions, such as EPUB to KEPUB, and serves the conversion preferred by
+// the device profile, like KEPUB on Kobo, in place of the original book.
+// Results are cached in cache, which may be nil.
+func WithConversions(cache *convert.Cache) Option {
+	return func(h *opdsv1Handler) {
+		h.conversions = true
+		h.cache = cache
+	}
+}
+
+// WithIndex searches idx instead of an index of the store built on the first
+// search, so the caller can keep it up to date in the background.
+func WithIndex(idx *index.Index) Option {
+	return func(h *opdsv1Handler) {
+		h.index = idx
+	}
+}
+
+// WithPageSize splits folder feeds in pages of size entries. A size of zero
+// serves every entry in a single feed.
+func WithPageSize(size int) Option {
+	return func(h *opdsv1Handler) {
+		h.pageSize = size
+	}
 }
 
-func New(baseUrl string, store storage.Store) *opdsv1Handler {
-	return &opdsv1Handler{
-		baseURL: baseUrl,
-		storage: store,
+// WithACL hides the folders and books rules deny a user from their OPDS
+// feeds, search results and downloads.
+func WithACL(rules *acl.Rules) Option {
+	return func(h *opdsv1Handler) {
+		h.acl = rules
+	}
+}
+
+func New(baseUrl string, store storage.Store, opts ...Option) *opdsv1Handler {
+	h := &opdsv1Handler{
+		baseURL:  baseUrl,
+		storage:  store,
+		index:    index.New(store),
+		pageSize: defaultPageSize,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
+}
+
+// forRequest returns the handler serving the signed in user: its links keep
+// the token of the request and it only sees what the access rules allow.
+func (h *opdsv1Handler) forRequest(c *gin.Context) *opdsv1Handler {
+	r := *h
+	r.baseURL += auth.Prefix(c)
+	r.storage, r.index = catalog.Scope(c, h.acl, h.storage, h.index)
+	return &r
 }
 
 // Handler serve the content of a book file or
 // returns an Acquisition Feed when the entries are documents or
 // returns an Navegation Feed when the entries are other folders
 func (h *opdsv1Handler) Handler(c *gin.Context) {
+	h = h.forRequest(c)
+
 	if strings.HasSuffix(c.Request.RequestURI, "/cover") {
 		h.GetCover(c)
 		return
@@ -51,21 +109,57 @@ func (h *opdsv1Handler) Handler(c *gin.Context) {
 		h.GetThumbnail(c)
 		return
 	}
+	if strings.HasSuffix(c.Request.RequestURI, "/manifest.json") {
+		h.GetManifest(c)
+		return
+	}
 
 	urlPath := c.Param("path")
 
+	switch urlPath {
+	case "/" + opdsv1.OpenSearchPath:
+		h.GetOpenSearch(c)
+		return
+	case "/" + opdsv1.SearchPath:
+		h.GetSearch(c)
+		return
+	}
+	if isBrowse(urlPath) {
+		h.GetBrowse(c)
+		return
+	}
+	if book, n, ok := h.isPageRequest(urlPath); ok {
+		h.GetPage(c, book, n)
+		return
+	}
+	if book, ok := h.isEntryDocument(urlPath); ok {
+		h.GetEntry(c, book)
+		return
+	}
+
+	if conv, ok := h.conversionFor(urlPath); ok {
+		parent := strings.TrimSuffix(urlPath, "/"+conv.Name)
+		if h.storage.PathType(parent) == storage.PathTypeFile {
+			h.GetConverted(c, parent, conv)
+			return
+		}
+	}
+
 	var feed *opdsv1.Feed
 	var contentType storage.PathType
 
 	switch h.storage.PathType(urlPath) {
 	case storage.PathTypeFile:
+		if conv, ok := h.deviceConversion(c, urlPath); ok {
+			h.GetConverted(c, urlPath, conv)
+			return
+		}
 		file := h.storage.File(urlPath)
 		if file != nil {
 			defer file.Reader.Close()
-			c.DataFromReader(http.StatusOK, file.ContentLength, file.ContentType, file.Reader, nil)
+			httpcache.ServeFile(c, file)
 			return
 		}
-		c.Writer.Write([]byte(xml.Header))
 		c.XML(http.StatusNotFound, nil)
 		return
 	case storage.PathTypeAquisition:
@@ -74,21 +168,26 @@ func (h *opdsv1Handler) Handler(c *gin.Context) {
 	case storage.PathTypeNavigation:
 		feed = h.makeFeed(c)
 		contentType = storage.PathTypeNavigation
+	case storage.PathTypeAudiobook:
+		h.GetManifest(c)
+		return
 	case storage.PathTypeNotExists:
-		c.Writer.Write([]byte(xml.Header))
 		c.XML(http.StatusNotFound, nil)
 		return
 	}
 
-	c.Data(http.StatusOK, string(contentType), []byte(xml.Header))
+	writeFeed(c, string(contentType), feed)
+}
 
-	content, err := xml.Marshal(feed)
+// writeFeed serves feed as a document of contentType.
+func writeFeed(c *gin.Context, contentType string, feed *opdsv1.Feed) {
+	content, err := opdsv1.Marshal(feed)
 	if err != nil {
-		log.Printf("xml.Marshal err: %s", err)
+		log.Printf("opdsv1.Marshal err: %s", err)
 		c.XML(http.StatusInternalServerError, nil)
+		return
 	}
-
-	c.Data(http.StatusOK, string(contentType), content)
+	httpcache.Write(c, contentType, append([]byte(xml.Header), content...), feed.Modified())
 }
 
 func (h *opdsv1Handler) GetCover(c *gin.Context) {
@@ -98,7 +197,7 @@ func (h *opdsv1Handler) GetCover(c *gin.Context) {
 	cover := h.storage.Cover(path)
 	if cover != nil {
 		defer cover.Reader.Close()
-		c.DataFromReader(http.StatusOK, cover.ContentLength, cover.ContentType, cover.Reader, nil)
+		httpcache.ServeFile(c, cover)
 		return
 	}
 	c.XML(http.StatusNotFound, nil)
@@ -111,7 +210,7 @@ func (h *opdsv1Handler) GetThumbnail(c *gin.Context) {
 	cover := h.storage.Thumbnail(path)
 	if cover != nil {
 		defer cover.Reader.Close()
-		c.DataFromReader(http.StatusOK, cover.ContentLength, cover.ContentType, cover.Reader, nil)
+		httpcache.ServeFile(c, cover)
 		return
 	}
 	c.XML(http.StatusNotFound, nil)
@@ -124,61 +223,143 @@ func (h opdsv1Handler) makeFeed(c *gin.Context) *opdsv1.Feed {
 	baseUrl := &url.URL{Path: h.baseURL}
 	feed := opdsv1.NewFeed("Catalog in "+urlPath, "", selfUrl, baseUrl)
 
-	dirEntries, _ := h.storage.List(urlPath)
-	for _, entry := range dirEntries {
+	profile := profileFor(c)
+	pathType := h.storage.PathType(urlPath)
+	opts := catalog.ListOptions(c)
+	dirEntries, _ := h.storage.List(urlPath, opts)
 
-		originalName := entry.Name
-		if entry.Metadata.GetTitle() != "" {
-			entry.Name = entry.Metadata.GetTitle()
+	if pathType == storage.PathTypeAquisition {
+		all := dirEntries
+		if opts.Filtered() {
+			all, _ = h.storage.List(urlPath, storage.ListOptions{})
 		}
+		addFacets(feed, baseUrl, urlPath, opts, all)
+	}
 
-		e := &opdsv1.Entry{
-			Title:   entry.Name,
-			ID:      filepath.Join(c.Request.RequestURI, url.PathEscape(originalName)),
-			Updated: feed.Time(entry.Updated),
-			Link: []opdsv1.Link{
-				{
-					Type:  entry.Type,
-					Title: entry.Name,
-					Href:  baseUrl.JoinPath(urlPath, originalName).String(),
-					Rel:   entry.Aquisition,
-				},
-			},
+	if opts != (storage.ListOptions{}) {
+		for i := range feed.Link {
+			if feed.Link[i].Rel == "self" {
+				feed.Link[i].Href = catalog.FeedHref(baseUrl, urlPath, catalog.FacetQuery(opts))
+			}
 		}
-		if entry.Metadata.HasCover() {
-			e.Link = append(e.Link, opdsv1.Link{
-				Type: "image/jpeg",
-				Rel:  "http://opds-spec.org/image",
-				Href: baseUrl.JoinPath(urlPath, originalName, "cover").String(),
-			})
+	}
+
+	page := h.addPageLinks(c, feed, baseUrl, urlPath, string(pathType), len(dirEntries), catalog.FacetQuery(opts))
 
+	if urlPath == "" || urlPath == "/" {
+		// the views lead the catalog, later pages only hold folders
+		if page.start == 0 {
+			for _, e := range h.browseEntries(baseUrl) {
+				feed.AddEntry(e)
+			}
 		}
-		if entry.Metadata.HasThumbnail() {
-			e.Link = append(e.Link, opdsv1.Link{
-				Type: "image/jpeg",
-				Rel:  "http://opds-spec.org/image/thumbnail",
-				Href: baseUrl.JoinPath(urlPath, originalName, "thumbnail").String(),
+		for _, r := range recentFeeds {
+			feed.Link = append(feed.Link, opdsv1.Link{
+				Rel:   r.rel,
+				Type:  opdsv1.FeedAcquisitionLinkType,
+				Title: r.title,
+				Href:  baseUrl.JoinPath(browsePath, r.name).String(),
 			})
 		}
+	}
+	for _, entry := range dirEntries[page.start:page.end()] {
+		feed.AddEntry(h.makeEntry(baseUrl, urlPath, entry, profile))
+	}
+	keepProfile(c, feed)
 
-		if entry.Metadata.GetCreator() != "" {
-			e.Authors = append(e.Authors, opdsv1.Author{
-				Name: entry.Metadata.GetCreator(),
-			})
-		}
-		if entry.Metadata.GetSubject() != "" {
-			e.Summary = safeSummary(entry.Metadata.GetSubject())
-		}
-		if entry.Metadata.GetDescription() != "" {
-			e.Content = safeDescription(entry.Metadata.GetDescription())
-		}
-		if entry.Metadata.GetLanguage() != "" {
-			e.Language = entry.Metadata.GetLanguage()
+	return feed
+}
+
+// completeEntry builds the complete entry of the store entry found in the
+// folder urlPath, with every piece of metadata known.
+func (h opdsv1Handler) completeEntry(baseUrl *url.URL, urlPath string, entry storage.Entry, profile *device.Profile) *opdsv1.Entry {
+	originalName := entry.Name
+	if entry.Metadata.GetTitle() != "" {
+		entry.Name = entry.Metadata.GetTitle()
+	}
+
+	e := &opdsv1.Entry{
+		Title:   entry.Name,
+		ID:      filepath.Join(baseUrl.JoinPath(urlPath).EscapedPath(), url.PathEscape(originalName)),
+		Updated: opdsv1.Time(entry.Updated),
+	}
+	if len(entry.Files) == 0 {
+		e.Link = append(e.Link, opdsv1.Link{
+			Type:  entry.Type,
+			Title: entry.Name,
+			Href:  baseUrl.JoinPath(urlPath, originalName).String(),
+			Rel:   entry.Aquisition,
+		})
+	}
+	// one acquisition link per format of the book
+	for _, f := range entry.Files {
+		title := entry.Name
+		if len(entry.Files) > 1 {
+			title = catalog.FormatTitle(f.Type)
 		}
-		feed.AddEntry(e)
+		e.Link = append(e.Link, opdsv1.Link{
+			Type:   f.Type,
+			Title:  title,
+			Href:   baseUrl.JoinPath(urlPath, f.Name).String(),
+			Rel:    entry.Aquisition,
+			Length: strconv.FormatInt(f.Length, 10),
+		})
 	}
+	if entry.Metadata.HasCover() {
+		e.Link = append(e.Link, opdsv1.Link{
+			Type: "image/jpeg",
+			Rel:  "http://opds-spec.org/image",
+			Href: baseUrl.JoinPath(urlPath, originalName, "cover").String(),
+		})
 
-	return feed
+	}
+	if entry.Metadata.HasThumbnail() {
+		e.Link = append(e.Link, opdsv1.Link{
+			Type: "image/jpeg",
+			Rel:  "http://opds-spec.org/image/thumbnail",
+			Href: baseUrl.JoinPath(urlPath, originalName, "thumbnail").String(),
+		})
+	}
+
+	for _, a := range storage.Authors(entry.Metadata) {
+		e.Authors = append(e.Authors, opdsv1.Author{
+			Name: a.Name,
+			Uri:  groupURL(baseUrl, "author", a.SortAs).String(),
+		})
+	}
+	for _, p := range storage.Contributors(entry.Metadata) {
+		e.Contributors = append(e.Contributors, opdsv1.Author{Name: p.Name})
+	}
+	for _, s := range storage.Subjects(entry.Metadata) {
+		e.Category = append(e.Category, opdsv1.Category{Term: s.Term, Scheme: s.Scheme, Label: s.Label})
+	}
+	e.Identifier = storage.Identifiers(entry.Metadata)
+	e.Publisher = entry.Metadata.GetPublisher()
+	e.Issued = storage.Date(entry.Metadata)
+	e.Rights = storage.Rights(entry.Metadata)
+	if entry.Metadata.GetSubject() != "" {
+		e.Summary = safeSummary(entry.Metadata.GetSubject())
+	}
+	if entry.Metadata.GetDescription() != "" {
+		e.Content = safeDescription(entry.Metadata.GetDescription())
+	}
+	if entry.Metadata.GetLanguage() != "" {
+		e.Language = entry.Metadata.GetLanguage()
+	}
+	if len(entry.Files) == 0 {
+		h.addConversionLinks(e, baseUrl, urlPath, originalName, entry.Type)
+	}
+	for _, f := range entry.Files {
+		h.addConversionLinks(e, baseUrl, urlPath, f.Name, f.Type)
+	}
+	if n := storage.PageCount(entry.Metadata); n > 0 {
+		addPageStreamLink(e, baseUrl, urlPath, originalName, n)
+	}
+	if am, ok := entry.Metadata.(storage.AudioMetadata); ok {
+		addAudioLinks(e, baseUrl, urlPath, originalName, entry, am)
+	}
+	applyProfile(e, profile)
+	return e
 }
 
 func safeDescription(s string) *opdsv1.Content {
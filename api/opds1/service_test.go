@@ -0,0 +1,355 @@
+package opds1
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"bookarr/convert"
+	_ "bookarr/convert/kepub" // offer KEPUB conversions of the books under test
+	opdsv1 "bookarr/opds/v1"
+	"bookarr/storage/dir"
+	_ "bookarr/storage/epub" // read the metadata of the books under test
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeEPUB writes a book of one chapter to name.
+func writeEPUB(t *testing.T, name, title, creator string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, file := range []struct{ name, body string }{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`},
+		{"OEBPS/content.opf", fmt.Sprintf(`<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>%s</dc:title><dc:creator>%s</dc:creator><dc:identifier id="id">%s</dc:identifier></metadata>
+<manifest><item id="one" href="one.xhtml" media-type="application/xhtml+xml"/></manifest>
+<spine><itemref idref="one"/></spine>
+</package>`, title, creator, title)},
+		{"OEBPS/one.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Chapter one. It was a dark night.</p></body></html>`},
+	} {
+		fw, err := w.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(file.body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestServer serves a library of three folders from the OPDS 1 handler
+// configured with opts, in pages of two entries.
+func newTestServer(t *testing.T, opts ...Option) http.Handler {
+	t.Helper()
+	root := t.TempDir()
+	for _, b := range []string{"a", "b", "c", "d", "e"} {
+		creator := "Writer"
+		if b == "a" {
+			creator = "AC/DC"
+		}
+		writeEPUB(t, filepath.Join(root, "Shelf", b+".epub"), "Book "+strings.ToUpper(b), creator)
+	}
+	writeEPUB(t, filepath.Join(root, "Alpha", "alpha.epub"), "Alpha", "Writer")
+	writeEPUB(t, filepath.Join(root, "Beta", "beta.epub"), "Beta", "Writer")
+
+	gin.SetMode(gin.TestMode)
+	store := dir.NewFileStore(root, dir.WithFirstSeenFile(filepath.Join(t.TempDir(), "first-seen.json")))
+	h := New("/opds/v1", store, append([]Option{WithPageSize(2)}, opts...)...)
+	r := gin.New()
+	r.GET("/opds/v1/*path", h.Handler)
+	r.HEAD("/opds/v1/*path", h.Handler)
+	return r
+}
+
+func serve(h http.Handler, method, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func getFeed(t *testing.T, h http.Handler, target string) *opdsv1.Feed {
+	t.Helper()
+	w := serve(h, http.MethodGet, target)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d", target, w.Code)
+	}
+	var feed opdsv1.Feed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("GET %s: %s\n%s", target, err, w.Body)
+	}
+	return &feed
+}
+
+// links returns the href of the links of feed by rel.
+func links(feed *opdsv1.Feed) map[string]string {
+	out := make(map[string]string)
+	for _, l := range feed.Link {
+		out[l.Rel] = l.Href
+	}
+	return out
+}
+
+func TestFeedPaging(t *testing.T) {
+	h := newTestServer(t)
+
+	tests := []struct {
+		page   string
+		titles []string
+		links  map[string]string
+	}{
+		{"", []string{"Book A", "Book B"}, map[string]string{
+			"first": "/opds/v1/Shelf?page=1",
+			"next":  "/opds/v1/Shelf?page=2",
+			"last":  "/opds/v1/Shelf?page=3",
+		}},
+		{"?page=2", []string{"Book C", "Book D"}, map[string]string{
+			"first":    "/opds/v1/Shelf?page=1",
+			"previous": "/opds/v1/Shelf?page=1",
+			"next":     "/opds/v1/Shelf?page=3",
+			"last":     "/opds/v1/Shelf?page=3",
+		}},
+		{"?page=9", []string{"Book E"}, map[string]string{
+			"first":    "/opds/v1/Shelf?page=1",
+			"previous": "/opds/v1/Shelf?page=2",
+			"last":     "/opds/v1/Shelf?page=3",
+		}},
+	}
+	for _, tt := range tests {
+		feed := getFeed(t, h, "/opds/v1/Shelf"+tt.page)
+		var titles []string
+		for _, e := range feed.Entry {
+			titles = append(titles, e.Title)
+		}
+		if strings.Join(titles, ",") != strings.Join(tt.titles, ",") {
+			t.Errorf("page %q entries = %v, want %v", tt.page, titles, tt.titles)
+		}
+		got := links(feed)
+		for _, rel := range []string{"first", "previous", "next", "last"} {
+			if got[rel] != tt.links[rel] {
+				t.Errorf("page %q %s link = %q, want %q", tt.page, rel, got[rel], tt.links[rel])
+			}
+		}
+		if feed.SearchResult != 5 || feed.ItemsPerPage != 2 {
+			t.Errorf("page %q totalResults, itemsPerPage = %d, %d", tt.page, feed.SearchResult, feed.ItemsPerPage)
+		}
+	}
+}
+
+func TestRootFeed(t *testing.T) {
+	h := newTestServer(t)
+
+	feed := getFeed(t, h, "/opds/v1/")
+	got := links(feed)
+	if got["http://opds-spec.org/sort/new"] != "/opds/v1/browse/new" {
+		t.Errorf("root links = %v, want the recently added feed", got)
+	}
+	for _, r := range recentFeeds {
+		found := false
+		for _, l := range feed.Link {
+			found = found || l.Href == "/opds/v1/browse/"+r.name
+		}
+		if !found {
+			t.Errorf("root feed does not link %s", r.name)
+		}
+	}
+	views := len(recentFeeds) + len(index.Views)
+	if len(feed.Entry) != views+2 || feed.Entry[views].Title != "Alpha" || feed.Entry[views+1].Title != "Beta" {
+		t.Errorf("first page has %d entries, want %d views then Alpha and Beta", len(feed.Entry), views)
+	}
+
+	feed = getFeed(t, h, "/opds/v1/?page=2")
+	if len(feed.Entry) != 1 || feed.Entry[0].Title != "Shelf" {
+		var titles []string
+		for _, e := range feed.Entry {
+			titles = append(titles, e.Title)
+		}
+		t.Errorf("second page entries = %v, want only Shelf", titles)
+	}
+}
+
+func TestEntryDocument(t *testing.T) {
+	h := newTestServer(t)
+
+	feed := getFeed(t, h, "/opds/v1/Shelf")
+	var href string
+	for _, l := range feed.Entry[0].Link {
+		if l.Rel == "alternate" && l.Type == opdsv1.EntryLinkType {
+			href = l.Href
+		}
+	}
+	if href != "/opds/v1/Shelf/a.epub/entry" {
+		t.Fatalf("partial entry links %q, want its entry document", href)
+	}
+
+	w := serve(h, http.MethodGet, href)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d", href, w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != opdsv1.EntryLinkType {
+		t.Errorf("Content-Type = %q", got)
+	}
+	var e opdsv1.Entry
+	if err := xml.Unmarshal(w.Body.Bytes(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Title != "Book A" || len(e.Authors) != 1 || e.Authors[0].Name != "AC/DC" {
+		t.Errorf("entry = %q by %+v", e.Title, e.Authors)
+	}
+
+	// the author holds a slash, which must stay inside one path segment
+	var related string
+	for _, l := range e.Link {
+		if l.Rel == "related" && strings.HasPrefix(l.Title, "Books by") {
+			related = l.Href
+		}
+	}
+	if related != "/opds/v1/browse/author/AC%2FDC" {
+		t.Fatalf("related author link = %q", related)
+	}
+	group := getFeed(t, h, related)
+	if len(group.Entry) != 1 || group.Entry[0].Title != "Book A" {
+		t.Errorf("author feed has %d entries", len(group.Entry))
+	}
+	authors := getFeed(t, h, "/opds/v1/browse/author")
+	found := false
+	for _, e := range authors.Entry {
+		for _, l := range e.Link {
+			found = found || l.Href == related
+		}
+	}
+	if !found {
+		t.Errorf("author view does not link %s", related)
+	}
+
+	if w := serve(h, http.MethodGet, "/opds/v1/Shelf/missing.epub/entry"); w.Code != http.StatusNotFound {
+		t.Errorf("entry of a missing book = %d, want 404", w.Code)
+	}
+}
+
+func TestDownloadRanges(t *testing.T) {
+	h := newTestServer(t)
+
+	full := serve(h, http.MethodGet, "/opds/v1/Shelf/a.epub")
+	if full.Code != http.StatusOK || full.Header().Get("Content-Type") != "application/epub+zip" {
+		t.Fatalf("GET book = %d %q", full.Code, full.Header().Get("Content-Type"))
+	}
+	size := full.Body.Len()
+
+	w := serve(h, http.MethodGet, "/opds/v1/Shelf/a.epub", "Range", "bytes=0-3")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "PK\x03\x04" {
+		t.Errorf("range = %d %q", w.Code, w.Body.String())
+	}
+	if got, want := w.Header().Get("Content-Range"), fmt.Sprintf("bytes 0-3/%d", size); got != want {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+
+	etag := full.Header().Get("ETag")
+	if etag == "" || full.Header().Get("Last-Modified") == "" {
+		t.Fatalf("book has no validators: %v", full.Header())
+	}
+	if w := serve(h, http.MethodGet, "/opds/v1/Shelf/a.epub", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match = %d, want 304", w.Code)
+	}
+	if w := serve(h, http.MethodGet, "/opds/v1/Shelf/a.epub", "Range", "bytes=0-3", "If-Range", `"other"`); w.Code != http.StatusOK {
+		t.Errorf("range with a stale If-Range = %d, want the whole book", w.Code)
+	}
+
+	w = serve(h, http.MethodHead, "/opds/v1/Shelf/a.epub")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != strconv.Itoa(size) {
+		t.Errorf("HEAD book = %d, %d bytes, Content-Length %q", w.Code, w.Body.Len(), w.Header().Get("Content-Length"))
+	}
+}
+
+func TestFeedConditional(t *testing.T) {
+	h := newTestServer(t)
+
+	w := serve(h, http.MethodGet, "/opds/v1/Shelf")
+	if got := w.Header().Get("Content-Type"); got != opdsv1.FeedAcquisitionLinkType {
+		t.Errorf("Content-Type = %q", got)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("feed has no ETag")
+	}
+	if w := serve(h, http.MethodGet, "/opds/v1/Shelf", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match = %d with %d bytes, want 304", w.Code, w.Body.Len())
+	}
+	if w := serve(h, http.MethodGet, "/opds/v1/Shelf?page=2", "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("If-None-Match of another page = %d, want 200", w.Code)
+	}
+
+	// the recorder keeps the body net/http drops from HEAD responses
+	head := serve(h, http.MethodHead, "/opds/v1/Shelf")
+	if head.Code != http.StatusOK {
+		t.Errorf("HEAD feed = %d", head.Code)
+	}
+	if got, want := head.Header().Get("Content-Length"), strconv.Itoa(w.Body.Len()); got != want {
+		t.Errorf("HEAD Content-Length = %q, want %q", got, want)
+	}
+	if head.Header().Get("ETag") != etag {
+		t.Errorf("HEAD ETag = %q, want %q", head.Header().Get("ETag"), etag)
+	}
+}
+
+func TestConvertedHead(t *testing.T) {
+	cache, err := convert.NewCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newTestServer(t, WithConversions(cache))
+
+	head := serve(h, http.MethodHead, "/opds/v1/Shelf/a.epub/kepub")
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Fatalf("HEAD conversion = %d with %d bytes", head.Code, head.Body.Len())
+	}
+	etag, length := head.Header().Get("ETag"), head.Header().Get("Content-Length")
+	if etag == "" || length == "" || length == "0" {
+		t.Fatalf("HEAD conversion has no length or ETag: %v", head.Header())
+	}
+
+	w := serve(h, http.MethodGet, "/opds/v1/Shelf/a.epub/kepub")
+	if w.Code != http.StatusOK || strconv.Itoa(w.Body.Len()) != length || w.Header().Get("ETag") != etag {
+		t.Errorf("GET conversion = %d, %d bytes, ETag %q; HEAD said %s bytes, ETag %q", w.Code, w.Body.Len(), w.Header().Get("ETag"), length, etag)
+	}
+	if w := serve(h, http.MethodGet, "/opds/v1/Shelf/a.epub/kepub", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match conversion = %d, want 304", w.Code)
+	}
+
+	// without a cache the conversion is only streamed
+	h = newTestServer(t, WithConversions(nil))
+	head = serve(h, http.MethodHead, "/opds/v1/Shelf/a.epub/kepub")
+	if head.Code != http.StatusOK || head.Header().Get("Accept-Ranges") != "none" {
+		t.Errorf("HEAD uncached conversion = %d, Accept-Ranges %q", head.Code, head.Header().Get("Accept-Ranges"))
+	}
+	w = serve(h, http.MethodGet, "/opds/v1/Shelf/a.epub/kepub")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/kepub+zip" {
+		t.Errorf("GET uncached conversion = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,169 @@
+package opds2
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	opdsv2 "bookarr/opds/v2"
+	"bookarr/storage"
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+// browsePath is the root of the virtual navigation built from the index,
+// laid out as in the OPDS 1 catalog.
+const browsePath = "browse"
+
+// searchPath serves the books matching the query parameter.
+const searchPath = "search"
+
+// groupSize is the number of publications shown in the groups of the root
+// feed, each linking to its complete feed.
+const groupSize = 10
+
+// recentFeeds are the feeds of the books that changed last.
+var recentFeeds = []struct {
+	name  string
+	title string
+	order storage.SortOrder
+}{
+	{"new", "Recently added", storage.SortAdded},
+	{"updated", "Recently updated", storage.SortUpdated},
+}
+
+// recentCount is the number of books in the recent feeds.
+const recentCount = 100
+
+// groupURL returns the address of the books of the group key of view. The
+// key is escaped as a single segment, since names such as "AC/DC" hold
+// slashes.
+func groupURL(baseUrl *url.URL, view, key string) *url.URL {
+	u := baseUrl.JoinPath(browsePath, view)
+	u.RawPath = u.EscapedPath() + "/" + url.PathEscape(key)
+	u.Path += "/" + key
+	return u
+}
+
+// isBrowse reports whether urlPath belongs to the virtual navigation.
+func isBrowse(urlPath string) bool {
+	return urlPath == "/"+browsePath || strings.HasPrefix(urlPath, "/"+browsePath+"/")
+}
+
+// browseNavigation returns the links to the recent feeds and every view.
+func browseNavigation(baseUrl *url.URL) []opdsv2.Link {
+	var links []opdsv2.Link
+	for _, r := range recentFeeds {
+		links = append(links, opdsv2.Link{
+			Href:  baseUrl.JoinPath(browsePath, r.name).String(),
+			Type:  opdsv2.FeedMediaType,
+			Title: r.title,
+		})
+	}
+	for _, v := range index.Views {
+		links = append(links, opdsv2.Link{
+			Href:  baseUrl.JoinPath(browsePath, v.Name).String(),
+			Type:  opdsv2.FeedMediaType,
+			Title: v.Title,
+			Rel:   "subsection",
+		})
+	}
+	return links
+}
+
+// addBrowseGroups adds to the root feed a group leading to the virtual
+// navigation and one with the latest books.
+func (h *opdsv2Handler) addBrowseGroups(feed *opdsv2.Feed, baseUrl *url.URL) {
+	feed.Groups = append(feed.Groups, opdsv2.Group{
+		Metadata:   opdsv2.FeedMetadata{Title: "Browse"},
+		Navigation: browseNavigation(baseUrl),
+	})
+
+	recent := recentFeeds[0]
+	books := h.index.Recent(recent.order, groupSize)
+	if len(books) == 0 {
+		return
+	}
+	group := opdsv2.Group{
+		Metadata: opdsv2.FeedMetadata{Title: recent.title, NumberOfItems: len(books)},
+		Links: []opdsv2.Link{{
+			Rel:  "self",
+			Href: baseUrl.JoinPath(browsePath, recent.name).String(),
+			Type: opdsv2.FeedMediaType,
+		}},
+	}
+	for _, b := range books {
+		group.Publications = append(group.Publications, h.makePublication(baseUrl, b.Dir(), b.Entry))
+	}
+	feed.Groups = append(feed.Groups, group)
+}
+
+// GetBrowse serves the virtual navigation: the list of views at /browse, the
+// groups of a view at /browse/<view> and the books of a group at
+// /browse/<view>/<key>.
+func (h *opdsv2Handler) GetBrowse(c *gin.Context) {
+	urlPath := c.Param("path")
+	baseUrl := &url.URL{Path: h.baseURL}
+
+	parts := strings.SplitN(strings.TrimPrefix(urlPath, "/"+browsePath), "/", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		feed := newFeed("Browse", baseUrl, urlPath, nil)
+		feed.Navigation = browseNavigation(baseUrl)
+		writeFeed(c, feed)
+		return
+	}
+
+	for _, r := range recentFeeds {
+		if parts[1] == r.name && len(parts) == 2 {
+			h.writeBooks(c, r.title, urlPath, h.index.Recent(r.order, recentCount), nil)
+			return
+		}
+	}
+
+	view, ok := index.ViewByName(parts[1])
+	if !ok {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+	if len(parts) == 3 && parts[2] != "" {
+		books := h.index.Group(view, parts[2])
+		if len(books) == 0 {
+			c.JSON(http.StatusNotFound, nil)
+			return
+		}
+		h.writeBooks(c, parts[2], urlPath, books, nil)
+		return
+	}
+
+	groups := h.index.Groups(view)
+	feed := newFeed(view.Title, baseUrl, urlPath, nil)
+	start, end := h.paginate(c, feed, baseUrl, urlPath, nil, len(groups))
+	for _, g := range groups[start:end] {
+		feed.Navigation = append(feed.Navigation, opdsv2.Link{
+			Href:       groupURL(baseUrl, view.Name, g.Key).String(),
+			Type:       opdsv2.FeedMediaType,
+			Title:      g.Key,
+			Properties: &opdsv2.Properties{NumberOfItems: g.Count},
+		})
+	}
+	writeFeed(c, feed)
+}
+
+// GetSearch serves the books matching the query parameter.
+func (h *opdsv2Handler) GetSearch(c *gin.Context) {
+	query := c.Query("query")
+	h.writeBooks(c, "Search results for "+query, "/"+searchPath, h.index.Search(query), url.Values{"query": {query}})
+}
+
+// writeBooks serves a paged feed of books titled title at urlPath, whose
+// links keep the query q.
+func (h *opdsv2Handler) writeBooks(c *gin.Context, title, urlPath string, books []index.Book, q url.Values) {
+	baseUrl := &url.URL{Path: h.baseURL}
+	feed := newFeed(title, baseUrl, urlPath, q)
+	start, end := h.paginate(c, feed, baseUrl, urlPath, q, len(books))
+	for _, b := range books[start:end] {
+		feed.Publications = append(feed.Publications, h.makePublication(baseUrl, b.Dir(), b.Entry))
+	}
+	writeFeed(c, feed)
+}
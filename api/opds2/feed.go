@@ -0,0 +1,161 @@
+package opds2
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"bookarr/api/internal/catalog"
+	opdsv2 "bookarr/opds/v2"
+	"bookarr/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newFeed returns a feed titled title whose self link is urlPath with the
+// query q.
+func newFeed(title string, baseUrl *url.URL, urlPath string, q url.Values) *opdsv2.Feed {
+	return &opdsv2.Feed{
+		Metadata: opdsv2.FeedMetadata{Title: title},
+		Links: []opdsv2.Link{
+			{Rel: "self", Href: catalog.FeedHref(baseUrl, urlPath, q), Type: opdsv2.FeedMediaType},
+			{Rel: "start", Href: baseUrl.String() + "/", Type: opdsv2.FeedMediaType},
+			{Rel: "search", Href: baseUrl.JoinPath(searchPath).String() + "{?query}", Type: opdsv2.FeedMediaType, Templated: true},
+		},
+	}
+}
+
+// paginate selects the page of total items requested with the page
+// parameter. It fills the paging metadata of feed and adds the first,
+// previous, next and last links, which keep the query q.
+func (h *opdsv2Handler) paginate(c *gin.Context, feed *opdsv2.Feed, baseUrl *url.URL, urlPath string, q url.Values, total int) (start, end int) {
+	feed.Metadata.NumberOfItems = total
+	size := h.pageSize
+	if size <= 0 || total <= size {
+		return 0, total
+	}
+
+	pages := (total + size - 1) / size
+	n := catalog.QueryInt(c, "page", 1, 1, pages)
+	feed.Metadata.ItemsPerPage = size
+	feed.Metadata.CurrentPage = n
+
+	href := func(page int) string {
+		pq := url.Values{}
+		for k, v := range q {
+			pq[k] = v
+		}
+		pq.Set("page", strconv.Itoa(page))
+		return catalog.FeedHref(baseUrl, urlPath, pq)
+	}
+	feed.Links[0].Href = href(n)
+	link := func(rel string, page int) {
+		feed.Links = append(feed.Links, opdsv2.Link{Rel: rel, Href: href(page), Type: opdsv2.FeedMediaType})
+	}
+	link("first", 1)
+	if n > 1 {
+		link("previous", n-1)
+	}
+	if n < pages {
+		link("next", n+1)
+	}
+	link("last", pages)
+	return (n - 1) * size, min(n*size, total)
+}
+
+// GetFeed serves the folder at urlPath: its subfolders as navigation and
+// its books as publications. The root feed also leads to the virtual
+// navigation and shows the latest books.
+func (h *opdsv2Handler) GetFeed(c *gin.Context, urlPath string) {
+	baseUrl := &url.URL{Path: h.baseURL}
+	opts := catalog.ListOptions(c)
+	entries, err := h.storage.List(urlPath, opts)
+	if err != nil {
+		log.Printf("GetFeed List err: %s", err)
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	title := "Catalog"
+	if urlPath != "/" {
+		title = "Catalog in " + urlPath
+	}
+	feed := newFeed(title, baseUrl, urlPath, catalog.FacetQuery(opts))
+
+	if h.storage.PathType(urlPath) == storage.PathTypeAquisition {
+		all := entries
+		if opts.Filtered() {
+			all, _ = h.storage.List(urlPath, storage.ListOptions{})
+		}
+		addFacets(feed, baseUrl, urlPath, opts, all)
+	}
+
+	start, end := h.paginate(c, feed, baseUrl, urlPath, catalog.FacetQuery(opts), len(entries))
+	for _, e := range entries[start:end] {
+		if e.Aquisition == "subsection" {
+			feed.Navigation = append(feed.Navigation, opdsv2.Link{
+				Rel:   "subsection",
+				Href:  baseUrl.JoinPath(urlPath, e.Name).String(),
+				Type:  opdsv2.FeedMediaType,
+				Title: e.Name,
+			})
+			continue
+		}
+		feed.Publications = append(feed.Publications, h.makePublication(baseUrl, urlPath, e))
+	}
+
+	if urlPath == "/" {
+		h.addBrowseGroups(feed, baseUrl)
+	}
+	writeFeed(c, feed)
+}
+
+// addFacets adds the sort, language and format facets of the folder urlPath
+// to feed. Language and format list the values found in entries, the
+// unfiltered content of the folder.
+func addFacets(feed *opdsv2.Feed, baseUrl *url.URL, urlPath string, opts storage.ListOptions, entries []storage.Entry) {
+	link := func(title string, active bool, count int, sel storage.ListOptions) opdsv2.Link {
+		l := opdsv2.Link{Href: catalog.FeedHref(baseUrl, urlPath, catalog.FacetQuery(sel)), Type: opdsv2.FeedMediaType, Title: title}
+		if active {
+			l.Rel = "self"
+		}
+		if count > 0 {
+			l.Properties = &opdsv2.Properties{NumberOfItems: count}
+		}
+		return l
+	}
+
+	sortFacet := opdsv2.Facet{Metadata: opdsv2.FeedMetadata{Title: "Sort by"}}
+	for _, f := range catalog.SortFacets {
+		sel := opts
+		sel.Sort = f.Order
+		sortFacet.Links = append(sortFacet.Links, link(f.Title, opts.Sort == f.Order, 0, sel))
+	}
+	feed.Facets = append(feed.Facets, sortFacet)
+
+	n := catalog.Count(entries)
+
+	facet := func(title, all string, values map[string]int, active string, set func(*storage.ListOptions, string), name func(string) string) {
+		if len(values) < 2 && active == "" {
+			return
+		}
+		f := opdsv2.Facet{Metadata: opdsv2.FeedMetadata{Title: title}}
+		sel := opts
+		set(&sel, "")
+		f.Links = append(f.Links, link(all, active == "", n.Books, sel))
+		for _, v := range catalog.SortedKeys(values) {
+			sel := opts
+			set(&sel, v)
+			f.Links = append(f.Links, link(name(v), strings.EqualFold(active, v), values[v], sel))
+		}
+		feed.Facets = append(feed.Facets, f)
+	}
+	facet("Language", "All languages", n.Languages, opts.Language,
+		func(o *storage.ListOptions, v string) { o.Language = v },
+		func(v string) string { return v })
+	facet("Format", "All formats", n.Formats, opts.Format,
+		func(o *storage.ListOptions, v string) { o.Format = v },
+		catalog.FormatTitle)
+}
@@ -0,0 +1,108 @@
+package opds2
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	opdsv2 "bookarr/opds/v2"
+	"bookarr/storage"
+)
+
+// makePublication describes the store entry found in the folder urlPath.
+// Acquisition links and images point to the OPDS 1 catalog.
+func (h *opdsv2Handler) makePublication(baseUrl *url.URL, urlPath string, entry storage.Entry) opdsv2.Publication {
+	m := entry.Metadata
+	title := m.GetTitle()
+	if title == "" {
+		title = entry.Name
+	}
+	modified := entry.Updated
+
+	p := opdsv2.Publication{
+		Metadata: opdsv2.Metadata{
+			Type:        "http://schema.org/Book",
+			Title:       title,
+			Language:    m.GetLanguage(),
+			Description: strings.TrimSpace(m.GetDescription()),
+			Published:   storage.Date(m),
+			Modified:    &modified,
+		},
+	}
+	if _, ok := m.(storage.AudioMetadata); ok {
+		p.Metadata.Type = opdsv2.AudiobookType
+	}
+	if ids := storage.Identifiers(m); len(ids) > 0 {
+		p.Metadata.Identifier = ids[0]
+	}
+
+	for _, a := range storage.Authors(m) {
+		p.Metadata.Author = append(p.Metadata.Author, opdsv2.Contributor{
+			Name:   a.Name,
+			SortAs: a.SortAs,
+			Links: []opdsv2.Link{{
+				Href: groupURL(baseUrl, "author", a.SortAs).String(),
+				Type: opdsv2.FeedMediaType,
+			}},
+		})
+	}
+	for _, c := range storage.Contributors(m) {
+		contributor := opdsv2.Contributor{Name: c.Name, SortAs: c.SortAs}
+		switch c.Role {
+		case "trl":
+			p.Metadata.Translator = append(p.Metadata.Translator, contributor)
+		case "nrt":
+			p.Metadata.Narrator = append(p.Metadata.Narrator, contributor)
+		default:
+			p.Metadata.Contributor = append(p.Metadata.Contributor, contributor)
+		}
+	}
+	if publisher := m.GetPublisher(); publisher != "" {
+		p.Metadata.Publisher = []opdsv2.Contributor{{Name: publisher}}
+	}
+	for _, s := range storage.Subjects(m) {
+		p.Metadata.Subject = append(p.Metadata.Subject, opdsv2.Subject{Name: s.Label, Scheme: s.Scheme, Code: s.Term})
+	}
+	if series, index := storage.Series(m); series != "" {
+		c := opdsv2.Collection{
+			Name: series,
+			Links: []opdsv2.Link{{
+				Href: groupURL(baseUrl, "series", series).String(),
+				Type: opdsv2.FeedMediaType,
+			}},
+		}
+		if pos, err := strconv.ParseFloat(index, 64); err == nil {
+			c.Position = &pos
+		}
+		p.Metadata.BelongsTo = &opdsv2.BelongsTo{Series: []opdsv2.Collection{c}}
+	}
+
+	if len(entry.Files) == 0 {
+		p.Links = append(p.Links, opdsv2.Link{
+			Rel:  opdsv2.AcquisitionRel,
+			Href: h.fileHref(urlPath, entry.Name),
+			Type: entry.Type,
+		})
+	}
+	for _, f := range entry.Files {
+		p.Links = append(p.Links, opdsv2.Link{
+			Rel:  opdsv2.AcquisitionRel,
+			Href: h.fileHref(urlPath, f.Name),
+			Type: f.Type,
+		})
+	}
+
+	if m.HasCover() {
+		p.Images = append(p.Images, opdsv2.Link{
+			Href: h.fileHref(urlPath, entry.Name, "cover"),
+			Type: "image/jpeg",
+		})
+	}
+	if m.HasThumbnail() {
+		p.Images = append(p.Images, opdsv2.Link{
+			Href: h.fileHref(urlPath, entry.Name, "thumbnail"),
+			Type: "image/jpeg",
+		})
+	}
+	return p
+}
@@ -0,0 +1,163 @@
+// Package opds2 provides a http handler serving the library as an OPDS 2.0
+// catalog, the JSON successor of OPDS 1, preferred by Readium based readers.
+// https://drafts.opds.io/opds-2.0
+package opds2
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"bookarr/api/auth"
+	"bookarr/api/httpcache"
+	"bookarr/api/internal/catalog"
+	opdsv2 "bookarr/opds/v2"
+	"bookarr/storage"
+	"bookarr/storage/acl"
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPageSize is the number of items per feed page unless configured
+// with WithPageSize.
+const defaultPageSize = 100
+
+// defaultFilesURL is where the OPDS 1 catalog is mounted unless configured
+// with WithFilesURL.
+const defaultFilesURL = "/opds/v1"
+
+type opdsv2Handler struct {
+	baseURL  string
+	filesURL string
+	storage  storage.Store
+	index    *index.Index
+	pageSize int
+	acl      *acl.Rules
+}
+
+// Option configures optional features of the handler.
+type Option func(*opdsv2Handler)
+
+// WithIndex searches and browses idx instead of an index of the store built
+// on first use, so the caller can share it and keep it up to date.
+func WithIndex(idx *index.Index) Option {
+	return func(h *opdsv2Handler) {
+		h.index = idx
+	}
+}
+
+// WithPageSize sets the number of items per feed page. Zero disables paging.
+func WithPageSize(n int) Option {
+	return func(h *opdsv2Handler) {
+		h.pageSize = n
+	}
+}
+
+// WithFilesURL sets where the OPDS 1 catalog of the same store is mounted.
+// Books, covers and audiobook manifests are downloaded from there, so
+// conversions and device profiles work the same for both catalogs.
+func WithFilesURL(u string) Option {
+	return func(h *opdsv2Handler) {
+		h.filesURL = u
+	}
+}
+
+// WithACL leaves the folders and books rules deny a user out of the feeds
+// and publications of the OPDS 2 catalog.
+func WithACL(rules *acl.Rules) Option {
+	return func(h *opdsv2Handler) {
+		h.acl = rules
+	}
+}
+
+func New(baseURL string, storage storage.Store, opts ...Option) *opdsv2Handler {
+	h := &opdsv2Handler{
+		baseURL:  baseURL,
+		filesURL: defaultFilesURL,
+		storage:  storage,
+		pageSize: defaultPageSize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.index == nil {
+		h.index = index.New(storage)
+	}
+	return h
+}
+
+func (h *opdsv2Handler) Handler(c *gin.Context) {
+	h = h.forRequest(c)
+	urlPath := c.Param("path")
+	if urlPath == "" {
+		urlPath = "/"
+	}
+
+	if urlPath == "/"+searchPath {
+		h.GetSearch(c)
+		return
+	}
+	if isBrowse(urlPath) {
+		h.GetBrowse(c)
+		return
+	}
+
+	switch h.storage.PathType(urlPath) {
+	case storage.PathTypeNavigation, storage.PathTypeAquisition:
+		h.GetFeed(c, urlPath)
+	case storage.PathTypeFile, storage.PathTypeAudiobook:
+		// books are served by the OPDS 1 catalog
+		c.Redirect(http.StatusFound, h.fileHref(urlPath))
+	default:
+		c.JSON(http.StatusNotFound, nil)
+	}
+}
+
+// forRequest returns the handler serving the signed in user: its links keep
+// the token of the request and it only sees what the access rules allow.
+func (h *opdsv2Handler) forRequest(c *gin.Context) *opdsv2Handler {
+	r := *h
+	prefix := auth.Prefix(c)
+	r.baseURL += prefix
+	r.filesURL += prefix
+	r.storage, r.index = catalog.Scope(c, h.acl, h.storage, h.index)
+	return &r
+}
+
+// fileHref returns the download address of the book at urlPath, or of one
+// of its resources such as the cover.
+func (h *opdsv2Handler) fileHref(urlPath string, elem ...string) string {
+	u := &url.URL{Path: h.filesURL}
+	return u.JoinPath(append([]string{urlPath}, elem...)...).String()
+}
+
+// writeFeed serves feed as JSON. The feed is modified when its newest
+// publication was.
+func writeFeed(c *gin.Context, feed *opdsv2.Feed) {
+	var modified time.Time
+	newest := func(pubs []opdsv2.Publication) {
+		for _, p := range pubs {
+			if m := p.Metadata.Modified; m != nil && m.After(modified) {
+				modified = *m
+			}
+		}
+	}
+	newest(feed.Publications)
+	for _, g := range feed.Groups {
+		newest(g.Publications)
+	}
+	if !modified.IsZero() {
+		feed.Metadata.Modified = &modified
+	}
+
+	body, err := json.Marshal(feed)
+	if err != nil {
+		log.Printf("writeFeed json.Marshal err: %s", err)
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+	httpcache.Write(c, opdsv2.FeedMediaType, body, modified)
+}
@@ -0,0 +1,240 @@
+package opds2
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	opdsv2 "bookarr/opds/v2"
+	"bookarr/storage/dir"
+	_ "bookarr/storage/epub" // read the metadata of the books under test
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeEPUB writes a book of one chapter to name.
+func writeEPUB(t *testing.T, name, title, creator string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, file := range []struct{ name, body string }{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`},
+		{"OEBPS/content.opf", fmt.Sprintf(`<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>%s</dc:title><dc:creator>%s</dc:creator><dc:identifier id="id">%s</dc:identifier></metadata>
+<manifest><item id="one" href="one.xhtml" media-type="application/xhtml+xml"/></manifest>
+<spine><itemref idref="one"/></spine>
+</package>`, title, creator, title)},
+		{"OEBPS/one.xhtml", `<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Chapter one.</p></body></html>`},
+	} {
+		fw, err := w.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(file.body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestServer serves a library of two folders from the OPDS 2 handler, in
+// pages of two items.
+func newTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	root := t.TempDir()
+	for _, b := range []string{"a", "b", "c", "d", "e"} {
+		creator := "Writer"
+		if b == "a" {
+			creator = "AC/DC"
+		}
+		writeEPUB(t, filepath.Join(root, "Shelf", b+".epub"), "Book "+strings.ToUpper(b), creator)
+	}
+	writeEPUB(t, filepath.Join(root, "Alpha", "alpha.epub"), "Alpha", "Writer")
+
+	gin.SetMode(gin.TestMode)
+	store := dir.NewFileStore(root, dir.WithFirstSeenFile(filepath.Join(t.TempDir(), "first-seen.json")))
+	h := New("/opds/v2", store, WithPageSize(2))
+	r := gin.New()
+	r.GET("/opds/v2/*path", h.Handler)
+	r.HEAD("/opds/v2/*path", h.Handler)
+	return r
+}
+
+func serve(h http.Handler, method, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func getFeed(t *testing.T, h http.Handler, target string) *opdsv2.Feed {
+	t.Helper()
+	w := serve(h, http.MethodGet, target)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d", target, w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != opdsv2.FeedMediaType {
+		t.Errorf("GET %s Content-Type = %q", target, got)
+	}
+	var feed opdsv2.Feed
+	if err := json.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("GET %s: %s\n%s", target, err, w.Body)
+	}
+	return &feed
+}
+
+// links returns the href of the links by rel.
+func links(links []opdsv2.Link) map[string]string {
+	out := make(map[string]string)
+	for _, l := range links {
+		out[l.Rel] = l.Href
+	}
+	return out
+}
+
+func TestRootFeed(t *testing.T) {
+	h := newTestServer(t)
+
+	feed := getFeed(t, h, "/opds/v2/")
+	if feed.Metadata.Title != "Catalog" {
+		t.Errorf("title = %q", feed.Metadata.Title)
+	}
+	got := links(feed.Links)
+	if got["self"] != "/opds/v2/" || got["start"] != "/opds/v2/" || got["search"] != "/opds/v2/search{?query}" {
+		t.Errorf("links = %v", got)
+	}
+	if len(feed.Navigation) != 2 || feed.Navigation[0].Href != "/opds/v2/Alpha" || feed.Navigation[1].Href != "/opds/v2/Shelf" {
+		t.Errorf("navigation = %+v", feed.Navigation)
+	}
+	if len(feed.Groups) != 2 || feed.Groups[0].Metadata.Title != "Browse" || len(feed.Groups[1].Publications) != 6 {
+		t.Errorf("root feed has %d groups, want the views and the latest books", len(feed.Groups))
+	}
+}
+
+func TestFeedPaging(t *testing.T) {
+	h := newTestServer(t)
+
+	tests := []struct {
+		page   string
+		titles []string
+		links  map[string]string
+	}{
+		{"", []string{"Book A", "Book B"}, map[string]string{
+			"self":  "/opds/v2/Shelf?page=1",
+			"first": "/opds/v2/Shelf?page=1",
+			"next":  "/opds/v2/Shelf?page=2",
+			"last":  "/opds/v2/Shelf?page=3",
+		}},
+		{"?page=2", []string{"Book C", "Book D"}, map[string]string{
+			"self":     "/opds/v2/Shelf?page=2",
+			"first":    "/opds/v2/Shelf?page=1",
+			"previous": "/opds/v2/Shelf?page=1",
+			"next":     "/opds/v2/Shelf?page=3",
+			"last":     "/opds/v2/Shelf?page=3",
+		}},
+		{"?page=9", []string{"Book E"}, map[string]string{
+			"self":     "/opds/v2/Shelf?page=3",
+			"first":    "/opds/v2/Shelf?page=1",
+			"previous": "/opds/v2/Shelf?page=2",
+			"last":     "/opds/v2/Shelf?page=3",
+		}},
+	}
+	for _, tt := range tests {
+		feed := getFeed(t, h, "/opds/v2/Shelf"+tt.page)
+		var titles []string
+		for _, p := range feed.Publications {
+			titles = append(titles, p.Metadata.Title)
+		}
+		if strings.Join(titles, ",") != strings.Join(tt.titles, ",") {
+			t.Errorf("page %q publications = %v, want %v", tt.page, titles, tt.titles)
+		}
+		got := links(feed.Links)
+		for _, rel := range []string{"self", "first", "previous", "next", "last"} {
+			if got[rel] != tt.links[rel] {
+				t.Errorf("page %q %s link = %q, want %q", tt.page, rel, got[rel], tt.links[rel])
+			}
+		}
+		if feed.Metadata.NumberOfItems != 5 || feed.Metadata.ItemsPerPage != 2 {
+			t.Errorf("page %q numberOfItems, itemsPerPage = %d, %d", tt.page, feed.Metadata.NumberOfItems, feed.Metadata.ItemsPerPage)
+		}
+	}
+}
+
+func TestPublication(t *testing.T) {
+	h := newTestServer(t)
+
+	feed := getFeed(t, h, "/opds/v2/Shelf")
+	p := feed.Publications[0]
+	if got := links(p.Links)["http://opds-spec.org/acquisition"]; got != "/opds/v1/Shelf/a.epub" {
+		t.Errorf("acquisition link = %q, want the OPDS 1 download", got)
+	}
+	if len(p.Metadata.Author) != 1 || p.Metadata.Author[0].Name != "AC/DC" || len(p.Metadata.Author[0].Links) != 1 {
+		t.Fatalf("authors = %+v", p.Metadata.Author)
+	}
+
+	// the author holds a slash, which must stay inside one path segment
+	href := p.Metadata.Author[0].Links[0].Href
+	if href != "/opds/v2/browse/author/AC%2FDC" {
+		t.Fatalf("author link = %q", href)
+	}
+	group := getFeed(t, h, href)
+	if len(group.Publications) != 1 || group.Publications[0].Metadata.Title != "Book A" {
+		t.Errorf("author feed has %d publications", len(group.Publications))
+	}
+
+	w := serve(h, http.MethodGet, "/opds/v2/Shelf/a.epub")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/opds/v1/Shelf/a.epub" {
+		t.Errorf("book = %d to %q, want a redirect to the OPDS 1 download", w.Code, w.Header().Get("Location"))
+	}
+	if w := serve(h, http.MethodGet, "/opds/v2/Missing"); w.Code != http.StatusNotFound {
+		t.Errorf("missing folder = %d, want 404", w.Code)
+	}
+}
+
+func TestFeedConditional(t *testing.T) {
+	h := newTestServer(t)
+
+	w := serve(h, http.MethodGet, "/opds/v2/Shelf")
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Last-Modified") == "" {
+		t.Fatalf("feed has no validators: %v", w.Header())
+	}
+	if w := serve(h, http.MethodGet, "/opds/v2/Shelf", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match = %d with %d bytes, want 304", w.Code, w.Body.Len())
+	}
+	if w := serve(h, http.MethodGet, "/opds/v2/Shelf", "If-None-Match", `"other"`); w.Code != http.StatusOK {
+		t.Errorf("If-None-Match of another version = %d, want 200", w.Code)
+	}
+
+	// the recorder keeps the body net/http drops from HEAD responses
+	head := serve(h, http.MethodHead, "/opds/v2/Shelf")
+	if head.Code != http.StatusOK || head.Header().Get("ETag") != etag {
+		t.Errorf("HEAD feed = %d with ETag %q, want %q", head.Code, head.Header().Get("ETag"), etag)
+	}
+	if got, want := head.Header().Get("Content-Length"), strconv.Itoa(w.Body.Len()); got != want {
+		t.Errorf("HEAD Content-Length = %q, want %q", got, want)
+	}
+}
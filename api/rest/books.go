@@ -0,0 +1,301 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"bookarr/api/httpcache"
+	"bookarr/storage"
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Book is a book of the library as the API shows it.
+type Book struct {
+	// ID identifies the book in the API. It is derived from the path, so
+	// it changes when the book is moved.
+	ID   string `json:"id"`
+	Path string `json:"path"`
+	// Folder is the path of the folder holding the book.
+	Folder       string    `json:"folder"`
+	Type         string    `json:"type"`
+	Title        string    `json:"title"`
+	Authors      []Person  `json:"authors"`
+	Contributors []Person  `json:"contributors,omitempty"`
+	Series       string    `json:"series,omitempty"`
+	SeriesIndex  string    `json:"series_index,omitempty"`
+	Language     string    `json:"language,omitempty"`
+	Publisher    string    `json:"publisher,omitempty"`
+	Published    string    `json:"published,omitempty"`
+	Description  string    `json:"description,omitempty"`
+	Rights       string    `json:"rights,omitempty"`
+	Tags         []string  `json:"tags"`
+	Identifiers  []string  `json:"identifiers,omitempty"`
+	AgeRating    int       `json:"age_rating,omitempty"`
+	PageCount    int       `json:"page_count,omitempty"`
+	Narrator     string    `json:"narrator,omitempty"`
+	Duration     float64   `json:"duration,omitempty"`
+	Added        time.Time `json:"added"`
+	Updated      time.Time `json:"updated"`
+	Href         string    `json:"href"`
+	Cover        string    `json:"cover,omitempty"`
+	Thumbnail    string    `json:"thumbnail,omitempty"`
+	Files        []File    `json:"files"`
+}
+
+// Person is an author or contributor of a book.
+type Person struct {
+	Name   string `json:"name"`
+	SortAs string `json:"sort_as,omitempty"`
+	Role   string `json:"role,omitempty"`
+}
+
+// File is one of the formats of a book.
+type File struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Length int64  `json:"length,omitempty"`
+	Href   string `json:"href"`
+}
+
+// bookID returns the ID of the book at p.
+func bookID(p string) string {
+	sum := sha256.Sum256([]byte(p))
+	return hex.EncodeToString(sum[:8])
+}
+
+func people(in []storage.Person) []Person {
+	out := make([]Person, 0, len(in))
+	for _, p := range in {
+		out = append(out, Person{Name: p.Name, SortAs: p.SortAs, Role: p.Role})
+	}
+	return out
+}
+
+// newBook returns b as the API shows it.
+func (h *restHandler) newBook(b index.Book) Book {
+	m := b.Metadata
+	id := bookID(b.Path)
+	series, seriesIndex := storage.Series(m)
+	out := Book{
+		ID:          id,
+		Path:        b.Path,
+		Folder:      b.Dir(),
+		Type:        storage.MediaType(b.Type),
+		Title:       m.GetTitle(),
+		Authors:     people(storage.Authors(m)),
+		Series:      series,
+		SeriesIndex: seriesIndex,
+		Language:    m.GetLanguage(),
+		Publisher:   m.GetPublisher(),
+		Published:   storage.Date(m),
+		Description: m.GetDescription(),
+		Rights:      storage.Rights(m),
+		Tags:        []string{},
+		Identifiers: storage.Identifiers(m),
+		AgeRating:   storage.AgeRating(m),
+		PageCount:   storage.PageCount(m),
+		Added:       b.Added,
+		Updated:     b.Updated,
+		Href:        h.href("books", id),
+		Files:       []File{},
+	}
+	if out.Title == "" {
+		out.Title = strings.TrimSuffix(b.Name, path.Ext(b.Name))
+	}
+	if c := storage.Contributors(m); len(c) > 0 {
+		out.Contributors = people(c)
+	}
+	for _, s := range storage.Subjects(m) {
+		out.Tags = append(out.Tags, s.Label)
+	}
+	if am, ok := m.(storage.AudioMetadata); ok {
+		out.Narrator = am.GetNarrator()
+		out.Duration = am.GetDuration().Seconds()
+	}
+	if m.HasCover() {
+		out.Cover = h.href("books", id, "cover")
+	}
+	if m.HasThumbnail() {
+		out.Thumbnail = h.href("books", id, "thumbnail")
+	}
+
+	download := h.href("books", id, "download")
+	for i, f := range b.Files {
+		href := download
+		if i > 0 {
+			href += "?" + url.Values{"file": {f.Name}}.Encode()
+		}
+		out.Files = append(out.Files, File{Name: f.Name, Type: storage.MediaType(f.Type), Length: f.Length, Href: href})
+	}
+	return out
+}
+
+// downloadPath returns the path of the file called name of b, the first file
+// when name is empty. Audiobooks of several tracks have no first file, their
+// tracks are named instead.
+func downloadPath(b index.Book, name string) (string, int, string) {
+	var tracks []string
+	if am, ok := b.Metadata.(storage.AudioMetadata); ok {
+		for _, t := range am.GetTracks() {
+			if t.Name != "" {
+				tracks = append(tracks, t.Name)
+			}
+		}
+	}
+	if name == "" || name == b.Name {
+		if len(tracks) > 1 {
+			return "", http.StatusBadRequest, "the audiobook has several tracks, name one with the file parameter: " + strings.Join(tracks, ", ")
+		}
+		return b.Path, http.StatusOK, ""
+	}
+	for _, f := range b.Files {
+		if f.Name == name {
+			return path.Join(b.Dir(), name), http.StatusOK, ""
+		}
+	}
+	for _, t := range tracks {
+		if t == name {
+			return path.Join(b.Path, name), http.StatusOK, ""
+		}
+	}
+	return "", http.StatusNotFound, "no such file"
+}
+
+// findBook returns the book with id.
+func (h *restHandler) findBook(id string) (index.Book, bool) {
+	for _, b := range h.index.Books() {
+		if bookID(b.Path) == id {
+			return b, true
+		}
+	}
+	return index.Book{}, false
+}
+
+// hasFormat reports whether b has a file of format, a media type or a file
+// extension such as "epub".
+func hasFormat(b index.Book, format string) bool {
+	format = strings.ToLower(strings.TrimPrefix(format, "."))
+	for _, f := range b.Files {
+		if storage.MediaType(f.Type) == format || strings.TrimPrefix(strings.ToLower(path.Ext(f.Name)), ".") == format {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBooks lists the books matching the filters of the query, sorted and
+// paginated.
+func (h *restHandler) GetBooks(c *gin.Context) {
+	var books []index.Book
+	if q := c.Query("q"); q != "" {
+		books = h.index.Search(q)
+	} else {
+		books = h.index.Books()
+	}
+
+	keep := func(b index.Book) bool { return true }
+	for _, g := range groupViews {
+		key := c.Query(g.param)
+		if key == "" {
+			continue
+		}
+		view, _ := index.ViewByName(g.view)
+		prev := keep
+		keep = func(b index.Book) bool { return prev(b) && view.Has(b, key) }
+	}
+	if folder := c.Query("folder"); folder != "" {
+		folder = path.Clean("/" + folder)
+		prev := keep
+		keep = func(b index.Book) bool {
+			return prev(b) && (folder == "/" || strings.HasPrefix(b.Path, folder+"/"))
+		}
+	}
+	if format := c.Query("format"); format != "" {
+		prev := keep
+		keep = func(b index.Book) bool { return prev(b) && hasFormat(b, format) }
+	}
+	filtered := books[:0]
+	for _, b := range books {
+		if keep(b) {
+			filtered = append(filtered, b)
+		}
+	}
+	books = filtered
+
+	if s := c.Query("sort"); s != "" {
+		order, desc := strings.CutPrefix(s, "-")
+		less := storage.EntryLess(storage.SortOrder(order))
+		if less == nil {
+			writeError(c, http.StatusBadRequest, "unknown sort order "+s)
+			return
+		}
+		sort.SliceStable(books, func(i, j int) bool {
+			if desc {
+				return less(books[j].Entry, books[i].Entry)
+			}
+			return less(books[i].Entry, books[j].Entry)
+		})
+	}
+
+	page := paginate(c, books)
+	out := Page[Book]{Total: page.Total, Offset: page.Offset, Limit: page.Limit, Items: make([]Book, 0, len(page.Items))}
+	for _, b := range page.Items {
+		out.Items = append(out.Items, h.newBook(b))
+	}
+	writeJSON(c, out, h.index.Updated())
+}
+
+// GetBook serves the book with id.
+func (h *restHandler) GetBook(c *gin.Context, id string) {
+	b, ok := h.findBook(id)
+	if !ok {
+		writeError(c, http.StatusNotFound, "no such book")
+		return
+	}
+	writeJSON(c, h.newBook(b), b.Updated)
+}
+
+// GetBookFile serves the cover, thumbnail or a file of the book with id.
+func (h *restHandler) GetBookFile(c *gin.Context, id, kind string) {
+	b, ok := h.findBook(id)
+	if !ok {
+		writeError(c, http.StatusNotFound, "no such book")
+		return
+	}
+
+	var file *storage.File
+	switch kind {
+	case "cover":
+		file = h.storage.Cover(b.Path)
+	case "thumbnail":
+		file = h.storage.Thumbnail(b.Path)
+	case "download":
+		p, status, msg := downloadPath(b, c.Query("file"))
+		if status != http.StatusOK {
+			writeError(c, status, msg)
+			return
+		}
+		file = h.storage.File(p)
+		if file != nil {
+			c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(p)}))
+		}
+	default:
+		writeError(c, http.StatusNotFound, "no such resource")
+		return
+	}
+	if file == nil {
+		writeError(c, http.StatusNotFound, "no such file")
+		return
+	}
+	defer file.Reader.Close()
+	httpcache.ServeFile(c, file)
+}
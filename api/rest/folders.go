@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"bookarr/storage"
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Folder is a folder of the library with the folders and books it holds.
+type Folder struct {
+	Path    string      `json:"path"`
+	Name    string      `json:"name"`
+	Href    string      `json:"href"`
+	Parent  string      `json:"parent,omitempty"`
+	Folders []FolderRef `json:"folders"`
+	Books   []Book      `json:"books"`
+}
+
+// FolderRef is a subfolder listed in a folder.
+type FolderRef struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
+	Href string `json:"href"`
+}
+
+// GetFolder serves the folder at p with its content in the default order.
+func (h *restHandler) GetFolder(c *gin.Context, p string) {
+	p = path.Clean("/" + p)
+	switch h.storage.PathType(p) {
+	case storage.PathTypeNavigation, storage.PathTypeAquisition:
+	default:
+		writeError(c, http.StatusNotFound, "no such folder")
+		return
+	}
+	entries, err := h.storage.List(p, storage.ListOptions{})
+	if err != nil {
+		log.Printf("rest List err: %s", err)
+		writeError(c, http.StatusNotFound, "no such folder")
+		return
+	}
+
+	out := Folder{Path: p, Name: path.Base(p), Href: h.href("folders", p), Folders: []FolderRef{}, Books: []Book{}}
+	if p != "/" {
+		out.Parent = h.href("folders", path.Dir(p))
+	}
+	var modified time.Time
+	for _, e := range entries {
+		ep := path.Join(p, e.Name)
+		if e.Updated.After(modified) {
+			modified = e.Updated
+		}
+		if e.Aquisition == "subsection" {
+			out.Folders = append(out.Folders, FolderRef{Path: ep, Name: e.Name, Href: h.href("folders", ep)})
+			continue
+		}
+		out.Books = append(out.Books, h.newBook(index.Book{Path: ep, Entry: e}))
+	}
+	writeJSON(c, out, modified)
+}
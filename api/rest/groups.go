@@ -0,0 +1,90 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groupView is a list of the API grouping books by a view of the index.
+type groupView struct {
+	// view is the name of the index view.
+	view string
+	// param is the query parameter filtering books by a group of the view.
+	param string
+}
+
+// groupViews are the lists of groups by their path.
+var groupViews = map[string]groupView{
+	"authors":    {view: "author", param: "author"},
+	"series":     {view: "series", param: "series"},
+	"tags":       {view: "subject", param: "tag"},
+	"languages":  {view: "language", param: "language"},
+	"publishers": {view: "publisher", param: "publisher"},
+}
+
+// Group is an author, series, tag, language or publisher and the number of
+// books having it.
+type Group struct {
+	Name    string    `json:"name"`
+	Count   int       `json:"count"`
+	Updated time.Time `json:"updated"`
+	// Books is the address of the list of its books.
+	Books string `json:"books"`
+}
+
+// GetGroups lists the groups of g whose name contains the q query
+// parameter, sorted by name or by count and paginated.
+func (h *restHandler) GetGroups(c *gin.Context, g groupView) {
+	view, _ := index.ViewByName(g.view)
+	groups := h.index.Groups(view)
+
+	if q := strings.ToLower(c.Query("q")); q != "" {
+		matching := groups[:0]
+		for _, gr := range groups {
+			if strings.Contains(strings.ToLower(gr.Key), q) {
+				matching = append(matching, gr)
+			}
+		}
+		groups = matching
+	}
+
+	if s := c.Query("sort"); s != "" {
+		order, desc := strings.CutPrefix(s, "-")
+		var less func(a, b index.Group) bool
+		switch order {
+		case "name":
+			// Groups returns them by name already
+			less = func(a, b index.Group) bool { return false }
+		case "count":
+			less = func(a, b index.Group) bool { return a.Count > b.Count }
+		default:
+			writeError(c, http.StatusBadRequest, "unknown sort order "+s)
+			return
+		}
+		sort.SliceStable(groups, func(i, j int) bool { return less(groups[i], groups[j]) })
+		if desc {
+			for i, j := 0, len(groups)-1; i < j; i, j = i+1, j-1 {
+				groups[i], groups[j] = groups[j], groups[i]
+			}
+		}
+	}
+
+	page := paginate(c, groups)
+	out := Page[Group]{Total: page.Total, Offset: page.Offset, Limit: page.Limit, Items: make([]Group, 0, len(page.Items))}
+	for _, gr := range page.Items {
+		out.Items = append(out.Items, Group{
+			Name:    gr.Key,
+			Count:   gr.Count,
+			Updated: gr.Updated,
+			Books:   h.href("books") + "?" + url.Values{g.param: {gr.Key}}.Encode(),
+		})
+	}
+	writeJSON(c, out, h.index.Updated())
+}
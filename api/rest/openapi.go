@@ -0,0 +1,27 @@
+package rest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// GetOpenAPI serves the OpenAPI document describing the API, with the server
+// address set to where the handler is mounted.
+func (h *restHandler) GetOpenAPI(c *gin.Context) {
+	var doc map[string]any
+	if err := json.Unmarshal(openAPI, &doc); err != nil {
+		log.Printf("rest openapi.json err: %s", err)
+		writeError(c, http.StatusInternalServerError, "internal error")
+		return
+	}
+	doc["servers"] = []map[string]string{{"url": h.baseURL}}
+	writeJSON(c, doc, time.Time{})
+}
@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bookarr/storage"
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPaginate(t *testing.T) {
+	items := make([]int, 120)
+	tests := []struct {
+		query               string
+		offset, limit, size int
+	}{
+		{"", 0, defaultLimit, defaultLimit},
+		{"offset=100&limit=50", 100, 50, 20},
+		{"offset=500", 120, defaultLimit, 0},
+		{"offset=-1&limit=0", 0, 1, 1},
+		{"limit=10000", 0, maxLimit, 120},
+		{"limit=x", 0, defaultLimit, defaultLimit},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/books?"+tt.query, nil)
+		p := paginate(c, items)
+		if p.Total != 120 || p.Offset != tt.offset || p.Limit != tt.limit || len(p.Items) != tt.size {
+			t.Errorf("paginate(%q) = total %d, offset %d, limit %d, %d items", tt.query, p.Total, p.Offset, p.Limit, len(p.Items))
+		}
+		if p.Items == nil {
+			t.Errorf("paginate(%q) items are nil, want an empty list", tt.query)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	var doc struct {
+		Paths map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPI, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for name := range groupViews {
+		if _, ok := doc.Paths["/"+name]; !ok {
+			t.Errorf("openapi.json does not document /%s", name)
+		}
+	}
+}
+
+// audioMeta is an audiobook of fixed tracks.
+type audioMeta struct {
+	storage.NOOPMetadata
+	tracks []storage.Track
+}
+
+func (m audioMeta) GetNarrator() string            { return "" }
+func (m audioMeta) GetDuration() time.Duration     { return 0 }
+func (m audioMeta) GetTracks() []storage.Track     { return m.tracks }
+func (m audioMeta) GetChapters() []storage.Chapter { return nil }
+
+func TestDownloadPath(t *testing.T) {
+	grouped := index.Book{Path: "/a/book.epub", Entry: storage.Entry{
+		Name:     "book.epub",
+		Files:    []storage.BookFile{{Name: "book.epub"}, {Name: "book.pdf"}},
+		Metadata: storage.NOOPMetadata{},
+	}}
+	m4b := index.Book{Path: "/a/book.m4b", Entry: storage.Entry{
+		Name:     "book.m4b",
+		Files:    []storage.BookFile{{Name: "book.m4b"}},
+		Metadata: audioMeta{tracks: []storage.Track{{}}},
+	}}
+	folder := index.Book{Path: "/a/Audio", Entry: storage.Entry{
+		Name:     "Audio",
+		Metadata: audioMeta{tracks: []storage.Track{{Name: "01.mp3"}, {Name: "02.mp3"}}},
+	}}
+
+	tests := []struct {
+		book   index.Book
+		file   string
+		path   string
+		status int
+	}{
+		{grouped, "", "/a/book.epub", http.StatusOK},
+		{grouped, "book.pdf", "/a/book.pdf", http.StatusOK},
+		{grouped, "other.pdf", "", http.StatusNotFound},
+		{m4b, "", "/a/book.m4b", http.StatusOK},
+		{folder, "", "", http.StatusBadRequest},
+		{folder, "Audio", "", http.StatusBadRequest},
+		{folder, "02.mp3", "/a/Audio/02.mp3", http.StatusOK},
+		{folder, "03.mp3", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		p, status, msg := downloadPath(tt.book, tt.file)
+		if p != tt.path || status != tt.status {
+			t.Errorf("downloadPath(%s, %q) = %q, %d, want %q, %d", tt.book.Path, tt.file, p, status, tt.path, tt.status)
+		}
+		if status == http.StatusBadRequest && !strings.Contains(msg, "01.mp3, 02.mp3") {
+			t.Errorf("downloadPath(%s, %q) message %q does not list the tracks", tt.book.Path, tt.file, msg)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Package rest provides a http handler serving the library as a versioned JSON
+API, for scripts and dashboards that would rather not parse OPDS. It reads
+the same store and index as the catalogs and applies the same access rules.
+The API is described by the OpenAPI document served at openapi.json.
+*/
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"bookarr/api/httpcache"
+	"bookarr/api/internal/catalog"
+	"bookarr/storage"
+	"bookarr/storage/acl"
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultLimit is the number of items per page unless the request
+	// sets limit.
+	defaultLimit = 50
+	// maxLimit is the largest number of items per page.
+	maxLimit = 500
+)
+
+const jsonType = "application/json; charset=utf-8"
+
+type restHandler struct {
+	baseURL string
+	storage storage.Store
+	index   *index.Index
+	acl     *acl.Rules
+}
+
+// Option configures optional features of the handler.
+type Option func(*restHandler)
+
+// WithIndex lists and filters idx instead of an index of the store built on
+// first use, so the caller can share it and keep it up to date.
+func WithIndex(idx *index.Index) Option {
+	return func(h *restHandler) {
+		h.index = idx
+	}
+}
+
+// WithACL answers every user of the API as if the folders and books rules
+// deny them did not exist.
+func WithACL(rules *acl.Rules) Option {
+	return func(h *restHandler) {
+		h.acl = rules
+	}
+}
+
+func New(baseURL string, storage storage.Store, opts ...Option) *restHandler {
+	h := &restHandler{
+		baseURL: baseURL,
+		storage: storage,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.index == nil {
+		h.index = index.New(storage)
+	}
+	return h
+}
+
+// Handler routes the requests of the API by their path parameter.
+func (h *restHandler) Handler(c *gin.Context) {
+	h = h.forRequest(c)
+	urlPath := strings.TrimSuffix(c.Param("path"), "/")
+	if urlPath == "" {
+		urlPath = "/"
+	}
+
+	if urlPath == "/" || urlPath == "/openapi.json" {
+		h.GetOpenAPI(c)
+		return
+	}
+	if urlPath == "/folders" || strings.HasPrefix(urlPath, "/folders/") {
+		h.GetFolder(c, strings.TrimPrefix(urlPath, "/folders"))
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(urlPath, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "books":
+		h.GetBooks(c)
+	case len(parts) == 2 && parts[0] == "books":
+		h.GetBook(c, parts[1])
+	case len(parts) == 3 && parts[0] == "books":
+		h.GetBookFile(c, parts[1], parts[2])
+	case len(parts) == 1:
+		if v, ok := groupViews[parts[0]]; ok {
+			h.GetGroups(c, v)
+			return
+		}
+		writeError(c, http.StatusNotFound, "no such resource")
+	default:
+		writeError(c, http.StatusNotFound, "no such resource")
+	}
+}
+
+// forRequest returns the handler serving the signed in user, which only
+// sees what the access rules allow.
+func (h *restHandler) forRequest(c *gin.Context) *restHandler {
+	r := *h
+	r.storage, r.index = catalog.Scope(c, h.acl, h.storage, h.index)
+	return &r
+}
+
+// href returns the address of the resource at elem under the API.
+func (h *restHandler) href(elem ...string) string {
+	u := &url.URL{Path: h.baseURL}
+	return u.JoinPath(elem...).String()
+}
+
+// Page is a page of a list, with the total number of items matching the
+// request.
+type Page[T any] struct {
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Items  []T `json:"items"`
+}
+
+// paginate returns the page of items the offset and limit query parameters
+// select.
+func paginate[T any](c *gin.Context, items []T) Page[T] {
+	offset := catalog.QueryInt(c, "offset", 0, 0, len(items))
+	limit := catalog.QueryInt(c, "limit", defaultLimit, 1, maxLimit)
+	end := min(offset+limit, len(items))
+	page := Page[T]{Total: len(items), Offset: offset, Limit: limit, Items: items[offset:end]}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	return page
+}
+
+// writeJSON serves v, which last changed at modified.
+func writeJSON(c *gin.Context, v any, modified time.Time) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("rest json.Marshal err: %s", err)
+		writeError(c, http.StatusInternalServerError, "internal error")
+		return
+	}
+	httpcache.Write(c, jsonType, body, modified)
+}
+
+// Error is the body of the responses to failed requests.
+type Error struct {
+	Error string `json:"error"`
+}
+
+func writeError(c *gin.Context, status int, msg string) {
+	c.JSON(status, Error{Error: msg})
+}
@@ -0,0 +1,196 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"bookarr/storage"
+	"bookarr/storage/index"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recentCount is the number of books on the recently added and updated
+// pages.
+const recentCount = 100
+
+// recentPages are the pages of the books that changed last.
+var recentPages = []struct {
+	name  string
+	title string
+	order storage.SortOrder
+}{
+	{"new", "Recently added", storage.SortAdded},
+	{"updated", "Recently updated", storage.SortUpdated},
+}
+
+// sortOrders are the orders folders can be listed in.
+var sortOrders = []struct {
+	title string
+	order storage.SortOrder
+}{
+	{"Author", storage.SortDefault},
+	{"Title", storage.SortTitle},
+	{"Recently added", storage.SortAdded},
+	{"Published", storage.SortPublished},
+	{"Series", storage.SortSeries},
+}
+
+// viewLinks returns the links to the recent books and the virtual views.
+func (h *webHandler) viewLinks() []link {
+	var out []link
+	for _, r := range recentPages {
+		out = append(out, link{Title: r.title, Href: h.href(browsePath, r.name)})
+	}
+	for _, v := range index.Views {
+		out = append(out, link{Title: v.Title, Href: h.href(browsePath, v.Name)})
+	}
+	return out
+}
+
+// crumbs returns the links to the folders leading to p.
+func (h *webHandler) crumbs(p string) []link {
+	out := []link{{Title: "Library", Href: h.href("/")}}
+	cur := "/"
+	for _, name := range strings.Split(strings.Trim(p, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		cur = path.Join(cur, name)
+		out = append(out, link{Title: name, Href: h.href(cur)})
+	}
+	return out
+}
+
+// bookViews returns the page of books selected by the request.
+func (h *webHandler) bookViews(c *gin.Context, p *page, books []index.Book) []bookView {
+	var out []bookView
+	for _, b := range paginate(h, c, p, books) {
+		out = append(out, h.newBookView(b.Path, b.Entry))
+	}
+	return out
+}
+
+// GetFolder serves the page listing the folders and books of the folder at
+// urlPath.
+func (h *webHandler) GetFolder(c *gin.Context, urlPath string) {
+	order := storage.SortOrder(c.Query("sort"))
+	entries, err := h.storage.List(urlPath, storage.ListOptions{Sort: order})
+	if err != nil {
+		log.Printf("web List err: %s", err)
+		h.notFound(c)
+		return
+	}
+
+	p := &page{Title: path.Base(urlPath), Crumbs: h.crumbs(urlPath)}
+	if urlPath == "/" {
+		p.Title = "Library"
+	}
+	var books []index.Book
+	var modified time.Time
+	for _, e := range entries {
+		if e.Updated.After(modified) {
+			modified = e.Updated
+		}
+		ep := path.Join(urlPath, e.Name)
+		if e.Aquisition == "subsection" {
+			p.Folders = append(p.Folders, link{Title: e.Name, Href: h.href(ep)})
+			continue
+		}
+		books = append(books, index.Book{Path: ep, Entry: e})
+	}
+	p.Books = h.bookViews(c, p, books)
+
+	if len(books) > 1 {
+		for _, s := range sortOrders {
+			href := h.href(urlPath)
+			if s.order != storage.SortDefault {
+				href += "?" + url.Values{"sort": {string(s.order)}}.Encode()
+			}
+			p.Sorts = append(p.Sorts, link{Title: s.title, Href: href, Current: s.order == order})
+		}
+	}
+	h.render(c, http.StatusOK, "folder.html", p, modified)
+}
+
+// GetBook serves the page of the book at urlPath.
+func (h *webHandler) GetBook(c *gin.Context, urlPath string) {
+	e, err := h.storage.Entry(urlPath)
+	if err != nil {
+		h.notFound(c)
+		return
+	}
+	// the index holds the book as listed, with its other formats
+	for _, b := range h.index.Books() {
+		if b.Path == urlPath {
+			e = &b.Entry
+			break
+		}
+	}
+	b := h.newBookView(urlPath, *e)
+	p := &page{Title: b.Title, Crumbs: h.crumbs(path.Dir(urlPath)), Book: &b}
+	h.render(c, http.StatusOK, "book.html", p, e.Updated)
+}
+
+// GetSearch serves the page of the books matching the q query parameter.
+func (h *webHandler) GetSearch(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	p := &page{Title: "Search", Query: q}
+	if q != "" {
+		p.Title = "Search: " + q
+		p.Books = h.bookViews(c, p, h.index.Search(q))
+	}
+	h.render(c, http.StatusOK, "books.html", p, h.index.Updated())
+}
+
+// GetBrowse serves the pages of the recent books and the virtual views:
+// the list of views at /, the groups of a view at /<view>, and the books of
+// a group at /<view>/<key>.
+func (h *webHandler) GetBrowse(c *gin.Context, rest string) {
+	parts := strings.SplitN(strings.Trim(rest, "/"), "/", 2)
+	browse := link{Title: "Browse", Href: h.href(browsePath)}
+	updated := h.index.Updated()
+
+	if parts[0] == "" {
+		p := &page{Title: "Browse"}
+		p.Groups = h.viewLinks()
+		h.render(c, http.StatusOK, "groups.html", p, updated)
+		return
+	}
+
+	for _, r := range recentPages {
+		if parts[0] == r.name && len(parts) == 1 {
+			p := &page{Title: r.title, Crumbs: []link{browse}}
+			p.Books = h.bookViews(c, p, h.index.Recent(r.order, recentCount))
+			h.render(c, http.StatusOK, "books.html", p, updated)
+			return
+		}
+	}
+
+	view, ok := index.ViewByName(parts[0])
+	if !ok {
+		h.notFound(c)
+		return
+	}
+	if len(parts) == 1 {
+		p := &page{Title: view.Title, Crumbs: []link{browse}}
+		for _, g := range h.index.Groups(view) {
+			p.Groups = append(p.Groups, link{Title: g.Key, Href: h.groupHref(view.Name, g.Key), Count: g.Count})
+		}
+		h.render(c, http.StatusOK, "groups.html", p, updated)
+		return
+	}
+
+	books := h.index.Group(view, parts[1])
+	if len(books) == 0 {
+		h.notFound(c)
+		return
+	}
+	p := &page{Title: parts[1], Crumbs: []link{browse, {Title: view.Title, Href: h.href(browsePath, view.Name)}}}
+	p.Books = h.bookViews(c, p, books)
+	h.render(c, http.StatusOK, "books.html", p, updated)
+}
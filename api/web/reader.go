@@ -0,0 +1,376 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bookarr/api/auth"
+	"bookarr/api/httpcache"
+	"bookarr/storage"
+	"bookarr/storage/epub"
+	"bookarr/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// readPath follows the path of an EPUB book for its reader page, and
+	// for the files of its archive, e.g. /book.epub/read/OEBPS/ch1.xhtml.
+	readPath = "read"
+	// positionPath follows the path of an EPUB book for saving where the
+	// user stopped reading it.
+	positionPath = "position"
+)
+
+const epubType = "application/epub+zip"
+
+// contentPolicy keeps the scripts of books from running, as their documents
+// are served from the origin of the catalog.
+const contentPolicy = "default-src 'self' data:; script-src 'none'; style-src 'self' 'unsafe-inline'; object-src 'none'"
+
+// WithPositions remembers in db where every user stopped reading books in
+// the reader, and opens them there again.
+func WithPositions(db *users.DB) Option {
+	return func(h *webHandler) {
+		h.positions = db
+	}
+}
+
+// readerView is the reader page of a chapter of a book.
+type readerView struct {
+	// Book is the address of the page of the book.
+	Book string
+	// Chapter is the index of the chapter in reading order, and ChapterNum
+	// its number.
+	Chapter    int
+	ChapterNum int
+	Chapters   int
+	// Src is the address of the document of the chapter.
+	Src        string
+	Prev, Next string
+	TOC        []tocLink
+	// Spine lists the addresses of the chapters, so the script can follow
+	// links between them.
+	Spine    []string
+	Progress float64
+	// Position is where the script saves the position, empty when it is
+	// not remembered.
+	Position string
+}
+
+// tocLink is an entry of the table of contents.
+type tocLink struct {
+	Title   string
+	Href    string
+	Depth   int
+	Current bool
+}
+
+// readerPath splits urlPath into the path of an EPUB book and what follows
+// action, e.g. "/a/b.epub/read/OEBPS/ch1.xhtml" into "/a/b.epub" and
+// "/OEBPS/ch1.xhtml".
+func readerPath(urlPath, action string) (book, rest string, ok bool) {
+	marker := ".epub/" + action
+	i := strings.Index(strings.ToLower(urlPath), marker)
+	if i < 0 {
+		return "", "", false
+	}
+	book, rest = urlPath[:i+len(".epub")], urlPath[i+len(marker):]
+	if rest != "" && rest[0] != '/' {
+		return "", "", false
+	}
+	return book, rest, true
+}
+
+// maxOpenBooks is how many EPUB archives the reader keeps open and parsed.
+const maxOpenBooks = 8
+
+// openBooks keeps the archives read last open, so the chapters and images of
+// the book being read don't parse it again for every request.
+type openBooks struct {
+	mu sync.Mutex
+	// books are the open archives, the most recently used first.
+	books []*openBook
+}
+
+// openBook is an EPUB archive shared by the requests reading it. It is
+// closed once it left the cache and the last request released it.
+type openBook struct {
+	*epub.Reader
+	file  *storage.File
+	path  string
+	cache *openBooks
+	refs  int
+	// cached is false once the book left the cache.
+	cached bool
+}
+
+// get returns the archive of book, as long as it is still size bytes long
+// and was last changed at modified.
+func (o *openBooks) get(book string, size int64, modified time.Time) *openBook {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i, b := range o.books {
+		if b.path != book {
+			continue
+		}
+		if b.file.ContentLength != size || !b.file.ModTime.Equal(modified) {
+			o.remove(i)
+			return nil
+		}
+		copy(o.books[1:i+1], o.books[:i])
+		o.books[0] = b
+		b.refs++
+		return b
+	}
+	return nil
+}
+
+// add caches b, closing the least recently used archive when full.
+func (o *openBooks) add(b *openBook) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.books {
+		if o.books[i].path == b.path {
+			o.remove(i)
+			break
+		}
+	}
+	if len(o.books) == maxOpenBooks {
+		o.remove(len(o.books) - 1)
+	}
+	b.cached = true
+	o.books = append([]*openBook{b}, o.books...)
+}
+
+// remove drops the archive at i from the cache. The lock must be held.
+func (o *openBooks) remove(i int) {
+	b := o.books[i]
+	o.books = append(o.books[:i], o.books[i+1:]...)
+	b.cached = false
+	if b.refs == 0 {
+		b.file.Reader.Close()
+	}
+}
+
+// release ends the use of b by a request.
+func (b *openBook) release() {
+	b.cache.mu.Lock()
+	defer b.cache.mu.Unlock()
+
+	b.refs--
+	if b.refs == 0 && !b.cached {
+		b.file.Reader.Close()
+	}
+}
+
+// openBook returns the EPUB archive at book, opening it unless it is open
+// already. The caller releases it once done.
+func (h *webHandler) openBook(book string) (*openBook, error) {
+	if h.storage.PathType(book) != storage.PathTypeFile {
+		return nil, os.ErrNotExist
+	}
+	file := h.storage.File(book)
+	if file == nil {
+		return nil, os.ErrNotExist
+	}
+	if b := h.books.get(book, file.ContentLength, file.ModTime); b != nil {
+		file.Reader.Close()
+		return b, nil
+	}
+
+	ra, ok := file.Reader.(io.ReaderAt)
+	if !ok {
+		data, err := io.ReadAll(file.Reader)
+		if err != nil {
+			file.Reader.Close()
+			return nil, err
+		}
+		ra = bytes.NewReader(data)
+	}
+	r, err := epub.NewReader(ra, file.ContentLength)
+	if err != nil {
+		file.Reader.Close()
+		return nil, err
+	}
+	b := &openBook{Reader: r, file: file, path: book, cache: h.books, refs: 1}
+	h.books.add(b)
+	return b, nil
+}
+
+// GetReader serves the reader page of the chapter of book selected by the
+// chapter query parameter, or of the one the user stopped reading at.
+func (h *webHandler) GetReader(c *gin.Context, book string) {
+	r, err := h.openBook(book)
+	if err != nil {
+		log.Printf("web openBook err: %s", err)
+		h.notFound(c)
+		return
+	}
+	defer r.release()
+
+	rf := r.Rootfiles[0]
+	var spine []string
+	for _, ref := range rf.Spine.Itemrefs {
+		if ref.Item != nil {
+			spine = append(spine, rf.ItemPath(ref.Item))
+		}
+	}
+	if len(spine) == 0 {
+		h.notFound(c)
+		return
+	}
+
+	user := auth.User(c)
+	var saved users.Position
+	if h.positions != nil {
+		if saved, _, err = h.positions.Position(user, book); err != nil {
+			log.Printf("web Position err: %s", err)
+		}
+	}
+	v := readerView{Book: h.href(book), Chapters: len(spine), Chapter: saved.Chapter, Progress: saved.Progress}
+	if n, err := strconv.Atoi(c.Query("chapter")); err == nil {
+		if n != saved.Chapter {
+			v.Chapter, v.Progress = n, 0
+		}
+	}
+	v.Chapter = min(max(v.Chapter, 0), len(spine)-1)
+	v.ChapterNum = v.Chapter + 1
+	// the position is only saved by the script with PostPosition, so
+	// prefetching the page doesn't move it
+	if h.positions != nil {
+		v.Position = h.href(book, positionPath)
+	}
+
+	read := h.href(book, readPath)
+	chapterHref := func(n int, anchor string) string {
+		q := url.Values{"chapter": {strconv.Itoa(n)}}
+		if anchor != "" {
+			q.Set("anchor", anchor)
+		}
+		return read + "?" + q.Encode()
+	}
+	for _, p := range spine {
+		v.Spine = append(v.Spine, h.href(book, readPath, p))
+	}
+	v.Src = v.Spine[v.Chapter]
+	if anchor := c.Query("anchor"); anchor != "" {
+		v.Src += "#" + url.PathEscape(anchor)
+		v.Progress = 0
+	}
+	if v.Chapter > 0 {
+		v.Prev = chapterHref(v.Chapter-1, "")
+	}
+	if v.Chapter < len(spine)-1 {
+		v.Next = chapterHref(v.Chapter+1, "")
+	}
+
+	toc, err := r.TOC()
+	if err != nil {
+		log.Printf("web TOC err: %s", err)
+	}
+	current := false
+	var walk func(points []epub.NavPoint, depth int)
+	walk = func(points []epub.NavPoint, depth int) {
+		for _, p := range points {
+			doc, anchor, _ := strings.Cut(p.Href, "#")
+			l := tocLink{Title: p.Title, Depth: depth}
+			for n, s := range spine {
+				if s == doc {
+					l.Href = chapterHref(n, anchor)
+					l.Current = n == v.Chapter && !current
+					current = current || l.Current
+					break
+				}
+			}
+			v.TOC = append(v.TOC, l)
+			walk(p.Children, depth+1)
+		}
+	}
+	walk(toc, 0)
+
+	title := rf.GetTitle()
+	if title == "" {
+		title = strings.TrimSuffix(path.Base(book), path.Ext(book))
+	}
+	h.render(c, http.StatusOK, "reader.html", &page{Title: title, Reader: &v}, time.Time{})
+}
+
+// GetResource serves the file name of the archive of book, such as the
+// document of a chapter or one of its images.
+func (h *webHandler) GetResource(c *gin.Context, book, name string) {
+	r, err := h.openBook(book)
+	if err != nil {
+		h.notFound(c)
+		return
+	}
+	defer r.release()
+
+	name = strings.TrimPrefix(path.Clean(name), "/")
+	f, err := r.Open(name)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	body, err := io.ReadAll(f)
+	if err != nil {
+		log.Printf("web epub read err: %s", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	rf := r.Rootfiles[0]
+	for i := range rf.Manifest.Items {
+		if item := &rf.Manifest.Items[i]; rf.ItemPath(item) == name && item.MediaType != "" {
+			contentType = item.MediaType
+		}
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Security-Policy", contentPolicy)
+	c.Header("X-Content-Type-Options", "nosniff")
+	httpcache.Write(c, contentType, body, r.file.ModTime)
+}
+
+// PostPosition saves where the user stopped reading book, sent as JSON by
+// the reader script.
+func (h *webHandler) PostPosition(c *gin.Context, book string) {
+	if h.positions == nil || h.storage.PathType(book) != storage.PathTypeFile {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	// requiring JSON keeps other sites from posting forms here
+	if storage.MediaType(c.ContentType()) != "application/json" {
+		c.Status(http.StatusUnsupportedMediaType)
+		return
+	}
+	var p users.Position
+	if err := json.NewDecoder(io.LimitReader(c.Request.Body, 1<<10)).Decode(&p); err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	p.Chapter = max(p.Chapter, 0)
+	p.Progress = min(max(p.Progress, 0), 1)
+	if err := h.positions.SetPosition(auth.User(c), book, p); err != nil {
+		log.Printf("web SetPosition err: %s", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,106 @@
+package web
+
+import (
+	"archive/zip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bookarr/storage/dir"
+	"bookarr/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeEPUB writes a book of two chapters to name.
+func writeEPUB(t *testing.T, name string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, file := range []struct{ name, body string }{
+		{"mimetype", epubType},
+		{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`},
+		{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Reader Test</dc:title><dc:identifier id="id">x</dc:identifier></metadata>
+<manifest>
+<item id="one" href="one.xhtml" media-type="application/xhtml+xml"/>
+<item id="two" href="two.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine><itemref idref="one"/><itemref idref="two"/></spine>
+</package>`},
+		{"OEBPS/one.xhtml", `<html><body><p>Chapter one</p></body></html>`},
+		{"OEBPS/two.xhtml", `<html><body><p>Chapter two</p></body></html>`},
+	} {
+		fw, err := w.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(file.body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	root := t.TempDir()
+	writeEPUB(t, filepath.Join(root, "book.epub"))
+	db, err := users.Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+	h := New("/web", dir.NewFileStore(root), WithPositions(db))
+	r := gin.New()
+	r.GET("/web/*path", h.Handler)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/web/book.epub/read?chapter=1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("reader page = %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `/web/book.epub/read/OEBPS/two.xhtml`) || !strings.Contains(body, "Reader Test") {
+		t.Errorf("reader page does not show chapter two:\n%s", body)
+	}
+	if _, ok, err := db.Position("", "/book.epub"); err != nil || ok {
+		t.Errorf("GET saved a position: %v, %v", ok, err)
+	}
+
+	for range 2 {
+		w = get("/web/book.epub/read/OEBPS/one.xhtml")
+		if w.Code != http.StatusOK || w.Body.String() != `<html><body><p>Chapter one</p></body></html>` {
+			t.Fatalf("chapter = %d %q", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/xhtml+xml" {
+			t.Errorf("Content-Type = %q, want application/xhtml+xml", got)
+		}
+		if got := w.Header().Get("Content-Security-Policy"); got != contentPolicy {
+			t.Errorf("Content-Security-Policy = %q, want %q", got, contentPolicy)
+		}
+	}
+	if n := len(h.books.books); n != 1 {
+		t.Errorf("%d archives open, want the book opened once", n)
+	}
+
+	if w = get("/web/book.epub/read/OEBPS/missing.xhtml"); w.Code != http.StatusNotFound {
+		t.Errorf("missing resource = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,211 @@
+// Paginates the chapter shown by the reader page with CSS columns, applies
+// the font size and theme settings, and saves where the user stops reading.
+// Without this script, chapters are shown scrolling.
+(function () {
+  'use strict';
+
+  var body = document.body;
+  var frame = document.getElementById('content');
+  var spine = JSON.parse(document.getElementById('spine').textContent);
+  var chapter = Number(body.dataset.chapter);
+  var progress = Number(body.dataset.progress) || 0;
+  var gap = 48;
+  var page = 0;
+  var pages = 1;
+
+  var themes = {
+    light: { bg: '#fff', fg: '#222' },
+    sepia: { bg: '#f4ecd8', fg: '#5b4636' },
+    dark: { bg: '#1e1e1e', fg: '#ddd' }
+  };
+  var settingsKey = 'bookarr.reader';
+  var settings = { fontSize: 100, theme: 'light' };
+  try {
+    Object.assign(settings, JSON.parse(localStorage.getItem(settingsKey)));
+  } catch (e) {}
+
+  function saveSettings() {
+    try {
+      localStorage.setItem(settingsKey, JSON.stringify(settings));
+    } catch (e) {}
+  }
+
+  function doc() {
+    return frame.contentDocument;
+  }
+
+  // layout splits the chapter in columns the size of the frame, each one a
+  // page.
+  function layout() {
+    var d = doc();
+    if (!d || !d.documentElement) {
+      return;
+    }
+    var theme = themes[settings.theme] || themes.light;
+    var style = d.getElementById('bookarr-reader');
+    if (!style) {
+      style = d.createElement('style');
+      style.id = 'bookarr-reader';
+      (d.head || d.documentElement).appendChild(style);
+    }
+    var h = frame.clientHeight;
+    style.textContent =
+      'html { height: ' + h + 'px; margin: 0; padding: 0 ' + gap / 2 + 'px; box-sizing: border-box;' +
+      ' column-width: ' + (frame.clientWidth - gap) + 'px; column-gap: ' + gap + 'px; column-fill: auto;' +
+      ' overflow: hidden; font-size: ' + settings.fontSize + '%;' +
+      ' background: ' + theme.bg + '; color: ' + theme.fg + '; }' +
+      'body { margin: 0; padding: 1em 0; background: transparent; color: inherit; }' +
+      'img, svg, video { max-width: 100%; max-height: ' + (h - 48) + 'px; object-fit: contain; }' +
+      'a { color: inherit; }';
+    body.classList.remove('light', 'sepia', 'dark');
+    body.classList.add(settings.theme);
+
+    var root = d.scrollingElement || d.documentElement;
+    pages = Math.max(1, Math.ceil((root.scrollWidth - 1) / frame.clientWidth));
+  }
+
+  function show(n) {
+    page = Math.min(Math.max(n, 0), pages - 1);
+    var d = doc();
+    (d.scrollingElement || d.documentElement).scrollLeft = page * frame.clientWidth;
+    document.getElementById('where').textContent =
+      'Chapter ' + (chapter + 1) + ' of ' + spine.length + ' · page ' + (page + 1) + ' of ' + pages;
+    progress = page / pages;
+    savePosition();
+  }
+
+  var timer;
+  function savePosition() {
+    if (!body.dataset.position) {
+      return;
+    }
+    clearTimeout(timer);
+    timer = setTimeout(function () {
+      fetch(body.dataset.position, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ chapter: chapter, progress: progress })
+      });
+    }, 1000);
+  }
+
+  function next() {
+    if (page < pages - 1) {
+      show(page + 1);
+    } else if (body.dataset.next) {
+      location.href = body.dataset.next;
+    }
+  }
+
+  function prev() {
+    if (page > 0) {
+      show(page - 1);
+    } else if (body.dataset.prev) {
+      location.href = body.dataset.prev + '&end=1';
+    }
+  }
+
+  // pageOf returns the page showing the element with id.
+  function pageOf(id) {
+    var el = id && doc().getElementById(decodeURIComponent(id));
+    if (!el) {
+      return -1;
+    }
+    var root = doc().scrollingElement || doc().documentElement;
+    return Math.floor((el.getBoundingClientRect().left + root.scrollLeft) / frame.clientWidth);
+  }
+
+  // follow opens the chapter a link of the book leads to in the reader.
+  function follow(a) {
+    var url = new URL(a.href, frame.contentWindow.location.href);
+    var n = spine.indexOf(url.pathname);
+    if (url.origin !== location.origin || n < 0) {
+      window.open(url.href, '_blank', 'noopener');
+      return;
+    }
+    if (n === chapter) {
+      show(pageOf(url.hash.slice(1)));
+      return;
+    }
+    var q = new URLSearchParams({ chapter: n });
+    if (url.hash) {
+      q.set('anchor', decodeURIComponent(url.hash.slice(1)));
+    }
+    location.href = location.pathname + '?' + q;
+  }
+
+  function key(e) {
+    if (e.key === 'ArrowRight' || e.key === 'PageDown' || e.key === ' ') {
+      next();
+    } else if (e.key === 'ArrowLeft' || e.key === 'PageUp') {
+      prev();
+    } else {
+      return;
+    }
+    e.preventDefault();
+  }
+
+  function loaded() {
+    layout();
+    var d = doc();
+    d.addEventListener('keydown', key);
+    d.addEventListener('click', function (e) {
+      var a = e.target.closest && e.target.closest('a[href]');
+      if (a) {
+        e.preventDefault();
+        follow(a);
+        return;
+      }
+      var x = e.clientX / frame.clientWidth;
+      if (x < 1 / 3) {
+        prev();
+      } else if (x > 2 / 3) {
+        next();
+      }
+    });
+
+    var at = pageOf(new URL(frame.src, location.href).hash.slice(1));
+    if (at < 0 && new URLSearchParams(location.search).has('end')) {
+      at = pages - 1;
+    } else if (at < 0) {
+      at = Math.floor(progress * pages);
+    }
+    show(at);
+  }
+
+  var settingsForm = document.querySelector('.settings');
+  var themeSelect = settingsForm.querySelector('select');
+  settingsForm.hidden = false;
+  themeSelect.value = settings.theme;
+  themeSelect.addEventListener('change', function () {
+    settings.theme = themeSelect.value;
+    saveSettings();
+    relayout();
+  });
+  settingsForm.querySelectorAll('[data-font]').forEach(function (b) {
+    b.addEventListener('click', function () {
+      settings.fontSize = Math.min(Math.max(settings.fontSize + Number(b.dataset.font), 50), 250);
+      saveSettings();
+      relayout();
+    });
+  });
+
+  // relayout paginates again, keeping the reading position.
+  function relayout() {
+    var kept = progress;
+    layout();
+    show(Math.floor(kept * pages));
+  }
+
+  var resizing;
+  window.addEventListener('resize', function () {
+    clearTimeout(resizing);
+    resizing = setTimeout(relayout, 200);
+  });
+  document.addEventListener('keydown', key);
+
+  if (doc() && doc().readyState === 'complete' && doc().URL !== 'about:blank') {
+    loaded();
+  }
+  frame.addEventListener('load', loaded);
+})();
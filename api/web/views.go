@@ -0,0 +1,211 @@
+package web
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"bookarr/storage"
+
+	"golang.org/x/net/html"
+)
+
+// page is the data the templates are filled with. Each page uses the
+// fields it needs.
+type page struct {
+	Title string
+	// Base and Static are the addresses of the home page and the assets.
+	Base   string
+	Static string
+	// Views lead to the virtual views in the navigation bar.
+	Views  []link
+	Crumbs []link
+	Query  string
+
+	Folders []link
+	Books   []bookView
+	Book    *bookView
+	Reader  *readerView
+	Groups  []link
+	Sorts   []link
+
+	Total          int
+	PageNum, Pages int
+	Prev, Next     string
+}
+
+// link is an anchor of a page, with the number of books behind it when it
+// leads to a list.
+type link struct {
+	Title   string
+	Href    string
+	Count   int
+	Current bool
+}
+
+// bookView is a book as the pages show it.
+type bookView struct {
+	Title       string
+	Href        string
+	Authors     []link
+	Series      *link
+	SeriesIndex string
+	Cover       string
+	Thumbnail   string
+	Language    string
+	Publisher   string
+	Published   string
+	Tags        []link
+	Identifiers []string
+	Folder      link
+	// Description is split in paragraphs of plain text.
+	Description []string
+	Files       []fileView
+	// Read is the address of the reader of the EPUB edition of the book,
+	// empty when it has none.
+	Read string
+}
+
+// fileView is a download of a book.
+type fileView struct {
+	Label string
+	Href  string
+	Size  string
+}
+
+// newBookView returns the book at p, listed as e.
+func (h *webHandler) newBookView(p string, e storage.Entry) bookView {
+	m := e.Metadata
+	b := bookView{
+		Title:       m.GetTitle(),
+		Href:        h.href(p),
+		Language:    m.GetLanguage(),
+		Publisher:   m.GetPublisher(),
+		Published:   storage.Date(m),
+		Identifiers: storage.Identifiers(m),
+		Description: paragraphs(m.GetDescription()),
+	}
+	if b.Title == "" {
+		b.Title = strings.TrimSuffix(e.Name, path.Ext(e.Name))
+	}
+	dir := path.Dir(p)
+	b.Folder = link{Title: path.Base(dir), Href: h.href(dir)}
+	if dir == "/" {
+		b.Folder.Title = "Library"
+	}
+
+	for _, a := range storage.Authors(m) {
+		b.Authors = append(b.Authors, link{Title: a.Name, Href: h.groupHref("author", a.SortAs)})
+	}
+	if series, idx := storage.Series(m); series != "" {
+		b.Series = &link{Title: series, Href: h.groupHref("series", series)}
+		b.SeriesIndex = idx
+	}
+	for _, s := range storage.Subjects(m) {
+		b.Tags = append(b.Tags, link{Title: s.Label, Href: h.groupHref("subject", s.Label)})
+	}
+	if m.HasCover() {
+		b.Cover = h.fileHref(p, "cover")
+	}
+	if m.HasThumbnail() {
+		b.Thumbnail = h.fileHref(p, "thumbnail")
+	} else {
+		b.Thumbnail = b.Cover
+	}
+
+	for _, f := range e.Files {
+		b.Files = append(b.Files, fileView{Label: formatLabel(f.Name), Href: h.fileHref(dir, f.Name), Size: size(f.Length)})
+		if b.Read == "" && storage.MediaType(f.Type) == epubType {
+			b.Read = h.href(path.Join(dir, f.Name), readPath)
+		}
+	}
+	if am, ok := m.(storage.AudioMetadata); ok && len(e.Files) == 0 {
+		for _, t := range am.GetTracks() {
+			label := t.Title
+			if label == "" {
+				label = formatLabel(t.Name)
+			}
+			b.Files = append(b.Files, fileView{Label: label, Href: h.fileHref(p, t.Name), Size: size(t.ContentLength)})
+		}
+	}
+	return b
+}
+
+// formatLabel names the format of a file by its extension, e.g. "EPUB".
+func formatLabel(name string) string {
+	if ext := strings.TrimPrefix(path.Ext(name), "."); ext != "" {
+		return strings.ToUpper(ext)
+	}
+	return "Download"
+}
+
+// size returns n bytes in a unit readable by people.
+func size(n int64) string {
+	switch {
+	case n <= 0:
+		return ""
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.0f KB", float64(n)/(1<<10))
+	case n < 1<<30:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+}
+
+// paragraphs returns the text of a description split in paragraphs. Markup
+// of HTML descriptions is dropped, with the content of scripts and styles,
+// so it is shown as plain text.
+func paragraphs(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	if s[0] != '<' {
+		var out []string
+		for _, p := range strings.Split(s, "\n\n") {
+			if p = strings.Join(strings.Fields(p), " "); p != "" {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+
+	var out []string
+	var cur strings.Builder
+	flush := func() {
+		if p := strings.Join(strings.Fields(cur.String()), " "); p != "" {
+			out = append(out, p)
+		}
+		cur.Reset()
+	}
+	z := html.NewTokenizer(strings.NewReader(s))
+	// skip is the depth of script and style elements, whose text is not
+	// part of the description
+	skip := 0
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			flush()
+			return out
+		case html.TextToken:
+			if skip == 0 {
+				cur.Write(z.Text())
+			}
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script", "style":
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+			case "p", "br", "div", "li", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote":
+				flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Package web provides a http handler serving the library as HTML pages, so
+it can be browsed, searched, downloaded and read from any web browser. The
+pages are rendered on the server from embedded templates and need no
+JavaScript; the EPUB reader uses it to paginate chapters, and shows them
+scrolling without it.
+*/
+package web
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"bookarr/api/httpcache"
+	"bookarr/api/internal/catalog"
+	"bookarr/storage"
+	"bookarr/storage/acl"
+	"bookarr/storage/index"
+	"bookarr/users"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPageSize is the number of books per page unless configured with
+// WithPageSize.
+const defaultPageSize = 60
+
+// defaultFilesURL is where the OPDS 1 catalog is mounted unless configured
+// with WithFilesURL.
+const defaultFilesURL = "/opds/v1"
+
+const (
+	browsePath = "browse"
+	searchPath = "search"
+	staticPath = "static"
+)
+
+//go:embed templates static
+var files embed.FS
+
+type webHandler struct {
+	baseURL   string
+	filesURL  string
+	storage   storage.Store
+	index     *index.Index
+	pageSize  int
+	acl       *acl.Rules
+	positions *users.DB
+	templates map[string]*template.Template
+	books     *openBooks
+}
+
+// Option configures optional features of the handler.
+type Option func(*webHandler)
+
+// WithIndex searches and browses idx instead of an index of the store built
+// on first use, so the caller can share it and keep it up to date.
+func WithIndex(idx *index.Index) Option {
+	return func(h *webHandler) {
+		h.index = idx
+	}
+}
+
+// WithPageSize sets the number of books per page. Zero disables paging.
+func WithPageSize(n int) Option {
+	return func(h *webHandler) {
+		h.pageSize = n
+	}
+}
+
+// WithFilesURL sets where the OPDS 1 catalog of the same store is mounted.
+// Books and covers are downloaded from there, so conversions work the same
+// as in the catalogs.
+func WithFilesURL(u string) Option {
+	return func(h *webHandler) {
+		h.filesURL = u
+	}
+}
+
+// WithACL keeps the folders and books rules deny a user off the pages they
+// browse and out of their search results.
+func WithACL(rules *acl.Rules) Option {
+	return func(h *webHandler) {
+		h.acl = rules
+	}
+}
+
+func New(baseURL string, storage storage.Store, opts ...Option) *webHandler {
+	h := &webHandler{
+		baseURL:   baseURL,
+		filesURL:  defaultFilesURL,
+		storage:   storage,
+		pageSize:  defaultPageSize,
+		templates: parseTemplates(),
+		books:     &openBooks{},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.index == nil {
+		h.index = index.New(storage)
+	}
+	return h
+}
+
+// parseTemplates returns every page template combined with the layout, by
+// file name.
+func parseTemplates() map[string]*template.Template {
+	layout := template.Must(template.New("layout.html").ParseFS(files, "templates/layout.html"))
+	pages, err := fs.Glob(files, "templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]*template.Template)
+	for _, p := range pages {
+		name := path.Base(p)
+		if name == "layout.html" {
+			continue
+		}
+		out[name] = template.Must(template.Must(layout.Clone()).ParseFS(files, p))
+	}
+	return out
+}
+
+// Handler serves the page of a folder, book, view or search, the reader of
+// an EPUB book, or a static asset of the pages. It also saves the positions
+// posted by the reader.
+func (h *webHandler) Handler(c *gin.Context) {
+	h = h.forRequest(c)
+	urlPath := c.Param("path")
+	if urlPath == "" {
+		urlPath = "/"
+	}
+
+	if c.Request.Method == http.MethodPost {
+		if book, rest, ok := readerPath(urlPath, positionPath); ok && rest == "" {
+			h.PostPosition(c, book)
+			return
+		}
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if book, rest, ok := readerPath(urlPath, readPath); ok {
+		if rest == "" || rest == "/" {
+			h.GetReader(c, book)
+		} else {
+			h.GetResource(c, book, rest)
+		}
+		return
+	}
+
+	if strings.HasPrefix(urlPath, "/"+staticPath+"/") {
+		h.GetStatic(c, strings.TrimPrefix(urlPath, "/"+staticPath+"/"))
+		return
+	}
+	if urlPath == "/"+searchPath {
+		h.GetSearch(c)
+		return
+	}
+	if urlPath == "/"+browsePath || strings.HasPrefix(urlPath, "/"+browsePath+"/") {
+		h.GetBrowse(c, strings.TrimPrefix(urlPath, "/"+browsePath))
+		return
+	}
+
+	switch h.storage.PathType(urlPath) {
+	case storage.PathTypeNavigation, storage.PathTypeAquisition:
+		h.GetFolder(c, urlPath)
+	case storage.PathTypeFile, storage.PathTypeAudiobook:
+		h.GetBook(c, urlPath)
+	default:
+		h.notFound(c)
+	}
+}
+
+// forRequest returns the handler serving the signed in user, which only
+// sees what the access rules allow.
+func (h *webHandler) forRequest(c *gin.Context) *webHandler {
+	r := *h
+	r.storage, r.index = catalog.Scope(c, h.acl, h.storage, h.index)
+	return &r
+}
+
+// GetStatic serves the asset name of the pages.
+func (h *webHandler) GetStatic(c *gin.Context, name string) {
+	body, err := fs.ReadFile(files, path.Join(staticPath, path.Clean("/"+name)))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	httpcache.Write(c, contentType, body, time.Time{})
+}
+
+func (h *webHandler) notFound(c *gin.Context) {
+	h.render(c, http.StatusNotFound, "notfound.html", &page{Title: "Not found"}, time.Time{})
+}
+
+// render serves the page template name filled with p, which last changed
+// at modified.
+func (h *webHandler) render(c *gin.Context, status int, name string, p *page, modified time.Time) {
+	p.Base = h.href("/")
+	p.Static = h.href("/" + staticPath)
+	if p.Views == nil {
+		p.Views = h.viewLinks()
+	}
+
+	// pages defining their whole document, such as the reader, skip the
+	// layout
+	t := h.templates[name]
+	root := "layout.html"
+	if t.Lookup("page") != nil {
+		root = "page"
+	}
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, root, p); err != nil {
+		log.Printf("web %s err: %s", name, err)
+		c.String(http.StatusInternalServerError, "internal error")
+		return
+	}
+	if status != http.StatusOK {
+		c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+		return
+	}
+	httpcache.Write(c, "text/html; charset=utf-8", buf.Bytes(), modified)
+}
+
+// href returns the address of the page at p.
+func (h *webHandler) href(p string, elem ...string) string {
+	u := &url.URL{Path: h.baseURL}
+	return u.JoinPath(append([]string{p}, elem...)...).String()
+}
+
+// groupHref returns the address of the books of the group key of view. The
+// key is escaped as a single segment, since names such as "AC/DC" hold
+// slashes.
+func (h *webHandler) groupHref(view, key string) string {
+	return h.href(browsePath, view) + "/" + url.PathEscape(key)
+}
+
+// fileHref returns the download address of the file at p, or of one of its
+// resources such as the cover.
+func (h *webHandler) fileHref(p string, elem ...string) string {
+	u := &url.URL{Path: h.filesURL}
+	return u.JoinPath(append([]string{p}, elem...)...).String()
+}
+
+// paginate returns the page of items the page query parameter selects and
+// sets the links to the previous and next pages of p.
+func paginate[T any](h *webHandler, c *gin.Context, p *page, items []T) []T {
+	p.Total = len(items)
+	if h.pageSize <= 0 || len(items) <= h.pageSize {
+		return items
+	}
+	pages := (len(items) + h.pageSize - 1) / h.pageSize
+	n := catalog.QueryInt(c, "page", 1, 1, pages)
+
+	link := func(n int) string {
+		q := c.Request.URL.Query()
+		q.Set("page", strconv.Itoa(n))
+		return c.Request.URL.Path + "?" + q.Encode()
+	}
+	if n > 1 {
+		p.Prev = link(n - 1)
+	}
+	if n < pages {
+		p.Next = link(n + 1)
+	}
+	p.PageNum, p.Pages = n, pages
+	start := (n - 1) * h.pageSize
+	return items[start:min(start+h.pageSize, len(items))]
+}
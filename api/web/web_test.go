@@ -0,0 +1,74 @@
+package web
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParagraphs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"One line.\nSame paragraph.\n\nSecond one.", []string{"One line. Same paragraph.", "Second one."}},
+		{"<p>First &amp; <b>bold</b>.</p><p>Second<br/>third</p>", []string{"First & bold.", "Second", "third"}},
+		{"<div><script>x</script></div>", nil},
+		{"<style>p { color: red }</style><p>Text</p>", []string{"Text"}},
+	}
+	for _, tt := range tests {
+		if got := paragraphs(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("paragraphs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := map[int64]string{0: "", 512: "512 B", 17640: "17 KB", 2316617: "2.2 MB", 3 << 30: "3.0 GB"}
+	for n, want := range tests {
+		if got := size(n); got != want {
+			t.Errorf("size(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	templates := parseTemplates()
+	for _, name := range []string{"folder.html", "book.html", "books.html", "groups.html", "notfound.html", "reader.html"} {
+		if templates[name] == nil {
+			t.Errorf("missing template %s", name)
+		}
+	}
+}
+
+func TestGroupHref(t *testing.T) {
+	h := &webHandler{baseURL: "/web"}
+	for key, want := range map[string]string{
+		"Frank Herbert": "/web/browse/author/Frank%20Herbert",
+		"AC/DC":         "/web/browse/author/AC%2FDC",
+		"50% off?":      "/web/browse/author/50%25%20off%3F",
+	} {
+		if got := h.groupHref("author", key); got != want {
+			t.Errorf("groupHref(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestReaderPath(t *testing.T) {
+	tests := []struct {
+		urlPath, book, rest string
+		ok                  bool
+	}{
+		{"/a/b.epub/read", "/a/b.epub", "", true},
+		{"/a/b.epub/read/OEBPS/ch1.xhtml", "/a/b.epub", "/OEBPS/ch1.xhtml", true},
+		{"/a/B.EPUB/read/x", "/a/B.EPUB", "/x", true},
+		{"/a/b.epub/reader", "", "", false},
+		{"/a/b.epub", "", "", false},
+	}
+	for _, tt := range tests {
+		book, rest, ok := readerPath(tt.urlPath, readPath)
+		if book != tt.book || rest != tt.rest || ok != tt.ok {
+			t.Errorf("readerPath(%q) = %q, %q, %v, want %q, %q, %v", tt.urlPath, book, rest, ok, tt.book, tt.rest, tt.ok)
+		}
+	}
+}
@@ -24,46 +24,157 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
+	"bookarr/api/auth"
+	"bookarr/api/compress"
 	"bookarr/api/opds1"
+	"bookarr/api/opds2"
+	"bookarr/api/rest"
+	"bookarr/api/web"
+	"bookarr/convert"
+	_ "bookarr/convert/fb2epub" // register the FB2 to EPUB conversion
+	_ "bookarr/convert/kepub"   // register the EPUB to KEPUB conversion
+	"bookarr/storage/acl"
+	_ "bookarr/storage/audio" // register the audiobook extractors
+	_ "bookarr/storage/comic" // register the CBZ and CBR extractors
 	"bookarr/storage/dir"
+	_ "bookarr/storage/epub" // register the EPUB extractor
+	_ "bookarr/storage/fb2"  // register the FB2 extractor
+	"bookarr/storage/index"
+	"bookarr/users"
 
 	"github.com/gin-gonic/gin"
 )
 
 var (
-	dirRoot = flag.String("dir", "./books", "A directory with books.")
-	port    = flag.Int("p", 8080, "port to listen on")
+	dirRoot     = flag.String("dir", "./books", "A directory with books.")
+	port        = flag.Int("p", 8080, "port to listen on")
+	cacheDir    = flag.String("cache", defaultCacheDir(), "directory to cache converted books in")
+	dataDir     = flag.String("data", defaultDataDir(), "directory to keep library state in")
+	convBook    = flag.Bool("convert", false, "offer converted downloads (KEPUB for Kobo devices, EPUB for FB2 books)")
+	kepub       = flag.Bool("kepub", false, "deprecated, same as -convert")
+	pageSize    = flag.Int("page-size", 100, "number of entries per feed page, 0 disables paging")
+	reindex     = flag.Duration("reindex", 10*time.Minute, "how often to rescan the library for search")
+	compressMin = flag.Int("compress-min", 1024, "smallest feed in bytes to compress with gzip or zstd, -1 disables compression")
+	aclFile     = flag.String("acl", "", "file of the access rules of users, acl.json in the data directory by default")
 )
 
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "bookarr")
+	}
+	return filepath.Join(dir, "bookarr")
+}
+
+func defaultDataDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(dir, "bookarr")
+}
+
 func main() {
 
 	flag.Parse()
 
+	userDB, err := users.Open(filepath.Join(*dataDir, "users.db"))
+	if err != nil {
+		log.Fatalf("users: %s", err)
+	}
+	defer userDB.Close()
+	if flag.Arg(0) == "user" {
+		if err := userCommand(userDB, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if flag.Arg(0) == "token" {
+		if err := tokenCommand(userDB, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if empty, err := userDB.Empty(); err == nil && empty {
+		log.Printf("no users in %s, the catalog is open to everyone, add one with: bookarr user add <name>", userDB.Path())
+	}
+	tokenIn := auth.Token(userDB)
+	signIn := auth.Basic(userDB, "bookarr")
+
+	if *aclFile == "" {
+		*aclFile = filepath.Join(*dataDir, "acl.json")
+	}
+	rules, err := acl.Load(*aclFile)
+	if err != nil {
+		log.Fatalf("acl: %s", err)
+	}
+	if len(rules.Rules) > 0 {
+		log.Printf("restricting the catalog with %d access rules from %s", len(rules.Rules), *aclFile)
+	}
+
 	// Create context that listens for the interrupt signal from the OS.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	router := gin.Default()
+	if *compressMin >= 0 {
+		router.Use(compress.New(compress.WithMinSize(*compressMin)))
+	}
 
 	// Create a new instance of the OPDS struct.
-	storage := dir.NewFileStore(*dirRoot)
+	storage := dir.NewFileStore(*dirRoot, dir.WithFirstSeenFile(filepath.Join(*dataDir, "first-seen.json")))
 	opdsv1Prefix, _ := url.Parse("/opds/v1")
-	s := opds1.New(opdsv1Prefix.String(), storage)
-
-	router.GET(opdsv1Prefix.JoinPath("*path").String(), s.Handler)
-	router.GET(opdsv1Prefix.String(), s.Handler)
-	router.HEAD("/opds/v1/*all", func(c *gin.Context) {
-		c.Header("Content-Type", "application/atom+xml;profile=opds-catalog;kind=navigation")
-		c.Status(http.StatusOK)
-	})
-	router.HEAD("/opds/v1", func(c *gin.Context) {
-		c.Header("Content-Type", "application/atom+xml;profile=opds-catalog;kind=navigation")
-		c.Status(http.StatusOK)
-	})
+
+	idx := index.New(storage)
+	go idx.Run(ctx, *reindex)
+
+	opts := []opds1.Option{opds1.WithIndex(idx), opds1.WithPageSize(*pageSize), opds1.WithACL(rules)}
+	if *convBook || *kepub {
+		cache, err := convert.NewCache(*cacheDir)
+		if err != nil {
+			log.Fatalf("cache: %s", err)
+		}
+		opts = append(opts, opds1.WithConversions(cache))
+	}
+	s := opds1.New(opdsv1Prefix.String(), storage, opts...)
+
+	router.GET(opdsv1Prefix.JoinPath("*path").String(), tokenIn, signIn, s.Handler)
+	router.GET(opdsv1Prefix.String(), tokenIn, signIn, s.Handler)
+	router.HEAD(opdsv1Prefix.JoinPath("*path").String(), tokenIn, signIn, s.Handler)
+	router.HEAD(opdsv1Prefix.String(), tokenIn, signIn, s.Handler)
+
+	opdsv2Prefix, _ := url.Parse("/opds/v2")
+	s2 := opds2.New(opdsv2Prefix.String(), storage,
+		opds2.WithIndex(idx), opds2.WithPageSize(*pageSize), opds2.WithFilesURL(opdsv1Prefix.String()), opds2.WithACL(rules))
+	router.GET(opdsv2Prefix.JoinPath("*path").String(), tokenIn, signIn, s2.Handler)
+	router.GET(opdsv2Prefix.String(), tokenIn, signIn, s2.Handler)
+	router.HEAD(opdsv2Prefix.JoinPath("*path").String(), tokenIn, signIn, s2.Handler)
+	router.HEAD(opdsv2Prefix.String(), tokenIn, signIn, s2.Handler)
+
+	apiPrefix, _ := url.Parse("/api/v1")
+	s3 := rest.New(apiPrefix.String(), storage, rest.WithIndex(idx), rest.WithACL(rules))
+	router.GET(apiPrefix.JoinPath("*path").String(), signIn, s3.Handler)
+	router.GET(apiPrefix.String(), signIn, s3.Handler)
+	router.HEAD(apiPrefix.JoinPath("*path").String(), signIn, s3.Handler)
+	router.HEAD(apiPrefix.String(), signIn, s3.Handler)
+
+	webPrefix, _ := url.Parse("/web")
+	s4 := web.New(webPrefix.String(), storage,
+		web.WithIndex(idx), web.WithPageSize(*pageSize), web.WithFilesURL(opdsv1Prefix.String()), web.WithACL(rules), web.WithPositions(userDB))
+	router.GET(webPrefix.JoinPath("*path").String(), signIn, s4.Handler)
+	router.GET(webPrefix.String(), signIn, s4.Handler)
+	router.HEAD(webPrefix.JoinPath("*path").String(), signIn, s4.Handler)
+	router.HEAD(webPrefix.String(), signIn, s4.Handler)
+	router.POST(webPrefix.JoinPath("*path").String(), signIn, s4.Handler)
+	router.GET("/", func(c *gin.Context) { c.Redirect(http.StatusFound, webPrefix.JoinPath("/").String()) })
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", *port),
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"bookarr/users"
+
+	"golang.org/x/term"
+)
+
+const userUsage = `usage: bookarr [flags] user <command>
+
+commands:
+  add <name>     create a user, asking for the password
+  remove <name>  delete a user
+  reset <name>   change the password of a user
+  list           print the users`
+
+// userCommand runs the user subcommand with args, managing the accounts
+// of the catalog.
+func userCommand(db *users.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+	cmd, args := args[0], args[1:]
+	if cmd == "list" && len(args) == 0 {
+		list, err := db.List()
+		if err != nil {
+			return err
+		}
+		for _, u := range list {
+			fmt.Printf("%s\tcreated %s\n", u.Name, u.Created.Format("2006-01-02"))
+		}
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New(userUsage)
+	}
+	name := args[0]
+
+	switch cmd {
+	case "add":
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err := db.Add(name, password); err != nil {
+			return err
+		}
+		fmt.Printf("added user %s to %s\n", name, db.Path())
+	case "remove":
+		if err := db.Remove(name); err != nil {
+			return err
+		}
+		fmt.Printf("removed user %s\n", name)
+	case "reset":
+		if _, err := db.Get(name); err != nil {
+			return err
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err := db.SetPassword(name, password); err != nil {
+			return err
+		}
+		fmt.Printf("changed the password of %s\n", name)
+	default:
+		return errors.New(userUsage)
+	}
+	return nil
+}
+
+const tokenUsage = `usage: bookarr [flags] token <command>
+
+commands:
+  add <user> <device>  create a token for a device of a user, printing its catalog URL
+  list [user]          print the tokens, of a user or of everyone
+  revoke <id>          delete a token`
+
+// tokenCommand runs the token subcommand with args, managing the tokens
+// signing in the devices of the users.
+func tokenCommand(db *users.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(tokenUsage)
+	}
+	cmd, args := args[0], args[1:]
+	switch {
+	case cmd == "add" && len(args) == 2:
+		secret, t, err := db.AddToken(args[0], args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("added token %s for %s on %s, the device can read the catalog at:\n", t.ID, t.User, t.Device)
+		fmt.Printf("  /opds/v1/t/%s/\n  /opds/v2/t/%s/\n", secret, secret)
+	case cmd == "list" && len(args) <= 1:
+		user := ""
+		if len(args) == 1 {
+			user = args[0]
+		}
+		list, err := db.Tokens(user)
+		if err != nil {
+			return err
+		}
+		for _, t := range list {
+			lastUsed := "never used"
+			if !t.LastUsed.IsZero() {
+				lastUsed = "last used " + t.LastUsed.Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%s\t%s\t%s\tcreated %s\t%s\n", t.ID, t.User, t.Device, t.Created.Format("2006-01-02"), lastUsed)
+		}
+	case cmd == "revoke" && len(args) == 1:
+		if err := db.RevokeToken(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("revoked token %s\n", args[0])
+	default:
+		return errors.New(tokenUsage)
+	}
+	return nil
+}
+
+// readPassword asks for a password twice on a terminal, or reads a line
+// from the standard input of scripts.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	p1, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	p2, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(p1) != string(p2) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(p1), nil
+}
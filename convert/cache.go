@@ -0,0 +1,83 @@
+package convert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Cache stores conversion results on disk, keyed by a hash of the source and
+// the conversion.
+type Cache struct {
+	dir string
+}
+
+// NewCache returns a cache storing its files in dir, which is created when
+// missing.
+func NewCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Key returns the cache key of converting src with conv. The same book stored
+// twice shares a key, and bumping conv.Version invalidates earlier results.
+func Key(conv Conversion, src io.Reader) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00", conv.Name, conv.Version)
+	if _, err := io.Copy(h, src); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)) + "." + conv.Name, nil
+}
+
+func (c *Cache) path(key string) string {
+	// spread the files over subdirectories to keep directories small
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// Open returns the cached result for key, or an error satisfying
+// os.IsNotExist when there is none.
+func (c *Cache) Open(key string) (*os.File, error) {
+	return os.Open(c.path(key))
+}
+
+// Create returns a writer for the result of key. The result only becomes
+// visible to Open after Commit; Abort discards it.
+func (c *Cache) Create(key string) (*Entry, error) {
+	p := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{File: f, path: p}, nil
+}
+
+// Entry is a cache file being written.
+type Entry struct {
+	*os.File
+	path string
+}
+
+// Commit makes the entry available under its key.
+func (e *Entry) Commit() error {
+	if err := e.File.Close(); err != nil {
+		os.Remove(e.File.Name())
+		return err
+	}
+	return os.Rename(e.File.Name(), e.path)
+}
+
+// Abort removes the partially written entry.
+func (e *Entry) Abort() {
+	e.File.Close()
+	os.Remove(e.File.Name())
+}
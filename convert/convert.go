@@ -0,0 +1,86 @@
+/*
+Package convert provides on-the-fly conversion of books to other formats and a
+disk cache for the results. Converters register themselves from the init
+function of their package, in the same way as storage formats.
+*/
+package convert
+
+import (
+	"io"
+	"mime"
+	"sync"
+)
+
+// Converter turns a book into another format.
+type Converter interface {
+	// Convert writes the converted form of src, which is size bytes long,
+	// to dst.
+	Convert(dst io.Writer, src io.ReaderAt, size int64) error
+}
+
+// Conversion describes a registered converter.
+type Conversion struct {
+	// Name identifies the conversion in URLs and cache keys, e.g. "kepub".
+	Name string
+	// Title is shown to users on acquisition links.
+	Title string
+	// From and To are the source and target content types.
+	From string
+	To   string
+	// Extension is appended to the base name of the source file to build
+	// the download file name, e.g. ".kepub.epub".
+	Extension string
+	// Version is raised whenever the output of the converter changes, so
+	// results cached by an earlier version are not served.
+	Version   int
+	Converter Converter
+}
+
+var registry = struct {
+	sync.RWMutex
+	conversions []Conversion
+}{}
+
+// Register makes a conversion available. It is meant to be called from the
+// init function of the package implementing the converter.
+func Register(c Conversion) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.conversions = append(registry.conversions, c)
+}
+
+// Accepts reports whether the conversion takes books of contentType, which
+// may carry parameters such as charset.
+func (c Conversion) Accepts(contentType string) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	return c.From == contentType
+}
+
+// For returns the conversions that accept the content type from.
+func For(from string) []Conversion {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var out []Conversion
+	for _, c := range registry.conversions {
+		if c.Accepts(from) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// ByName returns the conversion registered as name.
+func ByName(name string) (Conversion, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, c := range registry.conversions {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Conversion{}, false
+}
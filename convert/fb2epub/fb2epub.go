@@ -0,0 +1,489 @@
+/*
+Package fb2epub converts FictionBook 2 documents to EPUB 3. Every top level
+section becomes a chapter, footnote bodies are collected in a notes document
+linked with noteref links, and embedded binaries are stored as images.
+*/
+package fb2epub
+
+import (
+	"archive/zip"
+	"bookarr/convert"
+	"bookarr/storage/epub"
+	"bookarr/storage/fb2"
+	"crypto/sha1"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	convert.Register(convert.Conversion{
+		Name:      "epub",
+		Title:     "EPUB",
+		From:      fb2.MIMEType,
+		To:        epub.MIMEType,
+		Extension: ".epub",
+		Version:   1,
+		Converter: Converter{},
+	})
+}
+
+// Converter converts FB2 to EPUB.
+type Converter struct{}
+
+// Convert implements convert.Converter.
+func (Converter) Convert(dst io.Writer, src io.ReaderAt, size int64) error {
+	book, err := fb2.Parse(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return err
+	}
+	return newBuilder(book).write(dst)
+}
+
+// chapter is one XHTML document of the resulting book.
+type chapter struct {
+	file  string
+	title string
+	// nodes are rendered in order as the content of the document.
+	nodes []*fb2.Node
+	notes bool
+}
+
+// navPoint is an entry of the table of contents.
+type navPoint struct {
+	title    string
+	href     string
+	children []*navPoint
+}
+
+type image struct {
+	id    string
+	file  string
+	mime  string
+	data  []byte
+	cover bool
+}
+
+type builder struct {
+	book     *fb2.Book
+	lang     string
+	chapters []*chapter
+	toc      []*navPoint
+	images   []*image
+	// files maps FB2 ids to the document holding them, and images maps
+	// binary ids to their file name.
+	files     map[string]string
+	imageFile map[string]string
+	autoID    int
+}
+
+func newBuilder(book *fb2.Book) *builder {
+	b := &builder{
+		book:      book,
+		lang:      book.Language,
+		files:     make(map[string]string),
+		imageFile: make(map[string]string),
+	}
+	if b.lang == "" {
+		b.lang = "und"
+	}
+
+	b.planImages()
+	b.planChapters()
+	return b
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+func (b *builder) planImages() {
+	// map iteration order is random, number the images in id order so the
+	// same book always converts to the same package
+	ids := make([]string, 0, len(b.book.Binaries))
+	for id := range b.book.Binaries {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		bin := b.book.Binaries[id]
+		ext, ok := imageExtensions[bin.ContentType]
+		if !ok {
+			continue
+		}
+		name := unsafeName.ReplaceAllString(strings.TrimSuffix(id, ext), "_")
+		file := fmt.Sprintf("%s-%d%s", name, len(b.images), ext)
+		b.imageFile[id] = file
+		img := &image{
+			id:    fmt.Sprintf("img%d", len(b.images)),
+			file:  file,
+			mime:  bin.ContentType,
+			data:  bin.Data,
+			cover: id == b.book.Cover,
+		}
+		if img.cover {
+			img.id = "cover-image"
+		}
+		b.images = append(b.images, img)
+	}
+}
+
+// isNotes reports whether body holds footnotes rather than main text.
+func isNotes(i int, body *fb2.Node) bool {
+	name := body.Attr["name"]
+	return i > 0 && (name == "notes" || name == "comments" || name == "footnotes")
+}
+
+func (b *builder) planChapters() {
+	if _, ok := b.imageFile[b.book.Cover]; ok {
+		b.chapters = append(b.chapters, &chapter{file: "cover.xhtml", title: "Cover"})
+	}
+
+	var notes *chapter
+	for i, body := range b.book.Bodies {
+		if isNotes(i, body) {
+			if notes == nil {
+				notes = &chapter{file: "notes.xhtml", title: "Notes", notes: true}
+			}
+			notes.nodes = append(notes.nodes, body)
+			b.collectIDs(body, notes.file)
+			continue
+		}
+
+		var intro []*fb2.Node
+		for _, n := range body.Children {
+			if n.Name != "section" {
+				if n.Name != "" {
+					intro = append(intro, n)
+				}
+				continue
+			}
+			c := &chapter{
+				file:  fmt.Sprintf("chapter%03d.xhtml", len(b.toc)+1),
+				title: n.Child("title").Content(),
+				nodes: []*fb2.Node{n},
+			}
+			if c.title == "" {
+				c.title = fmt.Sprintf("Chapter %d", len(b.toc)+1)
+			}
+			b.collectIDs(n, c.file)
+			b.chapters = append(b.chapters, c)
+			b.toc = append(b.toc, b.navPoints(n, c.file, c.title))
+		}
+
+		if len(intro) > 0 {
+			c := &chapter{file: fmt.Sprintf("body%d.xhtml", i), title: b.book.Title, nodes: intro}
+			for _, n := range intro {
+				b.collectIDs(n, c.file)
+			}
+			// the title page goes before the chapters of its body
+			pos := len(b.chapters) - countSections(body)
+			b.chapters = append(b.chapters[:pos], append([]*chapter{c}, b.chapters[pos:]...)...)
+		}
+	}
+
+	if notes != nil {
+		b.chapters = append(b.chapters, notes)
+		b.toc = append(b.toc, &navPoint{title: notes.title, href: notes.file})
+	}
+}
+
+func countSections(body *fb2.Node) int {
+	return len(body.All("section"))
+}
+
+func (b *builder) collectIDs(n *fb2.Node, file string) {
+	if id := n.Attr["id"]; id != "" {
+		b.files[id] = file
+	}
+	for _, c := range n.Children {
+		b.collectIDs(c, file)
+	}
+}
+
+// sectionID returns the id of a section, assigning one when it has none so
+// the table of contents can point to it.
+func (b *builder) sectionID(n *fb2.Node) string {
+	if n.Attr["id"] == "" {
+		b.autoID++
+		n.Attr["id"] = fmt.Sprintf("sect%d", b.autoID)
+	}
+	return n.Attr["id"]
+}
+
+func (b *builder) navPoints(section *fb2.Node, file, title string) *navPoint {
+	p := &navPoint{title: title, href: file}
+	for _, sub := range section.All("section") {
+		t := sub.Child("title").Content()
+		if t == "" {
+			continue
+		}
+		p.children = append(p.children, b.navPoints(sub, file+"#"+b.sectionID(sub), t))
+	}
+	return p
+}
+
+func (b *builder) write(dst io.Writer) error {
+	w := zip.NewWriter(dst)
+
+	mt, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mt, epub.MIMEType); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name    string
+		content func() []byte
+	}{
+		{"META-INF/container.xml", func() []byte { return []byte(containerXML) }},
+		{"OEBPS/content.opf", b.packageDocument},
+		{"OEBPS/nav.xhtml", b.navDocument},
+		{"OEBPS/toc.ncx", b.ncxDocument},
+		{"OEBPS/style.css", func() []byte { return []byte(styleCSS) }},
+	}
+	for _, c := range b.chapters {
+		c := c
+		files = append(files, struct {
+			name    string
+			content func() []byte
+		}{"OEBPS/text/" + c.file, func() []byte { return b.chapterDocument(c) }})
+	}
+
+	for _, f := range files {
+		fw, err := w.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.content()); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range b.images {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: "OEBPS/images/" + img.file, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(img.data); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+const containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const styleCSS = `body { margin: 0 1em; }
+h1, h2, h3, h4, h5, h6 { text-align: center; }
+p { margin: 0; text-indent: 1.5em; text-align: justify; }
+p.subtitle, p.text-author, p.date { text-indent: 0; text-align: right; font-style: italic; }
+p.subtitle { text-align: center; font-weight: bold; }
+p.empty-line { text-indent: 0; }
+blockquote.epigraph { margin: 1em 0 1em 30%; }
+blockquote.cite { margin: 1em 2em; }
+div.poem { margin: 1em 2em; }
+div.stanza { margin: 0.5em 0; }
+p.v { text-indent: 0; text-align: left; }
+div.image { text-align: center; margin: 1em 0; }
+div.image img, img.cover { max-width: 100%; }
+aside { margin: 0.5em 0; }
+`
+
+// identifier returns the document id, or a name based UUID derived from the
+// title and authors so repeated conversions get the same identifier.
+func (b *builder) identifier() string {
+	if b.book.ID != "" {
+		return b.book.ID
+	}
+	h := sha1.New()
+	io.WriteString(h, b.book.Title)
+	for _, a := range b.book.Authors {
+		io.WriteString(h, a.Name())
+	}
+	s := h.Sum(nil)
+	s[6] = s[6]&0x0f | 0x50
+	s[8] = s[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", s[0:4], s[4:6], s[6:8], s[8:10], s[10:16])
+}
+
+var w3cDate = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?$`)
+
+// epoch is the modification date of books that do not tell theirs.
+var epoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// modified returns the date the source document was last edited, so the
+// same document always converts to the same bytes.
+func (b *builder) modified() time.Time {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(b.book.Modified)); err == nil {
+			return t
+		}
+	}
+	return epoch
+}
+
+func esc(s string) string {
+	return html.EscapeString(s)
+}
+
+func (b *builder) packageDocument() []byte {
+	book := b.book
+	var s strings.Builder
+
+	fmt.Fprintf(&s, `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid" xml:lang="%s">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="bookid">%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>%s</dc:language>
+`, esc(b.lang), esc(b.identifier()), esc(book.Title), esc(b.lang))
+
+	creator := func(i int, a fb2.Author, role string) {
+		id := fmt.Sprintf("%s%d", role, i)
+		fmt.Fprintf(&s, "    <dc:creator id=\"%s\">%s</dc:creator>\n", id, esc(a.Name()))
+		fmt.Fprintf(&s, "    <meta refines=\"#%s\" property=\"role\" scheme=\"marc:relators\">%s</meta>\n", id, role)
+		fmt.Fprintf(&s, "    <meta refines=\"#%s\" property=\"file-as\">%s</meta>\n", id, esc(a.SortName()))
+	}
+	for i, a := range book.Authors {
+		creator(i, a, "aut")
+	}
+	for i, a := range book.Translators {
+		creator(i, a, "trl")
+	}
+	for _, g := range book.Genres {
+		fmt.Fprintf(&s, "    <dc:subject>%s</dc:subject>\n", esc(g))
+	}
+	if d := book.Annotation.Content(); d != "" {
+		fmt.Fprintf(&s, "    <dc:description>%s</dc:description>\n", esc(d))
+	}
+	if book.Publisher != "" {
+		fmt.Fprintf(&s, "    <dc:publisher>%s</dc:publisher>\n", esc(book.Publisher))
+	}
+	if w3cDate.MatchString(book.Date) {
+		fmt.Fprintf(&s, "    <dc:date>%s</dc:date>\n", book.Date)
+	}
+	if book.ISBN != "" {
+		fmt.Fprintf(&s, "    <dc:identifier>urn:isbn:%s</dc:identifier>\n", esc(book.ISBN))
+	}
+	if book.SequenceName != "" {
+		fmt.Fprintf(&s, "    <meta property=\"belongs-to-collection\" id=\"series\">%s</meta>\n", esc(book.SequenceName))
+		fmt.Fprintf(&s, "    <meta refines=\"#series\" property=\"collection-type\">series</meta>\n")
+		fmt.Fprintf(&s, "    <meta name=\"calibre:series\" content=\"%s\"/>\n", esc(book.SequenceName))
+		if book.SequenceNumber != "" {
+			fmt.Fprintf(&s, "    <meta refines=\"#series\" property=\"group-position\">%s</meta>\n", esc(book.SequenceNumber))
+			fmt.Fprintf(&s, "    <meta name=\"calibre:series_index\" content=\"%s\"/>\n", esc(book.SequenceNumber))
+		}
+	}
+	for _, img := range b.images {
+		if img.cover {
+			fmt.Fprintf(&s, "    <meta name=\"cover\" content=\"%s\"/>\n", img.id)
+		}
+	}
+	fmt.Fprintf(&s, "    <meta property=\"dcterms:modified\">%s</meta>\n", b.modified().Format("2006-01-02T15:04:05Z"))
+	s.WriteString("  </metadata>\n  <manifest>\n")
+
+	s.WriteString(`    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+`)
+	for i, c := range b.chapters {
+		fmt.Fprintf(&s, "    <item id=\"doc%d\" href=\"text/%s\" media-type=\"application/xhtml+xml\"/>\n", i, c.file)
+	}
+	for _, img := range b.images {
+		props := ""
+		if img.cover {
+			props = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&s, "    <item id=\"%s\" href=\"images/%s\" media-type=\"%s\"%s/>\n", img.id, img.file, img.mime, props)
+	}
+
+	s.WriteString("  </manifest>\n  <spine toc=\"ncx\">\n")
+	for i, c := range b.chapters {
+		linear := ""
+		if c.notes {
+			linear = ` linear="no"`
+		}
+		fmt.Fprintf(&s, "    <itemref idref=\"doc%d\"%s/>\n", i, linear)
+	}
+	s.WriteString("  </spine>\n</package>\n")
+	return []byte(s.String())
+}
+
+func (b *builder) navDocument() []byte {
+	var s strings.Builder
+	fmt.Fprintf(&s, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%[1]s" lang="%[1]s">
+<head><meta charset="UTF-8"/><title>%[2]s</title></head>
+<body>
+<nav epub:type="toc" id="toc"><h1>%[2]s</h1>
+`, esc(b.lang), esc(b.book.Title))
+
+	var list func([]*navPoint)
+	list = func(points []*navPoint) {
+		s.WriteString("<ol>\n")
+		for _, p := range points {
+			fmt.Fprintf(&s, "<li><a href=\"text/%s\">%s</a>", esc(p.href), esc(p.title))
+			if len(p.children) > 0 {
+				list(p.children)
+			}
+			s.WriteString("</li>\n")
+		}
+		s.WriteString("</ol>\n")
+	}
+	points := b.toc
+	if len(points) == 0 {
+		// books without sections still need a non-empty navigation list
+		for _, c := range b.chapters {
+			points = append(points, &navPoint{title: c.title, href: c.file})
+		}
+	}
+	list(points)
+
+	s.WriteString("</nav>\n</body>\n</html>\n")
+	return []byte(s.String())
+}
+
+// ncxDocument writes the EPUB 2 table of contents for older readers.
+func (b *builder) ncxDocument() []byte {
+	var s strings.Builder
+	fmt.Fprintf(&s, `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head><meta name="dtb:uid" content="%s"/></head>
+<docTitle><text>%s</text></docTitle>
+<navMap>
+`, esc(b.identifier()), esc(b.book.Title))
+
+	order := 0
+	var points func([]*navPoint)
+	points = func(list []*navPoint) {
+		for _, p := range list {
+			order++
+			fmt.Fprintf(&s, "<navPoint id=\"np%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"text/%s\"/>\n",
+				order, order, esc(p.title), esc(p.href))
+			points(p.children)
+			s.WriteString("</navPoint>\n")
+		}
+	}
+	points(b.toc)
+
+	s.WriteString("</navMap>\n</ncx>\n")
+	return []byte(s.String())
+}
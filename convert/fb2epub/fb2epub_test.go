@@ -0,0 +1,143 @@
+package fb2epub
+
+import (
+	"archive/zip"
+	"bookarr/storage/fb2"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+const book = `<?xml version="1.0" encoding="UTF-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink">
+<description><title-info>
+<genre>sf</genre>
+<author><first-name>Ivan</first-name><last-name>Petrov</last-name></author>
+<book-title>Test &amp; Book</book-title>
+<lang>ru</lang>
+<sequence name="Series" number="2"/>
+<coverpage><image l:href="#cover.png"/></coverpage>
+</title-info>
+<document-info><date value="2010-06-07">7 June 2010</date></document-info>
+</description>
+<body>
+<title><p>Test Book</p></title>
+<section id="one"><title><p>One</p></title><p>Text<a l:href="#n1" type="note">[1]</a>.</p>
+<section><title><p>Nested</p></title><p><emphasis>More</emphasis></p></section>
+</section>
+<section><title><p>Two</p></title><p>See <a l:href="#one">one</a>.</p><image l:href="#pic.gif" alt="Map"/></section>
+</body>
+<body name="notes"><section id="n1"><title><p>1</p></title><p>A note.</p></section></body>
+<binary id="cover.png" content-type="image/png">iVBORw0KGgo=</binary>
+<binary id="pic.gif" content-type="image/gif">R0lGODlh</binary>
+</FictionBook>`
+
+func TestConvert(t *testing.T) {
+	var out bytes.Buffer
+	if err := (Converter{}).Convert(&out, strings.NewReader(book), int64(len(book))); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.File[0].Name != "mimetype" || z.File[0].Method != zip.Store {
+		t.Errorf("first entry = %s, want stored mimetype", z.File[0].Name)
+	}
+
+	files := make(map[string]string)
+	for _, f := range z.File {
+		r, _ := f.Open()
+		b, _ := io.ReadAll(r)
+		files[f.Name] = string(b)
+	}
+
+	for name, want := range map[string][]string{
+		"OEBPS/content.opf": {
+			`<dc:title>Test &amp; Book</dc:title>`,
+			`<dc:language>ru</dc:language>`,
+			`<meta refines="#aut0" property="file-as">Petrov, Ivan</meta>`,
+			`<meta refines="#series" property="group-position">2</meta>`,
+			`href="images/cover-0.png" media-type="image/png" properties="cover-image"`,
+			`href="images/pic-1.gif" media-type="image/gif"`,
+			`<meta property="dcterms:modified">2010-06-07T00:00:00Z</meta>`,
+			`<itemref idref="doc4" linear="no"/>`,
+		},
+		"OEBPS/nav.xhtml": {
+			`<li><a href="text/chapter001.xhtml">One</a><ol>`,
+			`<a href="text/chapter001.xhtml#sect1">Nested</a>`,
+		},
+		"OEBPS/text/body0.xhtml": {`<h1>Test Book</h1>`},
+		"OEBPS/text/chapter001.xhtml": {
+			`<section id="one">`,
+			`<h1>One</h1>`,
+			`<a href="notes.xhtml#n1" epub:type="noteref">[1]</a>`,
+			`<section id="sect1">`,
+			`<h2>Nested</h2>`,
+			`<p><em>More</em></p>`,
+		},
+		"OEBPS/text/chapter002.xhtml": {
+			`<a href="chapter001.xhtml#one">one</a>`,
+			`<div class="image"><img src="../images/pic-1.gif" alt="Map"/></div>`,
+		},
+		"OEBPS/images/cover-0.png": {"\x89PNG\r\n\x1a\n"},
+		"OEBPS/images/pic-1.gif":   {"GIF89a"},
+		"OEBPS/text/notes.xhtml":   {`<aside epub:type="footnote" id="n1">`, `<p>A note.</p>`},
+	} {
+		got, ok := files[name]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s = %s\nmissing %s", name, got, w)
+			}
+		}
+	}
+}
+
+func TestConvertStable(t *testing.T) {
+	images := `<binary id="b.png" content-type="image/png">iVBORw0KGgo=</binary>
+<binary id="a.png" content-type="image/png">iVBORw0KGgo=</binary>
+<binary id="c.jpg" content-type="image/jpeg">/9j/</binary>
+</FictionBook>`
+	src := strings.Replace(book, "</FictionBook>", images, 1)
+
+	convert := func() []byte {
+		var out bytes.Buffer
+		if err := (Converter{}).Convert(&out, strings.NewReader(src), int64(len(src))); err != nil {
+			t.Fatal(err)
+		}
+		return out.Bytes()
+	}
+
+	want := convert()
+	for _, img := range []string{"images/a-0.png", "images/b-1.png", "images/c-2.jpg", "images/cover-3.png", "images/pic-4.gif"} {
+		if !bytes.Contains(want, []byte(img)) {
+			t.Errorf("converted book is missing %s", img)
+		}
+	}
+	for range 10 {
+		if got := convert(); !bytes.Equal(got, want) {
+			t.Fatal("conversion changed between runs")
+		}
+	}
+}
+
+func TestModified(t *testing.T) {
+	for date, want := range map[string]string{
+		"2010-06-07":  "2010-06-07T00:00:00Z",
+		" 2010-06 ":   "2010-06-01T00:00:00Z",
+		"2010":        "2010-01-01T00:00:00Z",
+		"7 June 2010": "2000-01-01T00:00:00Z",
+		"":            "2000-01-01T00:00:00Z",
+	} {
+		b := &builder{book: &fb2.Book{Modified: date}}
+		if got := b.modified().Format("2006-01-02T15:04:05Z"); got != want {
+			t.Errorf("modified(%q) = %s, want %s", date, got, want)
+		}
+	}
+}
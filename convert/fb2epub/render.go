@@ -0,0 +1,230 @@
+package fb2epub
+
+import (
+	"bookarr/storage/fb2"
+	"fmt"
+	"strings"
+)
+
+func (b *builder) chapterDocument(c *chapter) []byte {
+	var s strings.Builder
+	fmt.Fprintf(&s, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%[1]s" lang="%[1]s">
+<head><meta charset="UTF-8"/><title>%[2]s</title><link rel="stylesheet" type="text/css" href="../style.css"/></head>
+<body>
+`, esc(b.lang), esc(c.title))
+
+	switch {
+	case c.file == "cover.xhtml":
+		fmt.Fprintf(&s, "<div class=\"image\"><img class=\"cover\" src=\"../images/%s\" alt=\"%s\"/></div>\n",
+			esc(b.imageFile[b.book.Cover]), esc(b.book.Title))
+	case c.notes:
+		for _, body := range c.nodes {
+			b.notes(&s, body)
+		}
+	default:
+		for _, n := range c.nodes {
+			b.block(&s, n, 0)
+		}
+	}
+
+	s.WriteString("</body>\n</html>\n")
+	return []byte(s.String())
+}
+
+// notes writes a notes body, every section becoming a footnote aside that
+// reading systems can show in a popup.
+func (b *builder) notes(s *strings.Builder, body *fb2.Node) {
+	s.WriteString("<section epub:type=\"footnotes\">\n")
+	for _, n := range body.Children {
+		switch n.Name {
+		case "":
+		case "section":
+			fmt.Fprintf(s, "<aside epub:type=\"footnote\"%s>\n", b.idAttr(n))
+			for _, c := range n.Children {
+				if c.Name == "title" {
+					fmt.Fprintf(s, "<p class=\"subtitle\">%s</p>\n", esc(c.Content()))
+					continue
+				}
+				b.block(s, c, 2)
+			}
+			s.WriteString("</aside>\n")
+		default:
+			b.block(s, n, 1)
+		}
+	}
+	s.WriteString("</section>\n")
+}
+
+func (b *builder) idAttr(n *fb2.Node) string {
+	if id := n.Attr["id"]; id != "" {
+		return fmt.Sprintf(` id="%s"`, esc(id))
+	}
+	return ""
+}
+
+// blockClasses maps FictionBook paragraph elements to a styled p element.
+var blockClasses = map[string]string{
+	"subtitle":    "subtitle",
+	"text-author": "text-author",
+	"v":           "v",
+	"date":        "date",
+}
+
+// containerClasses maps FictionBook container elements to a styled element.
+var containerClasses = map[string][2]string{
+	"epigraph":   {"blockquote", "epigraph"},
+	"cite":       {"blockquote", "cite"},
+	"poem":       {"div", "poem"},
+	"stanza":     {"div", "stanza"},
+	"annotation": {"div", "annotation"},
+}
+
+// block writes a block level FictionBook element as XHTML, depth being the
+// nesting level of the enclosing section.
+func (b *builder) block(s *strings.Builder, n *fb2.Node, depth int) {
+	switch n.Name {
+	case "":
+		// white space between blocks
+		return
+	case "section":
+		fmt.Fprintf(s, "<section%s>\n", b.idAttr(n))
+		for _, c := range n.Children {
+			b.block(s, c, depth+1)
+		}
+		s.WriteString("</section>\n")
+	case "title":
+		h := min(max(depth, 1), 6)
+		fmt.Fprintf(s, "<h%d%s>", h, b.idAttr(n))
+		first := true
+		for _, c := range n.Children {
+			switch c.Name {
+			case "p":
+				if !first {
+					s.WriteString("<br/>")
+				}
+				b.inline(s, c.Children)
+				first = false
+			case "empty-line":
+				s.WriteString("<br/>")
+			}
+		}
+		fmt.Fprintf(s, "</h%d>\n", h)
+	case "p":
+		fmt.Fprintf(s, "<p%s>", b.idAttr(n))
+		b.inline(s, n.Children)
+		s.WriteString("</p>\n")
+	case "empty-line":
+		s.WriteString("<p class=\"empty-line\">&#160;</p>\n")
+	case "image":
+		s.WriteString("<div class=\"image\">")
+		b.image(s, n)
+		s.WriteString("</div>\n")
+	case "table":
+		fmt.Fprintf(s, "<table%s>\n", b.idAttr(n))
+		for _, tr := range n.All("tr") {
+			s.WriteString("<tr>")
+			for _, cell := range tr.Children {
+				if cell.Name != "th" && cell.Name != "td" {
+					continue
+				}
+				fmt.Fprintf(s, "<%s>", cell.Name)
+				b.inline(s, cell.Children)
+				fmt.Fprintf(s, "</%s>", cell.Name)
+			}
+			s.WriteString("</tr>\n")
+		}
+		s.WriteString("</table>\n")
+	default:
+		if class, ok := blockClasses[n.Name]; ok {
+			fmt.Fprintf(s, "<p class=\"%s\"%s>", class, b.idAttr(n))
+			b.inline(s, n.Children)
+			s.WriteString("</p>\n")
+			return
+		}
+		if c, ok := containerClasses[n.Name]; ok {
+			fmt.Fprintf(s, "<%s class=\"%s\"%s>\n", c[0], c[1], b.idAttr(n))
+			for _, child := range n.Children {
+				if child.Name == "title" {
+					fmt.Fprintf(s, "<p class=\"subtitle\">%s</p>\n", esc(child.Content()))
+					continue
+				}
+				b.block(s, child, depth)
+			}
+			fmt.Fprintf(s, "</%s>\n", c[0])
+			return
+		}
+		// unknown elements keep their content
+		for _, c := range n.Children {
+			b.block(s, c, depth)
+		}
+	}
+}
+
+// inlineElements maps FictionBook style elements to XHTML.
+var inlineElements = map[string]string{
+	"strong":        "strong",
+	"emphasis":      "em",
+	"strikethrough": "del",
+	"sub":           "sub",
+	"sup":           "sup",
+	"code":          "code",
+	"style":         "span",
+}
+
+func (b *builder) inline(s *strings.Builder, nodes []*fb2.Node) {
+	for _, n := range nodes {
+		switch n.Name {
+		case "":
+			s.WriteString(esc(n.Text))
+		case "a":
+			b.link(s, n)
+		case "image":
+			b.image(s, n)
+		default:
+			tag, ok := inlineElements[n.Name]
+			if !ok {
+				b.inline(s, n.Children)
+				continue
+			}
+			fmt.Fprintf(s, "<%s>", tag)
+			b.inline(s, n.Children)
+			fmt.Fprintf(s, "</%s>", tag)
+		}
+	}
+}
+
+// link writes an a element, pointing internal links at the document that
+// holds their target and marking note references as such.
+func (b *builder) link(s *strings.Builder, n *fb2.Node) {
+	href := n.Href()
+	if id, ok := strings.CutPrefix(href, "#"); ok {
+		file, ok := b.files[id]
+		if !ok {
+			b.inline(s, n.Children)
+			return
+		}
+		href = file + "#" + id
+	}
+
+	noteref := ""
+	if n.Attr["type"] == "note" {
+		noteref = ` epub:type="noteref"`
+	}
+	fmt.Fprintf(s, "<a href=\"%s\"%s>", esc(href), noteref)
+	b.inline(s, n.Children)
+	s.WriteString("</a>")
+}
+
+func (b *builder) image(s *strings.Builder, n *fb2.Node) {
+	file, ok := b.imageFile[strings.TrimPrefix(n.Href(), "#")]
+	if !ok {
+		return
+	}
+	alt := n.Attr["alt"]
+	if alt == "" {
+		alt = n.Attr["title"]
+	}
+	fmt.Fprintf(s, "<img src=\"../images/%s\" alt=\"%s\"/>", esc(file), esc(alt))
+}
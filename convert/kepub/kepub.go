@@ -0,0 +1,311 @@
+/*
+Package kepub converts EPUB books to KEPUB, the flavour of EPUB used by Kobo
+e-readers for pagination, reading statistics and highlights. Every sentence in
+the spine documents is wrapped in a koboSpan and the package document is
+amended to declare its cover image.
+*/
+package kepub
+
+import (
+	"archive/zip"
+	"bookarr/convert"
+	"bookarr/storage/epub"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// MIMEType is the content type of a KEPUB book.
+const MIMEType = "application/kepub+zip"
+
+func init() {
+	convert.Register(convert.Conversion{
+		Name:      "kepub",
+		Title:     "Kobo EPUB",
+		From:      epub.MIMEType,
+		To:        MIMEType,
+		Extension: ".kepub.epub",
+		Version:   1,
+		Converter: Converter{},
+	})
+}
+
+// Converter converts EPUB to KEPUB.
+type Converter struct{}
+
+// Convert implements convert.Converter.
+func (Converter) Convert(dst io.Writer, src io.ReaderAt, size int64) error {
+	book, err := epub.NewReader(src, size)
+	if err != nil {
+		return err
+	}
+	z, err := zip.NewReader(src, size)
+	if err != nil {
+		return err
+	}
+
+	rootfile := book.Rootfiles[0]
+	spine := make(map[string]struct{})
+	for _, itemref := range rootfile.Spine.Itemrefs {
+		if itemref.Item == nil || !isXHTML(itemref.Item.MediaType) {
+			continue
+		}
+		spine[itemPath(rootfile.FullPath, itemref.Item.HREF)] = struct{}{}
+	}
+
+	w := zip.NewWriter(dst)
+
+	// the mimetype file must come first and be stored uncompressed
+	mt, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mt, epub.MIMEType); err != nil {
+		return err
+	}
+
+	for _, f := range z.File {
+		switch {
+		case f.Name == "mimetype":
+			continue
+		case f.Name == rootfile.FullPath:
+			err = rewrite(w, f, func(b []byte) []byte { return fixPackage(b, rootfile) })
+		case inSpine(spine, f.Name):
+			err = rewrite(w, f, addSpans)
+		default:
+			err = copyRaw(w, f)
+		}
+		if err != nil {
+			return fmt.Errorf("kepub: %s: %w", f.Name, err)
+		}
+	}
+	return w.Close()
+}
+
+func inSpine(spine map[string]struct{}, name string) bool {
+	_, ok := spine[name]
+	return ok
+}
+
+func isXHTML(mediaType string) bool {
+	return mediaType == "application/xhtml+xml" || mediaType == "text/html"
+}
+
+// itemPath resolves a manifest href against the package document.
+func itemPath(opf, href string) string {
+	if u, err := url.PathUnescape(href); err == nil {
+		href = u
+	}
+	return path.Join(path.Dir(opf), href)
+}
+
+func copyRaw(w *zip.Writer, f *zip.File) error {
+	r, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	fw, err := w.CreateRaw(&f.FileHeader)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func rewrite(w *zip.Writer, f *zip.File, fn func([]byte) []byte) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	fw, err := w.CreateHeader(&zip.FileHeader{
+		Name:     f.Name,
+		Method:   zip.Deflate,
+		Modified: f.Modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(fn(b))
+	return err
+}
+
+var itemTag = regexp.MustCompile(`<item\s[^>]*>`)
+
+// fixPackage marks the cover image with the EPUB 3 cover-image property,
+// which Kobo uses instead of the EPUB 2 cover meta element.
+func fixPackage(opf []byte, rootfile *epub.Rootfile) []byte {
+	cover := rootfile.CoverItem()
+	if cover == nil {
+		return opf
+	}
+
+	idAttr := regexp.MustCompile(`\sid=["']` + regexp.QuoteMeta(cover.ID) + `["']`)
+	propsAttr := regexp.MustCompile(`\sproperties=["']([^"']*)["']`)
+
+	return itemTag.ReplaceAllFunc(opf, func(tag []byte) []byte {
+		if !idAttr.Match(tag) {
+			return tag
+		}
+		if m := propsAttr.FindSubmatch(tag); m != nil {
+			if bytes.Contains(m[1], []byte("cover-image")) {
+				return tag
+			}
+			return propsAttr.ReplaceAll(tag, []byte(` properties="$1 cover-image"`))
+		}
+
+		end := len(tag) - 1
+		if tag[end-1] == '/' {
+			end--
+		}
+		out := append([]byte{}, tag[:end]...)
+		out = append(out, ` properties="cover-image"`...)
+		return append(out, tag[end:]...)
+	})
+}
+
+// blockElements start a new koboSpan paragraph.
+var blockElements = map[string]struct{}{
+	"p": {}, "div": {}, "li": {}, "blockquote": {}, "td": {}, "th": {},
+	"dt": {}, "dd": {}, "figcaption": {}, "caption": {}, "pre": {},
+	"h1": {}, "h2": {}, "h3": {}, "h4": {}, "h5": {}, "h6": {},
+}
+
+// skipElements never get spans inside them.
+var skipElements = map[string]struct{}{
+	"script": {}, "style": {}, "svg": {}, "math": {}, "title": {},
+}
+
+const (
+	bookColumns = `<div id="book-columns"><div id="book-inner">`
+	styleHacks  = `<style type="text/css" id="kobostylehacks">div#book-inner { margin-top: 0; margin-bottom: 0; }</style>`
+)
+
+// addSpans wraps every sentence of an XHTML document in a koboSpan. The
+// document is tokenized and written back token by token so markup that is
+// not touched is preserved byte for byte.
+func addSpans(doc []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(doc) + len(doc)/4)
+
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	inBody := false
+	skip := 0
+	para, seg := 0, 0
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		// copy before TagName, which lower-cases the token buffer in place
+		raw := append([]byte(nil), z.Raw()...)
+
+		switch tt {
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			out.Write(raw)
+			switch {
+			case tag == "body":
+				inBody = true
+				out.WriteString(bookColumns)
+			case isIn(skipElements, tag):
+				skip++
+			case isIn(blockElements, tag):
+				para++
+				seg = 0
+			}
+			continue
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			switch {
+			case tag == "head":
+				out.WriteString(styleHacks)
+			case tag == "body":
+				out.WriteString("</div></div>")
+				inBody = false
+			case isIn(skipElements, tag) && skip > 0:
+				skip--
+			}
+		case html.TextToken:
+			if inBody && skip == 0 && len(bytes.TrimSpace(raw)) > 0 {
+				if para == 0 {
+					para = 1
+				}
+				seg = writeSpans(&out, raw, para, seg)
+				continue
+			}
+		}
+		out.Write(raw)
+	}
+	return out.Bytes()
+}
+
+func isIn(set map[string]struct{}, tag string) bool {
+	_, ok := set[tag]
+	return ok
+}
+
+// writeSpans writes text split in sentences, each wrapped in a koboSpan, and
+// returns the last segment number used.
+func writeSpans(out *bytes.Buffer, text []byte, para, seg int) int {
+	s := string(text)
+	trimmed := strings.TrimLeft(s, " \t\r\n")
+	out.WriteString(s[:len(s)-len(trimmed)])
+
+	for _, sentence := range splitSentences(trimmed) {
+		seg++
+		fmt.Fprintf(out, `<span class="koboSpan" id="kobo.%d.%d">%s</span>`, para, seg, sentence)
+	}
+	return seg
+}
+
+// splitSentences splits s after sentence ending punctuation that is followed
+// by white space. Closing quotes and brackets stay with their sentence.
+func splitSentences(s string) []string {
+	var out []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if !strings.ContainsRune(".!?", rune(s[i])) {
+			continue
+		}
+
+		j := i + 1
+		for j < len(s) && strings.ContainsRune(`"')]`, rune(s[j])) {
+			j++
+		}
+		if j >= len(s) || !isSpace(s[j]) {
+			continue
+		}
+		for j < len(s) && isSpace(s[j]) {
+			j++
+		}
+		if j < len(s) {
+			out = append(out, s[start:j])
+			start = j
+		}
+		i = j - 1
+	}
+	if start < len(s) {
+		out = append(out, s[start:])
+	}
+	return out
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,176 @@
+package kepub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"bookarr/storage/epub"
+)
+
+func Test_addSpans(t *testing.T) {
+	doc := `<html><head><title>T. One.</title></head><body><h1>Title</h1>` +
+		`<p>First one. Second <em>part</em> "quoted!" Third</p><svg><linearGradient/></svg></body></html>`
+
+	got := string(addSpans([]byte(doc)))
+
+	for _, want := range []string{
+		`<title>T. One.</title><style type="text/css" id="kobostylehacks">`,
+		`<body><div id="book-columns"><div id="book-inner"><h1><span class="koboSpan" id="kobo.1.1">Title</span></h1>`,
+		`<p><span class="koboSpan" id="kobo.2.1">First one. </span><span class="koboSpan" id="kobo.2.2">Second </span>`,
+		`<em><span class="koboSpan" id="kobo.2.3">part</span></em>`,
+		`</em> <span class="koboSpan" id="kobo.2.4">"quoted!" </span><span class="koboSpan" id="kobo.2.5">Third</span>`,
+		`<svg><linearGradient/></svg></div></div></body>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("addSpans() = %s\nmissing %s", got, want)
+		}
+	}
+}
+
+func Test_splitSentences(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"One sentence", []string{"One sentence"}},
+		{"One. Two! Three? Four", []string{"One. ", "Two! ", "Three? ", "Four"}},
+		{`He said "Stop." Then left.`, []string{`He said "Stop." `, "Then left."}},
+		{"(Aside.)  Next", []string{"(Aside.)  ", "Next"}},
+		{"3.14 is pi. e.g.this", []string{"3.14 is pi. ", "e.g.this"}},
+		{"Trailing space. ", []string{"Trailing space. "}},
+	}
+	for _, tt := range tests {
+		if got := splitSentences(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitSentences(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func Test_fixPackage(t *testing.T) {
+	tests := []struct {
+		name  string
+		cover string
+		item  string
+		want  string
+	}{
+		{"no properties", "img", `<item id="img" href="c.jpg" media-type="image/jpeg"/>`,
+			`<item id="img" href="c.jpg" media-type="image/jpeg" properties="cover-image"/>`},
+		{"open tag", "img", `<item id='img' href="c.jpg" media-type="image/jpeg"></item>`,
+			`<item id='img' href="c.jpg" media-type="image/jpeg" properties="cover-image"></item>`},
+		{"other properties", "img", `<item id="img" href="c.svg" media-type="image/svg+xml" properties="svg"/>`,
+			`<item id="img" href="c.svg" media-type="image/svg+xml" properties="svg cover-image"/>`},
+		{"already marked", "img", `<item id="img" href="c.jpg" media-type="image/jpeg" properties="cover-image"/>`,
+			`<item id="img" href="c.jpg" media-type="image/jpeg" properties="cover-image"/>`},
+		{"no cover", "", `<item id="img" href="c.jpg" media-type="image/jpeg"/>`,
+			`<item id="img" href="c.jpg" media-type="image/jpeg"/>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := ""
+			if tt.cover != "" {
+				meta = `<meta name="cover" content="` + tt.cover + `"/>`
+			}
+			opf := `<package xmlns="http://www.idpf.org/2007/opf"><metadata>` + meta + `</metadata>` +
+				`<manifest><item id="text" href="text.xhtml" media-type="application/xhtml+xml"/>` + tt.item + `</manifest></package>`
+
+			rootfile := &epub.Rootfile{}
+			if err := xml.Unmarshal([]byte(opf), &rootfile.Package); err != nil {
+				t.Fatal(err)
+			}
+			got := string(fixPackage([]byte(opf), rootfile))
+			if want := strings.Replace(opf, tt.item, tt.want, 1); got != want {
+				t.Errorf("fixPackage() = %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	files := []struct{ name, body string }{
+		{"mimetype", epub.MIMEType},
+		{"META-INF/container.xml", `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`},
+		{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title>Book</dc:title><dc:identifier id="id">x</dc:identifier><meta name="cover" content="cover"/></metadata>
+<manifest>
+<item id="one" href="text/one.xhtml" media-type="application/xhtml+xml"/>
+<item id="two" href="text/two%20b.xhtml" media-type="application/xhtml+xml"/>
+<item id="cover" href="cover.jpg" media-type="image/jpeg"/>
+<item id="css" href="style.css" media-type="text/css"/>
+</manifest>
+<spine><itemref idref="one"/><itemref idref="two"/></spine>
+</package>`},
+		{"OEBPS/text/one.xhtml", `<html><head><title>One</title></head><body><p>A. B.</p><p>C</p></body></html>`},
+		{"OEBPS/text/two b.xhtml", `<html><head></head><body><h1>Two</h1><div>D! E</div></body></html>`},
+		{"OEBPS/cover.jpg", "\xff\xd8not really"},
+		{"OEBPS/style.css", "p { margin: 0 }"},
+	}
+
+	var in bytes.Buffer
+	zw := zip.NewWriter(&in)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, f.body)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := (Converter{}).Convert(&out, bytes.NewReader(in.Bytes()), int64(in.Len())); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.File[0].Name != "mimetype" || z.File[0].Method != zip.Store {
+		t.Errorf("first entry = %s, want stored mimetype", z.File[0].Name)
+	}
+	got := make(map[string]string)
+	for _, f := range z.File {
+		r, _ := f.Open()
+		b, _ := io.ReadAll(r)
+		got[f.Name] = string(b)
+	}
+
+	for name, want := range map[string][]string{
+		"OEBPS/content.opf": {
+			`<item id="cover" href="cover.jpg" media-type="image/jpeg" properties="cover-image"/>`,
+		},
+		"OEBPS/text/one.xhtml": {
+			`<p><span class="koboSpan" id="kobo.1.1">A. </span><span class="koboSpan" id="kobo.1.2">B.</span></p>`,
+			`<p><span class="koboSpan" id="kobo.2.1">C</span></p>`,
+		},
+		"OEBPS/text/two b.xhtml": {
+			`<h1><span class="koboSpan" id="kobo.1.1">Two</span></h1>`,
+			`<div><span class="koboSpan" id="kobo.2.1">D! </span><span class="koboSpan" id="kobo.2.2">E</span></div>`,
+		},
+	} {
+		for _, w := range want {
+			if !strings.Contains(got[name], w) {
+				t.Errorf("%s = %s\nmissing %s", name, got[name], w)
+			}
+		}
+	}
+	for _, f := range files[3:] {
+		if strings.HasSuffix(f.name, ".xhtml") {
+			continue
+		}
+		if got[f.name] != f.body {
+			t.Errorf("%s = %q, want it copied unchanged", f.name, got[f.name])
+		}
+	}
+}
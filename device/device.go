@@ -0,0 +1,106 @@
+/*
+Package device classifies catalog clients into profiles describing the book
+formats they can open. Profiles are matched on the User-Agent header or picked
+explicitly by name, and are used to order and filter acquisition links.
+*/
+package device
+
+import (
+	"mime"
+	"strings"
+	"sync"
+)
+
+// Profile describes the formats supported by a kind of client.
+type Profile struct {
+	// Name identifies the profile in the profile query parameter.
+	Name  string
+	Title string
+	// UserAgents are substrings of the User-Agent header sent by the client.
+	UserAgents []string
+	// Formats lists the supported content types, most preferred first.
+	Formats []string
+	// Serve maps a content type to the conversion that is served in its
+	// place when the book is downloaded, e.g. EPUB to KEPUB on Kobo.
+	Serve map[string]string
+}
+
+// Rank returns the position of contentType in the preferred formats, or -1
+// when the client does not support it. Parameters such as charset are
+// ignored.
+func (p *Profile) Rank(contentType string) int {
+	contentType = mediaType(contentType)
+	for i, f := range p.Formats {
+		if f == contentType {
+			return i
+		}
+	}
+	return -1
+}
+
+// Conversion returns the name of the conversion to serve instead of books of
+// contentType, if any.
+func (p *Profile) Conversion(contentType string) (string, bool) {
+	name, ok := p.Serve[mediaType(contentType)]
+	return name, ok
+}
+
+func mediaType(contentType string) string {
+	if t, _, err := mime.ParseMediaType(contentType); err == nil {
+		return t
+	}
+	return contentType
+}
+
+var registry = struct {
+	sync.RWMutex
+	profiles []*Profile
+}{}
+
+// Register adds a profile. Profiles are matched in registration order, so
+// more specific user agents must be registered first.
+func Register(p Profile) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.profiles = append(registry.profiles, &p)
+}
+
+// Detect returns the profile matching userAgent, or nil for unknown clients.
+func Detect(userAgent string) *Profile {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, p := range registry.profiles {
+		for _, ua := range p.UserAgents {
+			if strings.Contains(userAgent, ua) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// ByName returns the profile registered as name, or nil.
+func ByName(name string) *Profile {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, p := range registry.profiles {
+		if strings.EqualFold(p.Name, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Profiles returns all registered profiles.
+func Profiles() []Profile {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	out := make([]Profile, len(registry.profiles))
+	for i, p := range registry.profiles {
+		out[i] = *p
+	}
+	return out
+}
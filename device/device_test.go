@@ -0,0 +1,41 @@
+package device
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want string
+	}{
+		{"Mozilla/5.0 (Linux; U; Android 2.0; en-us;) AppleWebKit/538.1 (KHTML, like Gecko) Version/4.0 Mobile Safari/538.1 (Kobo Touch 0377/4.20.14622)", "kobo"},
+		{"KOReader/2024.04 (Kobo; Linux)", "koreader"},
+		{"Mozilla/5.0 (X11; U; Linux armv7l like Android; en-us) AppleWebKit/531.2+ (KHTML, like Gecko) Version/5.0 Safari/531.2+ Kindle/3.0+", "kindle"},
+		{"Mozilla/5.0 (Windows NT 10.0) Thorium/2.4.0 Chrome/120.0 Electron/28.0", "thorium"},
+		{"curl/8.0", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if p := Detect(tt.ua); p != nil {
+			got = p.Name
+		}
+		if got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.ua, got, tt.want)
+		}
+	}
+}
+
+func TestProfile_Rank(t *testing.T) {
+	p := ByName("Kobo")
+	if p == nil {
+		t.Fatal("ByName(Kobo) = nil")
+	}
+	if got := p.Rank(kepub); got != 0 {
+		t.Errorf("Rank(kepub) = %d, want 0", got)
+	}
+	if got := p.Rank(fb2 + "; charset=utf-8"); got != -1 {
+		t.Errorf("Rank(fb2) = %d, want -1", got)
+	}
+	if name, ok := p.Conversion(epub); !ok || name != "kepub" {
+		t.Errorf("Conversion(epub) = %q, %v", name, ok)
+	}
+}
@@ -0,0 +1,52 @@
+package device
+
+const (
+	epub      = "application/epub+zip"
+	kepub     = "application/kepub+zip"
+	fb2       = "text/fb2+xml"
+	mobi      = "application/x-mobipocket-ebook"
+	azw3      = "application/vnd.amazon.ebook"
+	pdf       = "application/pdf"
+	djvu      = "image/vnd.djvu"
+	cbz       = "application/x-cbz"
+	cbr       = "application/x-cbr"
+	text      = "text/plain"
+	audiobook = "application/audiobook+json"
+	mp3       = "audio/mpeg"
+	mp4       = "audio/mp4"
+)
+
+func init() {
+	// KOReader runs on Kobo devices too, so it goes before Kobo.
+	Register(Profile{
+		Name:       "koreader",
+		Title:      "KOReader",
+		UserAgents: []string{"KOReader"},
+		Formats:    []string{epub, fb2, mobi, pdf, djvu, cbz, text},
+	})
+	Register(Profile{
+		Name:       "kobo",
+		Title:      "Kobo",
+		UserAgents: []string{"Kobo"},
+		Formats:    []string{kepub, epub, pdf, cbz, cbr, text},
+		Serve:      map[string]string{epub: "kepub"},
+	})
+	Register(Profile{
+		Name:       "kindle",
+		Title:      "Kindle",
+		UserAgents: []string{"Kindle"},
+		Formats:    []string{azw3, mobi, pdf, text},
+	})
+	Register(Profile{
+		Name:       "moon",
+		Title:      "Moon+ Reader",
+		UserAgents: []string{"Moon+", "MoonReader"},
+		Formats:    []string{epub, fb2, mobi, pdf, cbz, cbr, text},
+	})
+	Register(Profile{
+		Name:       "thorium",
+		Title:      "Thorium Reader",
+		UserAgents: []string{"Thorium"},
+		Formats:    []string{epub, audiobook, pdf, cbz, mp3, mp4},
+	})
+}
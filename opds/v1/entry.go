@@ -3,22 +3,33 @@ package opdsv1
 import "encoding/xml"
 
 type Entry struct {
-	XMLName xml.Name `xml:"entry"`
-	// Xmlns     string   `xml:"xmlns,attr,omitempty"`
-	Title     string   `xml:"title"`
-	ID        string   `xml:"id"`
-	Link      []Link   `xml:"link"`
-	Published string   `xml:"published,omitempty"`
-	Updated   TimeStr  `xml:"updated"`
-	Category  string   `xml:"category,omitempty"`
-	Authors   []Author `xml:"author"`
-	Summary   *Summary `xml:"summary"`
-	Content   *Content `xml:"content"`
-	Rights    string   `xml:"rights,omitempty"`
-	Source    string   `xml:"source,omitempty"`
+	XMLName      xml.Name   `xml:"http://www.w3.org/2005/Atom entry"`
+	Title        string     `xml:"title"`
+	ID           string     `xml:"id"`
+	Link         []Link     `xml:"link"`
+	Published    string     `xml:"published,omitempty"`
+	Updated      TimeStr    `xml:"updated"`
+	Category     []Category `xml:"category"`
+	Authors      []Author   `xml:"author"`
+	Contributors []Author   `xml:"contributor"`
+	Summary      *Summary   `xml:"summary"`
+	Content      *Content   `xml:"content"`
+	Rights       string     `xml:"rights,omitempty"`
+	Source       string     `xml:"source,omitempty"`
 
-	// Extensions
-	Language string `xml:"dc:language,omitempty"`
+	// Dublin Core, OPDS 1.2 section 5.1
+	Identifier []string `xml:"http://purl.org/dc/terms/ identifier"`
+	Language   string   `xml:"http://purl.org/dc/terms/ language,omitempty"`
+	Publisher  string   `xml:"http://purl.org/dc/terms/ publisher,omitempty"`
+	Issued     string   `xml:"http://purl.org/dc/terms/ issued,omitempty"`
+}
+
+// Category is an Atom category, such as a subject of the book. Scheme
+// identifies the vocabulary of Term.
+type Category struct {
+	Term   string `xml:"term,attr"`
+	Scheme string `xml:"scheme,attr,omitempty"`
+	Label  string `xml:"label,attr,omitempty"`
 }
 
 func NewEntry(title, id string, updated TimeStr) *Entry {
@@ -29,6 +40,12 @@ func NewEntry(title, id string, updated TimeStr) *Entry {
 	}
 }
 
+// AddEntry appends e to the feed, whose updated date is that of its newest
+// entry.
 func (f *Feed) AddEntry(e *Entry) {
 	f.Entry = append(f.Entry, e)
+	if t := e.Updated.Time(); t.After(f.modified) {
+		f.modified = t
+		f.Updated = e.Updated
+	}
 }
@@ -9,17 +9,16 @@ import (
 const (
 
 	// Feed link types
-	//FeedAcquisitionLinkType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
-	FeedNavigationLinkType = "application/atom+xml;profile=opds-catalog;kind=navigation"
-	//FeedSearchLinkType      = "application/opensearchdescription+xml"
+	FeedAcquisitionLinkType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	FeedNavigationLinkType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	FeedSearchLinkType      = "application/opensearchdescription+xml"
+	// EntryLinkType is the type of complete entry documents, OPDS 1.2
+	// section 5.2.
+	EntryLinkType = "application/atom+xml;type=entry;profile=opds-catalog"
 )
 
 type Feed struct {
-	XMLName      xml.Name `xml:"feed"`
-	Xmlns        string   `xml:"xmlns,attr"`
-	XmlnsDC      string   `xml:"xmlns:dc,attr,omitempty"`
-	XmlnsOS      string   `xml:"xmlns:opensearch,attr,omitempty"`
-	XmlnsOPDS    string   `xml:"xmlns:opds,attr,omitempty"`
+	XMLName      xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
 	Title        string   `xml:"title"`
 	ID           string   `xml:"id"`
 	Updated      TimeStr  `xml:"updated"`
@@ -31,7 +30,12 @@ type Feed struct {
 	Logo         string   `xml:"logo,omitempty"`
 	Content      string   `xml:"content,omitempty"`
 	Subtitle     string   `xml:"subtitle,omitempty"`
-	SearchResult uint     `xml:"opensearch:totalResults,omitempty"`
+	SearchResult uint     `xml:"http://a9.com/-/spec/opensearch/1.1/ totalResults,omitempty"`
+	ItemsPerPage uint     `xml:"http://a9.com/-/spec/opensearch/1.1/ itemsPerPage,omitempty"`
+	StartIndex   uint     `xml:"http://a9.com/-/spec/opensearch/1.1/ startIndex,omitempty"`
+
+	// modified is the time of the newest entry, kept in Updated.
+	modified time.Time
 }
 
 type Link struct {
@@ -41,12 +45,20 @@ type Link struct {
 	Href    string   `xml:"href,attr,omitempty"`
 	Rel     string   `xml:"rel,attr,omitempty"`
 	Length  string   `xml:"length,attr,omitempty"`
+
+	// Facets, OPDS 1.2 section 4
+	FacetGroup  string `xml:"http://opds-spec.org/2010/catalog facetGroup,attr,omitempty"`
+	ActiveFacet bool   `xml:"http://opds-spec.org/2010/catalog activeFacet,attr,omitempty"`
+	Count       int    `xml:"http://purl.org/syndication/thread/1.0 count,attr,omitempty"`
+
+	// PageCount is the number of pages of a page streaming link, OPDS-PSE 1.2
+	PageCount int `xml:"http://vaemendis.net/opds-pse/ns count,attr,omitempty"`
 }
 
+// Author is an Atom person construct, used for authors and contributors.
 type Author struct {
-	XMLName xml.Name `xml:"author"`
-	Name    string   `xml:"name,omitempty"`
-	Uri     string   `xml:"uri,omitempty"`
+	Name string `xml:"name,omitempty"`
+	Uri  string `xml:"uri,omitempty"`
 }
 
 type Summary struct {
@@ -64,9 +76,26 @@ type Content struct {
 type TimeStr string
 
 func (f *Feed) Time(t time.Time) TimeStr {
-	return TimeStr(t.Format("2006-01-02T15:04:05-07:00"))
+	return Time(t)
+}
+
+const timeLayout = "2006-01-02T15:04:05-07:00"
+
+// Time formats t as an Atom date.
+func Time(t time.Time) TimeStr {
+	return TimeStr(t.Format(timeLayout))
 }
 
+// Time parses t, returning the zero time when it is malformed.
+func (t TimeStr) Time() time.Time {
+	parsed, _ := time.Parse(timeLayout, string(t))
+	return parsed
+}
+
+// started is the updated date of feeds without entries, so it stays the
+// same between requests.
+var started = time.Now()
+
 func NewFeed(title, subtitle string, self, baseUrl *url.URL) *Feed {
 	if baseUrl == nil {
 		return nil
@@ -76,19 +105,21 @@ func NewFeed(title, subtitle string, self, baseUrl *url.URL) *Feed {
 	}
 
 	f := &Feed{
-		Xmlns:     "http://www.w3.org/2005/Atom",
-		XmlnsDC:   "http://purl.org/dc/terms/",
-		XmlnsOS:   "http://a9.com/-/spec/opensearch/1.1/",
-		XmlnsOPDS: "http://opds-spec.org/2010/catalog",
-		Title:     title,
-		ID:        self.String(),
+		Title: title,
+		ID:    self.String(),
 		Link: []Link{
-			//{Rel: "search", Href: baseUrl.JoinPath(self.String(), "search?q={searchTerms}").String(), Type: FeedSearchLinkType, Title: "Search on catalog"},
+			{Rel: "search", Href: baseUrl.JoinPath(OpenSearchPath).String(), Type: FeedSearchLinkType, Title: "Search on catalog"},
 			{Rel: "start", Href: baseUrl.String() + "/", Type: FeedNavigationLinkType},
 			{Rel: "self", Href: baseUrl.JoinPath(self.String()).String(), Type: FeedNavigationLinkType},
 		},
 		Subtitle: subtitle,
 	}
-	f.Updated = f.Time(time.Now())
+	f.Updated = f.Time(started)
 	return f
 }
+
+// Modified returns when the newest entry of the feed was updated, or the
+// zero time when it has no entries.
+func (f *Feed) Modified() time.Time {
+	return f.modified
+}
@@ -0,0 +1,120 @@
+package opdsv1
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// XML namespaces of catalog documents. Struct tags name elements and
+// attributes by namespace URI; Marshal writes them with the prefixes below.
+const (
+	NamespaceAtom       = "http://www.w3.org/2005/Atom"
+	NamespaceDC         = "http://purl.org/dc/terms/"
+	NamespaceOPDS       = "http://opds-spec.org/2010/catalog"
+	NamespaceOpenSearch = "http://a9.com/-/spec/opensearch/1.1/"
+	NamespaceThr        = "http://purl.org/syndication/thread/1.0"
+	NamespacePSE        = "http://vaemendis.net/opds-pse/ns"
+	namespaceXML        = "http://www.w3.org/XML/1998/namespace"
+)
+
+// namespaces lists the prefix of every namespace in the order they are
+// declared on the root element. Atom is the default namespace.
+var namespaces = []struct {
+	prefix string
+	uri    string
+}{
+	{"", NamespaceAtom},
+	{"dc", NamespaceDC},
+	{"opds", NamespaceOPDS},
+	{"opensearch", NamespaceOpenSearch},
+	{"thr", NamespaceThr},
+	{"pse", NamespacePSE},
+}
+
+// prefixed returns name qualified with the prefix of its namespace.
+func prefixed(name xml.Name) (xml.Name, error) {
+	switch name.Space {
+	case "":
+		return name, nil
+	case namespaceXML:
+		return xml.Name{Local: "xml:" + name.Local}, nil
+	}
+	for _, ns := range namespaces {
+		if ns.uri != name.Space {
+			continue
+		}
+		if ns.prefix == "" {
+			return xml.Name{Local: name.Local}, nil
+		}
+		return xml.Name{Local: ns.prefix + ":" + name.Local}, nil
+	}
+	return name, fmt.Errorf("opdsv1: unknown namespace %q", name.Space)
+}
+
+// Marshal returns the XML encoding of a Feed or Entry. encoding/xml declares
+// a namespace on every element using it; Marshal rewrites the document so
+// the namespaces are declared once on the root element with their usual
+// prefixes, which is what readers expect of "dc:" and "opds:" elements.
+func Marshal(v any) ([]byte, error) {
+	raw, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	d := xml.NewDecoder(bytes.NewReader(raw))
+	e := xml.NewEncoder(&buf)
+	root := true
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name, err = prefixed(t.Name); err != nil {
+				return nil, err
+			}
+			var attrs []xml.Attr
+			if root {
+				for _, ns := range namespaces {
+					name := xml.Name{Local: "xmlns"}
+					if ns.prefix != "" {
+						name.Local += ":" + ns.prefix
+					}
+					attrs = append(attrs, xml.Attr{Name: name, Value: ns.uri})
+				}
+				root = false
+			}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns" {
+					continue
+				}
+				if a.Name, err = prefixed(a.Name); err != nil {
+					return nil, err
+				}
+				attrs = append(attrs, a)
+			}
+			t.Attr = attrs
+			tok = t
+		case xml.EndElement:
+			if t.Name, err = prefixed(t.Name); err != nil {
+				return nil, err
+			}
+			tok = t
+		}
+		if err := e.EncodeToken(tok); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,41 @@
+package opdsv1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	feed := &Feed{
+		Title:        "Books",
+		SearchResult: 1,
+		Link:         []Link{{Href: "/a", FacetGroup: "Sort by", ActiveFacet: true, Count: 3}},
+		Entry: []*Entry{{
+			Title:      "Dune",
+			Category:   []Category{{Term: "sf", Scheme: "FB2", Label: "Science fiction"}},
+			Identifier: []string{"urn:isbn:9780441013593"},
+			Language:   "en",
+		}},
+	}
+
+	b, err := Marshal(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	for _, want := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/terms/"`,
+		`<opensearch:totalResults>1</opensearch:totalResults>`,
+		`opds:facetGroup="Sort by" opds:activeFacet="true" thr:count="3"`,
+		`<entry><title>Dune</title>`,
+		`<category term="sf" scheme="FB2" label="Science fiction"></category>`,
+		`<dc:identifier>urn:isbn:9780441013593</dc:identifier><dc:language>en</dc:language>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Marshal output lacks %s:\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "xmlns"); n != len(namespaces) {
+		t.Errorf("got %d namespace declarations, want %d:\n%s", n, len(namespaces), out)
+	}
+}
@@ -0,0 +1,51 @@
+package opdsv1
+
+import (
+	"encoding/xml"
+	"net/url"
+)
+
+const (
+	// OpenSearchPath is the location of the description document below the
+	// catalog root.
+	OpenSearchPath = "opensearch.xml"
+	// SearchPath is the location of the search endpoint below the catalog
+	// root.
+	SearchPath = "search"
+)
+
+// OpenSearchDescription tells clients how to query the catalog.
+// https://github.com/dewitt/opensearch/blob/master/opensearch-1-1-draft-6.md
+type OpenSearchDescription struct {
+	XMLName        xml.Name        `xml:"OpenSearchDescription"`
+	Xmlns          string          `xml:"xmlns,attr"`
+	ShortName      string          `xml:"ShortName"`
+	Description    string          `xml:"Description"`
+	InputEncoding  string          `xml:"InputEncoding"`
+	OutputEncoding string          `xml:"OutputEncoding"`
+	Url            []OpenSearchUrl `xml:"Url"`
+}
+
+type OpenSearchUrl struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// NewOpenSearchDescription describes the search endpoint of the catalog at
+// baseUrl. Results are paged by the 1-based index of the first one and their
+// count.
+func NewOpenSearchDescription(shortName string, baseUrl *url.URL) *OpenSearchDescription {
+	return &OpenSearchDescription{
+		Xmlns:          "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:      shortName,
+		Description:    "Search the catalog by title, author, series, subject or identifier",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		Url: []OpenSearchUrl{
+			{
+				Type:     FeedAcquisitionLinkType,
+				Template: baseUrl.JoinPath(SearchPath).String() + "?q={searchTerms}&start={startIndex?}&count={count?}",
+			},
+		},
+	}
+}
@@ -0,0 +1,59 @@
+package opdsv2
+
+import "time"
+
+// https://drafts.opds.io/opds-2.0
+const (
+	// FeedMediaType is the content type of OPDS 2.0 catalog feeds.
+	FeedMediaType = "application/opds+json"
+	// PublicationMediaType is the content type of a single OPDS 2.0
+	// publication.
+	PublicationMediaType = "application/opds-publication+json"
+
+	AcquisitionRel = "http://opds-spec.org/acquisition"
+	ImageRel       = "http://opds-spec.org/image"
+	ThumbnailRel   = "http://opds-spec.org/image/thumbnail"
+	FacetRel       = "http://opds-spec.org/facet"
+)
+
+// Feed is an OPDS 2.0 catalog feed. A feed lists navigation links to other
+// feeds, publications, or both in groups.
+type Feed struct {
+	Metadata     FeedMetadata  `json:"metadata"`
+	Links        []Link        `json:"links"`
+	Facets       []Facet       `json:"facets,omitempty"`
+	Navigation   []Link        `json:"navigation,omitempty"`
+	Publications []Publication `json:"publications,omitempty"`
+	Groups       []Group       `json:"groups,omitempty"`
+}
+
+// FeedMetadata describes a feed, a group or a facet. The item counts are
+// those of paged collections.
+type FeedMetadata struct {
+	Title         string     `json:"title"`
+	Subtitle      string     `json:"subtitle,omitempty"`
+	Modified      *time.Time `json:"modified,omitempty"`
+	NumberOfItems int        `json:"numberOfItems,omitempty"`
+	ItemsPerPage  int        `json:"itemsPerPage,omitempty"`
+	CurrentPage   int        `json:"currentPage,omitempty"`
+}
+
+// Group is a titled collection of navigation links or publications shown
+// within a feed, with a link to the complete collection.
+type Group struct {
+	Metadata     FeedMetadata  `json:"metadata"`
+	Links        []Link        `json:"links,omitempty"`
+	Navigation   []Link        `json:"navigation,omitempty"`
+	Publications []Publication `json:"publications,omitempty"`
+}
+
+// Facet is a group of links to filtered or sorted versions of a feed.
+type Facet struct {
+	Metadata FeedMetadata `json:"metadata"`
+	Links    []Link       `json:"links"`
+}
+
+// Properties holds the OPDS properties of a link.
+type Properties struct {
+	NumberOfItems int `json:"numberOfItems,omitempty"`
+}
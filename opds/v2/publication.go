@@ -0,0 +1,93 @@
+// Package opdsv2 holds the JSON model of Readium Web Publication Manifests,
+// the building block of OPDS 2.0 catalogs and audiobook manifests.
+// https://readium.org/webpub-manifest/
+package opdsv2
+
+import "time"
+
+const (
+	// Context is the JSON-LD context of every publication manifest.
+	Context = "https://readium.org/webpub-manifest/context.jsonld"
+
+	// AudiobookMediaType is the content type of an audiobook manifest.
+	AudiobookMediaType = "application/audiobook+json"
+	// AudiobookProfile is the conformsTo value of an audiobook manifest.
+	AudiobookProfile = "https://readium.org/webpub-manifest/profiles/audiobook"
+	// AudiobookType is the schema.org type of an audiobook.
+	AudiobookType = "http://schema.org/Audiobook"
+)
+
+// Publication is a Readium Web Publication Manifest.
+type Publication struct {
+	Context      string   `json:"@context,omitempty"`
+	Metadata     Metadata `json:"metadata"`
+	Links        []Link   `json:"links"`
+	ReadingOrder []Link   `json:"readingOrder,omitempty"`
+	Resources    []Link   `json:"resources,omitempty"`
+	TOC          []Link   `json:"toc,omitempty"`
+	// Images lists the covers of a publication in a catalog.
+	Images []Link `json:"images,omitempty"`
+}
+
+// Metadata describes a publication.
+type Metadata struct {
+	Type        string        `json:"@type,omitempty"`
+	ConformsTo  string        `json:"conformsTo,omitempty"`
+	Identifier  string        `json:"identifier,omitempty"`
+	Title       string        `json:"title"`
+	Author      []Contributor `json:"author,omitempty"`
+	Translator  []Contributor `json:"translator,omitempty"`
+	Narrator    []Contributor `json:"narrator,omitempty"`
+	Contributor []Contributor `json:"contributor,omitempty"`
+	Publisher   []Contributor `json:"publisher,omitempty"`
+	Language    string        `json:"language,omitempty"`
+	Subject     []Subject     `json:"subject,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Published   string        `json:"published,omitempty"`
+	Modified    *time.Time    `json:"modified,omitempty"`
+	BelongsTo   *BelongsTo    `json:"belongsTo,omitempty"`
+	// Duration is the playing time in seconds.
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// Contributor is a person or organisation credited for a publication.
+type Contributor struct {
+	Name   string `json:"name"`
+	SortAs string `json:"sortAs,omitempty"`
+	Links  []Link `json:"links,omitempty"`
+}
+
+// Subject is a subject of a publication. Scheme identifies the vocabulary of
+// Code.
+type Subject struct {
+	Name   string `json:"name"`
+	Scheme string `json:"scheme,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// BelongsTo lists the collections a publication is part of.
+type BelongsTo struct {
+	Series []Collection `json:"series,omitempty"`
+}
+
+// Collection is a series or collection, with the position of the
+// publication in it.
+type Collection struct {
+	Name     string   `json:"name"`
+	Position *float64 `json:"position,omitempty"`
+	Links    []Link   `json:"links,omitempty"`
+}
+
+// Link points to a resource of a publication or catalog.
+type Link struct {
+	Href      string `json:"href"`
+	Type      string `json:"type,omitempty"`
+	Rel       string `json:"rel,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Templated bool   `json:"templated,omitempty"`
+	// Duration is the playing time in seconds of an audio resource.
+	Duration float64 `json:"duration,omitempty"`
+	Children []Link  `json:"children,omitempty"`
+
+	Properties *Properties `json:"properties,omitempty"`
+}
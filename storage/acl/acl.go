@@ -0,0 +1,213 @@
+/*
+Package acl restricts what users see of the library. Rules, read from a JSON
+file, allow or deny folders to users and groups of users and hide books by
+language, subject or age rating. The catalog wraps the store in a
+restricted one for every request, so hidden books are neither listed nor
+served by direct URL.
+
+An example file hiding the grown-up shelves from the kids:
+
+	{
+	  "groups": {"kids": ["tom", "ann"]},
+	  "rules": [
+	    {"groups": ["kids"], "allow": ["/Kids", "/Comics"], "max_age": 12},
+	    {"users": ["*"], "deny": ["/Private"], "deny_subjects": ["Erotica"]}
+	  ]
+	}
+*/
+package acl
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"bookarr/storage"
+)
+
+// Everyone in the users of a rule applies it to every user, and to everyone
+// when the catalog has no users.
+const Everyone = "*"
+
+// Rules are the access rules of the library.
+type Rules struct {
+	// Groups maps group names to the names of their members.
+	Groups map[string][]string `json:"groups,omitempty"`
+	Rules  []Rule              `json:"rules"`
+}
+
+// Rule restricts the library for some users. A book is visible to a user
+// when it passes every rule applying to them.
+type Rule struct {
+	Users  []string `json:"users,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+
+	// Allow lists the only folders visible, with their content. The
+	// folders leading to them are visible too, showing nothing else. When
+	// empty the whole library is.
+	Allow []string `json:"allow,omitempty"`
+	// Deny lists the folders and books hidden.
+	Deny []string `json:"deny,omitempty"`
+
+	// Languages lists the languages of the books visible, e.g. "en".
+	// Books of unknown language are visible.
+	Languages []string `json:"languages,omitempty"`
+	// DenySubjects hides the books having one of these subjects or tags.
+	DenySubjects []string `json:"deny_subjects,omitempty"`
+	// MaxAge hides the books rated for readers older than this. Books
+	// without an age rating are visible.
+	MaxAge int `json:"max_age,omitempty"`
+}
+
+// Load reads the rules in file. A missing file means no rules.
+func Load(file string) (*Rules, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Rules{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r Rules
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	for i := range r.Rules {
+		for j, p := range r.Rules[i].Allow {
+			r.Rules[i].Allow[j] = cleanPath(p)
+		}
+		for j, p := range r.Rules[i].Deny {
+			r.Rules[i].Deny[j] = cleanPath(p)
+		}
+	}
+	return &r, nil
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// For returns the policy of user, the name of the signed in user or an
+// empty string when the catalog is open, or nil when no rule applies.
+func (r *Rules) For(user string) *Policy {
+	if r == nil {
+		return nil
+	}
+	var p Policy
+	for _, rule := range r.Rules {
+		if r.applies(rule, user) {
+			p.rules = append(p.rules, rule)
+		}
+	}
+	if len(p.rules) == 0 {
+		return nil
+	}
+	return &p
+}
+
+func (r *Rules) applies(rule Rule, user string) bool {
+	if slices.Contains(rule.Users, Everyone) || user != "" && slices.Contains(rule.Users, user) {
+		return true
+	}
+	if user == "" {
+		return false
+	}
+	for _, g := range rule.Groups {
+		if slices.Contains(r.Groups[g], user) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy is what the rules allow a user to see.
+type Policy struct {
+	rules []Rule
+}
+
+// under reports whether p is prefix or inside it.
+func under(p, prefix string) bool {
+	return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func (r Rule) allowsPath(p string) bool {
+	for _, d := range r.Deny {
+		if under(p, d) {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, a := range r.Allow {
+		if under(p, a) || under(a, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) filtersMetadata() bool {
+	return len(r.Languages) > 0 || len(r.DenySubjects) > 0 || r.MaxAge > 0
+}
+
+func (r Rule) allowsMetadata(m storage.Metadata) bool {
+	if lang := m.GetLanguage(); lang != "" && len(r.Languages) > 0 {
+		primary, _, _ := strings.Cut(strings.ToLower(lang), "-")
+		if !slices.ContainsFunc(r.Languages, func(l string) bool { return strings.EqualFold(l, lang) || strings.EqualFold(l, primary) }) {
+			return false
+		}
+	}
+	for _, s := range storage.Subjects(m) {
+		for _, d := range r.DenySubjects {
+			if strings.EqualFold(s.Label, d) || strings.EqualFold(s.Term, d) {
+				return false
+			}
+		}
+	}
+	if age := storage.AgeRating(m); r.MaxAge > 0 && age > r.MaxAge {
+		return false
+	}
+	return true
+}
+
+// AllowPath reports whether the folder or file at p may be seen.
+func (p *Policy) AllowPath(pth string) bool {
+	if p == nil {
+		return true
+	}
+	pth = cleanPath(pth)
+	for _, r := range p.rules {
+		if !r.allowsPath(pth) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowEntry reports whether the entry of the folder or book at p may be
+// seen.
+func (p *Policy) AllowEntry(pth string, e storage.Entry) bool {
+	if !p.AllowPath(pth) {
+		return false
+	}
+	if p == nil || e.Metadata == nil {
+		return true
+	}
+	for _, r := range p.rules {
+		if !r.allowsMetadata(e.Metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+// filtersMetadata reports whether books must be read to tell whether they
+// are visible.
+func (p *Policy) filtersMetadata() bool {
+	return p != nil && slices.ContainsFunc(p.rules, Rule.filtersMetadata)
+}
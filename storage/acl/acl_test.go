@@ -0,0 +1,99 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bookarr/storage"
+)
+
+type meta struct {
+	storage.NOOPMetadata
+	language, subject string
+	age               int
+}
+
+func (m meta) GetLanguage() string { return m.language }
+func (m meta) GetSubject() string  { return m.subject }
+func (m meta) GetAgeRating() int   { return m.age }
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "acl.json")
+	if r, err := Load(file); err != nil || len(r.Rules) != 0 {
+		t.Fatalf("Load missing file = %v, %v", r, err)
+	}
+
+	os.WriteFile(file, []byte(`{
+		"groups": {"kids": ["tom"]},
+		"rules": [
+			{"groups": ["kids"], "allow": ["Kids/", "/Comics"], "max_age": 12},
+			{"users": ["*"], "deny": ["/Private"]}
+		]
+	}`), 0o644)
+	r, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Rules[0].Allow[0]; got != "/Kids" {
+		t.Errorf("allowed path = %q, want /Kids", got)
+	}
+
+	if p := r.For("ann"); p == nil || len(p.rules) != 1 {
+		t.Errorf("For(ann) = %v, want the rule of everyone", p)
+	}
+	if p := r.For(""); p == nil || len(p.rules) != 1 {
+		t.Errorf("For anonymous = %v, want the rule of everyone", p)
+	}
+	if p := r.For("tom"); p == nil || len(p.rules) != 2 {
+		t.Errorf("For(tom) = %v, want both rules", p)
+	}
+	if p := (&Rules{}).For("tom"); p != nil {
+		t.Errorf("For without rules = %v, want nil", p)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := &Policy{rules: []Rule{
+		{Allow: []string{"/Kids/Comics"}, Deny: []string{"/Kids/Comics/Scary"}},
+		{Languages: []string{"en"}, DenySubjects: []string{"horror"}, MaxAge: 12},
+	}}
+
+	paths := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/Kids", true},
+		{"/Kids/book.epub", false},
+		{"/Kids/Comics", true},
+		{"/Kids/Comics/a.cbz", true},
+		{"/Kids/ComicsX", false},
+		{"/Kids/Comics/Scary/b.cbz", false},
+		{"/Adult", false},
+	}
+	for _, tt := range paths {
+		if got := p.AllowPath(tt.path); got != tt.want {
+			t.Errorf("AllowPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	books := []struct {
+		name string
+		m    meta
+		want bool
+	}{
+		{"no metadata", meta{}, true},
+		{"english", meta{language: "en-US"}, true},
+		{"french", meta{language: "fr"}, false},
+		{"horror", meta{subject: "Fiction, Horror"}, false},
+		{"for kids", meta{age: 8}, true},
+		{"for teens", meta{age: 13}, false},
+	}
+	for _, tt := range books {
+		e := storage.Entry{Name: "a.epub", Metadata: tt.m}
+		if got := p.AllowEntry("/Kids/Comics/a.epub", e); got != tt.want {
+			t.Errorf("AllowEntry(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package acl
+
+import (
+	"os"
+	"path"
+
+	"bookarr/storage"
+)
+
+type store struct {
+	storage.Store
+	policy *Policy
+}
+
+// NewStore returns s showing only what policy allows. Hidden folders and
+// books do not exist for the returned store.
+func NewStore(s storage.Store, policy *Policy) storage.Store {
+	if policy == nil {
+		return s
+	}
+	return &store{Store: s, policy: policy}
+}
+
+// allowed reports whether the book or folder at p may be seen, reading its
+// metadata when the policy filters on it.
+func (s *store) allowed(p string) bool {
+	if !s.policy.AllowPath(p) {
+		return false
+	}
+	if !s.policy.filtersMetadata() {
+		return true
+	}
+	e, err := s.Store.Entry(p)
+	if err != nil {
+		return false
+	}
+	// the formats of a book without metadata, such as its PDF edition,
+	// are judged by the book they are listed with
+	if e.Metadata.GetTitle() == "" {
+		if book := s.book(p); book != nil {
+			e = book
+		}
+	}
+	return s.policy.AllowEntry(p, *e)
+}
+
+// book returns the listing entry holding the file at p.
+func (s *store) book(p string) *storage.Entry {
+	dir, name := path.Split(p)
+	entries, err := s.Store.List(dir, storage.ListOptions{})
+	if err != nil {
+		return nil
+	}
+	for i := range entries {
+		for _, f := range entries[i].Files {
+			if f.Name == name {
+				return &entries[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (s *store) PathType(p string) storage.PathType {
+	t := s.Store.PathType(p)
+	switch t {
+	case storage.PathTypeNotExists:
+		return t
+	case storage.PathTypeFile, storage.PathTypeAudiobook:
+		if !s.allowed(p) {
+			return storage.PathTypeNotExists
+		}
+	default:
+		if !s.policy.AllowPath(p) {
+			return storage.PathTypeNotExists
+		}
+	}
+	return t
+}
+
+func (s *store) List(p string, opts storage.ListOptions) ([]storage.Entry, error) {
+	if !s.policy.AllowPath(p) {
+		return nil, os.ErrNotExist
+	}
+	entries, err := s.Store.List(p, opts)
+	if err != nil {
+		return entries, err
+	}
+	visible := entries[:0]
+	for _, e := range entries {
+		if s.policy.AllowEntry(path.Join(p, e.Name), e) {
+			visible = append(visible, e)
+		}
+	}
+	return visible, nil
+}
+
+func (s *store) Entry(p string) (*storage.Entry, error) {
+	if !s.allowed(p) {
+		return nil, os.ErrNotExist
+	}
+	return s.Store.Entry(p)
+}
+
+func (s *store) File(p string) *storage.File {
+	if !s.allowed(p) {
+		return nil
+	}
+	return s.Store.File(p)
+}
+
+func (s *store) Cover(p string) *storage.File {
+	if !s.allowed(p) {
+		return nil
+	}
+	return s.Store.Cover(p)
+}
+
+func (s *store) Thumbnail(p string) *storage.File {
+	if !s.allowed(p) {
+		return nil
+	}
+	return s.Store.Thumbnail(p)
+}
+
+func (s *store) Page(p string, n int) *storage.File {
+	ps, ok := s.Store.(storage.PageStore)
+	if !ok || !s.allowed(p) {
+		return nil
+	}
+	return ps.Page(p, n)
+}
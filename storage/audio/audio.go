@@ -0,0 +1,299 @@
+/*
+Package audio provides support for audiobooks stored as a single MP4 file
+(.m4b, .m4a) or as a folder of numbered MP3 tracks. Metadata, chapters and
+artwork are read from the MP4 atoms and ID3v2 tags.
+*/
+package audio
+
+import (
+	"bookarr/storage"
+	"bytes"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MP4MIMEType is the content type of .m4b and .m4a files.
+	MP4MIMEType = "audio/mp4"
+	// MP3MIMEType is the content type of .mp3 files.
+	MP3MIMEType = "audio/mpeg"
+)
+
+func init() {
+	storage.RegisterFormat(storage.Format{
+		Name:       "M4B",
+		MIMEType:   MP4MIMEType,
+		Extensions: []string{".m4b", ".m4a"},
+		Sniff:      sniffMP4,
+		Extractor:  mp4Extractor{},
+	})
+	storage.RegisterFormat(storage.Format{
+		Name:       "MP3",
+		MIMEType:   MP3MIMEType,
+		Extensions: []string{".mp3"},
+		Sniff:      sniffMP3,
+		MatchDir:   isTrackFolder,
+		Extractor:  mp3Extractor{},
+	})
+}
+
+func sniffMP4(header []byte) bool {
+	return storage.HasPrefixAt(header, 4, "ftypM4B ") || storage.HasPrefixAt(header, 4, "ftypM4A ")
+}
+
+func sniffMP3(header []byte) bool {
+	if storage.HasPrefixAt(header, 0, "ID3") {
+		return true
+	}
+	return len(header) >= 2 && header[0] == 0xff && header[1]&0xe6 == 0xe2 // MPEG 1 or 2, layer III
+}
+
+// Metadata describes an audiobook. It implements storage.AudioMetadata.
+type Metadata struct {
+	Title       string
+	Author      string
+	Narrator    string
+	Publisher   string
+	Language    string
+	Genre       string
+	Description string
+	Duration    time.Duration
+	Tracks      []storage.Track
+	Chapters    []storage.Chapter
+
+	picture     []byte
+	folderCover bool
+}
+
+func (m *Metadata) GetTitle() string               { return m.Title }
+func (m *Metadata) GetLanguage() string            { return m.Language }
+func (m *Metadata) GetIdentifier() string          { return "" }
+func (m *Metadata) GetCreator() string             { return m.Author }
+func (m *Metadata) GetContributor() string         { return m.Narrator }
+func (m *Metadata) GetPublisher() string           { return m.Publisher }
+func (m *Metadata) GetSubject() string             { return m.Genre }
+func (m *Metadata) GetDescription() string         { return m.Description }
+func (m *Metadata) HasCover() bool                 { return m.picture != nil || m.folderCover }
+func (m *Metadata) HasThumbnail() bool             { return false }
+func (m *Metadata) GetNarrator() string            { return m.Narrator }
+func (m *Metadata) GetDuration() time.Duration     { return m.Duration }
+func (m *Metadata) GetTracks() []storage.Track     { return m.Tracks }
+func (m *Metadata) GetChapters() []storage.Chapter { return m.Chapters }
+
+// Cover decodes the embedded artwork.
+func (m *Metadata) Cover() (image.Image, error) {
+	if m.picture == nil {
+		return nil, storage.ErrNotRecognised
+	}
+	img, _, err := image.Decode(bytes.NewReader(m.picture))
+	return img, err
+}
+
+type mp4Extractor struct{}
+
+func (mp4Extractor) Metadata(filename string) (storage.Metadata, error) {
+	return readMP4File(filename)
+}
+
+func (mp4Extractor) Cover(filename string) (image.Image, error) {
+	m, err := readMP4File(filename)
+	if err != nil {
+		return nil, err
+	}
+	return m.Cover()
+}
+
+type mp3Extractor struct{}
+
+func (mp3Extractor) Metadata(filename string) (storage.Metadata, error) {
+	if isDir(filename) {
+		return readTrackFolder(filename)
+	}
+	return readMP3File(filename)
+}
+
+func (mp3Extractor) Cover(filename string) (image.Image, error) {
+	if isDir(filename) {
+		if img := folderImage(filename); img != nil {
+			return img, nil
+		}
+	}
+	m, err := mp3Extractor{}.Metadata(filename)
+	if err != nil {
+		return nil, err
+	}
+	return m.(*Metadata).Cover()
+}
+
+func readMP4File(filename string) (*Metadata, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := readMP4(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	text := func(keys ...string) string {
+		for _, k := range keys {
+			if v := strings.TrimSpace(tags.text[k]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	m := &Metadata{
+		Title:       text("\xa9alb", "\xa9nam"),
+		Author:      text("aART", "\xa9ART"),
+		Narrator:    text("----:NARRATOR", "\xa9nrt", "\xa9wrt"),
+		Publisher:   text("----:PUBLISHER", "\xa9pub"),
+		Language:    text("----:LANGUAGE"),
+		Genre:       text("\xa9gen"),
+		Description: text("ldes", "desc", "\xa9des", "\xa9cmt"),
+		Duration:    tags.duration,
+		picture:     tags.picture,
+	}
+	m.Tracks = []storage.Track{{
+		Title:         m.Title,
+		ContentType:   MP4MIMEType,
+		ContentLength: fi.Size(),
+		Duration:      tags.duration,
+	}}
+	for i, c := range tags.chapters {
+		end := tags.duration
+		if i+1 < len(tags.chapters) {
+			end = tags.chapters[i+1].start
+		}
+		m.Chapters = append(m.Chapters, storage.Chapter{
+			Title:    chapterTitle(c.title, i),
+			Start:    c.start,
+			Duration: end - c.start,
+		})
+	}
+	return m, nil
+}
+
+func readMP3File(filename string) (*Metadata, error) {
+	t, track, err := readTrack(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	m := newMP3Metadata(t)
+	if m.Title == "" {
+		m.Title = track.Title
+	}
+	m.Duration = track.Duration
+	m.Tracks = []storage.Track{track}
+	m.Chapters = trackChapters(t, track, 0)
+	return m, nil
+}
+
+// readTrack reads the tag and playing time of a single MP3 file. The returned
+// tag is empty, not nil, when the file has no ID3v2 tag.
+func readTrack(filename string) (*id3Tag, storage.Track, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, storage.Track{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, storage.Track{}, err
+	}
+
+	t, err := readID3(f)
+	if err != nil {
+		t = &id3Tag{text: map[string]string{}, user: map[string]string{}}
+	}
+
+	track := storage.Track{
+		Name:          filepath.Base(filename),
+		Title:         t.text["TIT2"],
+		ContentType:   MP3MIMEType,
+		ContentLength: fi.Size(),
+	}
+	if track.Title == "" {
+		track.Title = strings.TrimSuffix(track.Name, filepath.Ext(track.Name))
+	}
+	if ms, err := strconv.Atoi(t.text["TLEN"]); err == nil && ms > 0 {
+		track.Duration = time.Duration(ms) * time.Millisecond
+	} else {
+		track.Duration = mp3Duration(f, t.size, fi.Size())
+	}
+	return t, track, nil
+}
+
+func newMP3Metadata(t *id3Tag) *Metadata {
+	first := func(values ...string) string {
+		for _, v := range values {
+			if v = strings.TrimSpace(v); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	return &Metadata{
+		Title:       t.text["TALB"],
+		Author:      first(t.text["TPE2"], t.text["TPE1"]),
+		Narrator:    first(t.user["NARRATOR"], t.user["NARRATEDBY"], t.text["TCOM"]),
+		Publisher:   t.text["TPUB"],
+		Language:    t.text["TLAN"],
+		Genre:       t.text["TCON"],
+		Description: first(t.user["DESCRIPTION"], t.comment),
+		picture:     t.picture,
+	}
+}
+
+// trackChapters returns the ID3 chapters of one track, or a single chapter
+// spanning the track when it has none.
+func trackChapters(t *id3Tag, track storage.Track, index int) []storage.Chapter {
+	chapters := t.orderedChapters()
+	if len(chapters) == 0 {
+		return []storage.Chapter{{
+			Title:    track.Title,
+			Track:    index,
+			Duration: track.Duration,
+		}}
+	}
+
+	out := make([]storage.Chapter, 0, len(chapters))
+	for i, c := range chapters {
+		out = append(out, storage.Chapter{
+			Title:    chapterTitle(c.title, i),
+			Track:    index,
+			Start:    c.start,
+			Duration: c.end - c.start,
+		})
+	}
+	return out
+}
+
+func chapterTitle(title string, i int) string {
+	if title = strings.TrimSpace(title); title != "" {
+		return title
+	}
+	return "Chapter " + strconv.Itoa(i+1)
+}
+
+func isDir(filename string) bool {
+	fi, err := os.Stat(filename)
+	return err == nil && fi.IsDir()
+}
@@ -0,0 +1,202 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func id3Frame(id string, body []byte) []byte {
+	b := make([]byte, 10, 10+len(body))
+	copy(b, id)
+	binary.BigEndian.PutUint32(b[4:8], uint32(len(body)))
+	return append(b, body...)
+}
+
+func id3Text(id, value string) []byte {
+	return id3Frame(id, append([]byte{3}, value...))
+}
+
+func id3Chap(id string, start, end uint32, title string) []byte {
+	body := append([]byte(id), 0)
+	times := make([]byte, 16)
+	binary.BigEndian.PutUint32(times[0:4], start)
+	binary.BigEndian.PutUint32(times[4:8], end)
+	body = append(body, times...)
+	return id3Frame("CHAP", append(body, id3Text("TIT2", title)...))
+}
+
+// buildMP3 returns an ID3v2.3 tag followed by a single MPEG 1 layer III frame
+// header at 128kbps and frames bytes of padding.
+func buildMP3(frames []byte, padding int) []byte {
+	size := len(frames)
+	tag := []byte{'I', 'D', '3', 3, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	tag = append(tag, frames...)
+	tag = append(tag, 0xff, 0xfb, 0x90, 0x00)
+	return append(tag, make([]byte, padding)...)
+}
+
+func TestReadID3(t *testing.T) {
+	var frames []byte
+	frames = append(frames, id3Text("TIT2", "Part One")...)
+	frames = append(frames, id3Text("TALB", "The Book")...)
+	frames = append(frames, id3Text("TPE1", "An Author")...)
+	frames = append(frames, id3Frame("TXXX", append([]byte{3}, "narrator\x00A Reader"...))...)
+	frames = append(frames, id3Frame("CTOC", append([]byte("toc\x00"), 0x03, 2, 'b', 0, 'a', 0))...)
+	frames = append(frames, id3Chap("a", 60000, 120000, "Second")...)
+	frames = append(frames, id3Chap("b", 0, 60000, "First")...)
+
+	data := buildMP3(frames, 15996)
+	dir := t.TempDir()
+	name := filepath.Join(dir, "01 Part One.mp3")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := readTrackFolder(dir)
+	if err != nil {
+		t.Fatalf("readTrackFolder() error = %v", err)
+	}
+	if m.Title != "The Book" || m.Author != "An Author" || m.Narrator != "A Reader" {
+		t.Errorf("metadata = %q, %q, %q", m.Title, m.Author, m.Narrator)
+	}
+	if got, want := m.Duration, time.Second; got != want {
+		t.Errorf("duration = %s, want %s", got, want)
+	}
+	if len(m.Chapters) != 2 || m.Chapters[0].Title != "First" || m.Chapters[1].Start != time.Minute {
+		t.Errorf("chapters = %+v", m.Chapters)
+	}
+	if !isTrackFolder(dir) {
+		t.Errorf("isTrackFolder() = false, want true")
+	}
+}
+
+func TestMP3DurationLarge(t *testing.T) {
+	// a 2 GB stream at 128kbps, larger than nanoseconds per byte allow
+	data := buildMP3(nil, 64)
+	const size = 2 << 30
+	got := mp3Duration(bytes.NewReader(data), 0, size)
+	if want := 134217 * time.Second; got.Truncate(time.Second) != want {
+		t.Errorf("mp3Duration() = %s, want %s", got, want)
+	}
+}
+
+func mp4Atom(typ string, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b[:4], uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+func mp4Text(typ, value string) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data[:4], 1)
+	return mp4Atom(typ, mp4Atom("data", data, []byte(value)))
+}
+
+func TestReadMP4(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], 90000)
+
+	chpl := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2}
+	for i, title := range []string{"Intro", "Main"} {
+		start := make([]byte, 8)
+		binary.BigEndian.PutUint64(start, uint64(i)*30*10000000)
+		chpl = append(chpl, start...)
+		chpl = append(chpl, byte(len(title)))
+		chpl = append(chpl, title...)
+	}
+
+	file := bytes.Join([][]byte{
+		mp4Atom("ftyp", []byte("M4B \x00\x00\x00\x00")),
+		mp4Atom("moov",
+			mp4Atom("mvhd", mvhd),
+			mp4Atom("udta",
+				mp4Atom("chpl", chpl),
+				mp4Atom("meta", []byte{0, 0, 0, 0},
+					mp4Atom("ilst",
+						mp4Text("\xa9nam", "Title"),
+						mp4Text("\xa9ART", "Writer"),
+						mp4Text("\xa9wrt", "Speaker"),
+					),
+				),
+			),
+		),
+	}, nil)
+
+	name := filepath.Join(t.TempDir(), "book.m4b")
+	if err := os.WriteFile(name, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := readMP4File(name)
+	if err != nil {
+		t.Fatalf("readMP4File() error = %v", err)
+	}
+	if m.Title != "Title" || m.Author != "Writer" || m.Narrator != "Speaker" {
+		t.Errorf("metadata = %q, %q, %q", m.Title, m.Author, m.Narrator)
+	}
+	if m.Duration != 90*time.Second {
+		t.Errorf("duration = %s, want 1m30s", m.Duration)
+	}
+	if len(m.Chapters) != 2 || m.Chapters[1].Start != 30*time.Second || m.Chapters[1].Duration != time.Minute {
+		t.Errorf("chapters = %+v", m.Chapters)
+	}
+}
+
+func TestMP4DurationLarge(t *testing.T) {
+	// 100 hours at 44.1 kHz, more ticks than nanoseconds allow
+	const timescale = 44100
+	mvhd := make([]byte, 32)
+	mvhd[0] = 1
+	binary.BigEndian.PutUint32(mvhd[20:24], timescale)
+	binary.BigEndian.PutUint64(mvhd[24:32], timescale*3600*100)
+
+	var tags mp4Tags
+	tags.readMovieHeader(bytes.NewReader(mvhd), atom{typ: "mvhd", size: int64(len(mvhd))})
+	if want := 100 * time.Hour; tags.duration != want {
+		t.Errorf("duration = %s, want %s", tags.duration, want)
+	}
+}
+
+func TestQuickTimeChaptersLarge(t *testing.T) {
+	// four 4s chapters at a nanosecond timescale, so the last start overflows
+	// when multiplied by time.Second
+	const timescale, delta = 1_000_000_000, 4_000_000_000
+	u32 := func(vs ...uint32) []byte {
+		b := make([]byte, 4*len(vs))
+		for i, v := range vs {
+			binary.BigEndian.PutUint32(b[4*i:], v)
+		}
+		return b
+	}
+
+	samples := []byte("\x00\x01A\x00\x01B\x00\x01C\x00\x01D")
+	tables := map[string][]byte{
+		"stts": u32(0, 1, 4, delta),
+		"stsz": u32(0, 3, 4),
+		"stsc": u32(0, 1, 1, 4, 1),
+		"stco": u32(0, 1, 0),
+	}
+	buf := append([]byte(nil), samples...)
+	text := &mp4Track{id: 2, timescale: timescale, tables: map[string]atom{}}
+	for typ, p := range tables {
+		text.tables[typ] = atom{typ: typ, offset: int64(len(buf)), size: int64(len(p))}
+		buf = append(buf, p...)
+	}
+	audio := &mp4Track{id: 1, timescale: 44100, chapRefs: []uint32{2}}
+
+	chapters := quickTimeChapters(bytes.NewReader(buf), []*mp4Track{audio, text})
+	if len(chapters) != 4 {
+		t.Fatalf("chapters = %+v, want 4", chapters)
+	}
+	if c := chapters[3]; c.title != "D" || c.start != 12*time.Second {
+		t.Errorf("last chapter = %q at %s, want %q at 12s", c.title, c.start, "D")
+	}
+}
@@ -0,0 +1,148 @@
+package audio
+
+import (
+	"bookarr/storage"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// folderCovers are the image names checked, in order, for folder artwork.
+var folderCovers = []string{"cover", "folder", "front"}
+
+var folderImages = map[string]struct{}{
+	".jpg": {}, ".jpeg": {}, ".png": {}, ".gif": {},
+}
+
+// folderExtras are files that may sit next to the tracks of an audiobook.
+var folderExtras = map[string]struct{}{
+	".jpg": {}, ".jpeg": {}, ".png": {}, ".gif": {},
+	".cue": {}, ".m3u": {}, ".m3u8": {}, ".nfo": {}, ".txt": {}, ".log": {},
+}
+
+// isTrackFolder reports whether dir holds a single audiobook: numbered MP3
+// tracks with nothing else than artwork and playlists next to them.
+func isTrackFolder(dir string) bool {
+	tracks := trackNames(dir)
+	if len(tracks) == 0 {
+		return false
+	}
+	for _, t := range tracks {
+		if strings.IndexFunc(t, unicode.IsDigit) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// trackNames returns the MP3 files of dir in natural order, or nil when dir
+// holds anything else.
+func trackNames(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var tracks []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if e.IsDir() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext == ".mp3" {
+			tracks = append(tracks, name)
+			continue
+		}
+		if _, ok := folderExtras[ext]; !ok {
+			return nil
+		}
+	}
+
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return storage.NaturalLess(tracks[i], tracks[j])
+	})
+	return tracks
+}
+
+// readTrackFolder combines the tags of all tracks in dir. Book level fields
+// come from the first track that has them.
+func readTrackFolder(dir string) (*Metadata, error) {
+	var m *Metadata
+	for i, name := range trackNames(dir) {
+		t, track, err := readTrack(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		if m == nil {
+			m = newMP3Metadata(t)
+		}
+		if m.picture == nil {
+			m.picture = t.picture
+		}
+
+		m.Duration += track.Duration
+		m.Tracks = append(m.Tracks, track)
+		m.Chapters = append(m.Chapters, trackChapters(t, track, i)...)
+	}
+
+	if m == nil {
+		return nil, os.ErrNotExist
+	}
+	if m.Title == "" {
+		m.Title = filepath.Base(dir)
+	}
+	m.folderCover = folderImagePath(dir) != ""
+	return m, nil
+}
+
+// folderImagePath returns the cover artwork stored next to the tracks, or an
+// empty string.
+func folderImagePath(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	for _, want := range folderCovers {
+		for _, e := range entries {
+			name := e.Name()
+			ext := strings.ToLower(filepath.Ext(name))
+			if _, ok := folderImages[ext]; !ok {
+				continue
+			}
+			if strings.EqualFold(strings.TrimSuffix(name, filepath.Ext(name)), want) {
+				return filepath.Join(dir, name)
+			}
+		}
+	}
+	return ""
+}
+
+// folderImage decodes the cover artwork stored next to the tracks.
+func folderImage(dir string) image.Image {
+	name := folderImagePath(dir)
+	if name == "" {
+		return nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil
+	}
+	return img
+}
@@ -0,0 +1,341 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+var errNoID3 = errors.New("audio: no id3v2 tag")
+
+// id3Tag holds the frames of an ID3v2 tag that are useful for audiobooks.
+type id3Tag struct {
+	// size is the total length of the tag in the file, header included.
+	size     int64
+	text     map[string]string
+	user     map[string]string
+	comment  string
+	picture  []byte
+	chapters []id3Chapter
+	toc      []string
+}
+
+type id3Chapter struct {
+	id    string
+	title string
+	start time.Duration
+	end   time.Duration
+}
+
+// id3v22Frames maps the three letter frame ids of ID3v2.2 to their v2.3
+// counterparts so the rest of the code only deals with one set.
+var id3v22Frames = map[string]string{
+	"TT2": "TIT2",
+	"TP1": "TPE1",
+	"TP2": "TPE2",
+	"TAL": "TALB",
+	"TCM": "TCOM",
+	"TLA": "TLAN",
+	"TPB": "TPUB",
+	"TCO": "TCON",
+	"TYE": "TYER",
+	"TLE": "TLEN",
+	"TRK": "TRCK",
+	"TXX": "TXXX",
+	"COM": "COMM",
+	"PIC": "APIC",
+}
+
+// readID3 parses the ID3v2 tag at the start of r.
+func readID3(r io.ReaderAt) (*id3Tag, error) {
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, errNoID3
+	}
+	if string(header[:3]) != "ID3" {
+		return nil, errNoID3
+	}
+
+	major := header[3]
+	flags := header[5]
+	size := syncsafe(header[6:10])
+
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, 10); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	t := &id3Tag{
+		size: int64(size) + 10,
+		text: make(map[string]string),
+		user: make(map[string]string),
+	}
+	if flags&0x10 != 0 {
+		t.size += 10 // footer
+	}
+
+	if major < 4 && flags&0x80 != 0 {
+		data = unsynchronise(data)
+	}
+	if flags&0x40 != 0 && len(data) >= 4 {
+		// skip the extended header
+		n := int(binary.BigEndian.Uint32(data[:4]))
+		if major == 4 {
+			n = int(syncsafe(data[:4]))
+		} else {
+			n += 4
+		}
+		if n > len(data) {
+			return t, nil
+		}
+		data = data[n:]
+	}
+
+	t.parseFrames(data, major)
+	return t, nil
+}
+
+func (t *id3Tag) parseFrames(data []byte, major byte) {
+	headerLen := 10
+	if major == 2 {
+		headerLen = 6
+	}
+
+	for len(data) >= headerLen {
+		var id string
+		var size int
+		var formatFlags byte
+		if major == 2 {
+			id = string(data[:3])
+			size = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		} else {
+			id = string(data[:4])
+			if major == 4 {
+				size = int(syncsafe(data[4:8]))
+			} else {
+				size = int(binary.BigEndian.Uint32(data[4:8]))
+			}
+			formatFlags = data[9]
+		}
+		if id[0] == 0 || size <= 0 || headerLen+size > len(data) {
+			return
+		}
+
+		body := data[headerLen : headerLen+size]
+		data = data[headerLen+size:]
+
+		if major == 2 {
+			v3, ok := id3v22Frames[id]
+			if !ok {
+				continue
+			}
+			id = v3
+		}
+		if major == 4 {
+			if formatFlags&0x01 != 0 && len(body) >= 4 {
+				body = body[4:] // data length indicator
+			}
+			if formatFlags&0x02 != 0 {
+				body = unsynchronise(body)
+			}
+		}
+
+		t.parseFrame(id, body, major)
+	}
+}
+
+func (t *id3Tag) parseFrame(id string, body []byte, major byte) {
+	switch {
+	case id == "TXXX":
+		if len(body) < 1 {
+			return
+		}
+		desc, value := splitEncoded(body[0], body[1:])
+		t.user[strings.ToUpper(decodeText(body[0], desc))] = decodeText(body[0], value)
+	case id[0] == 'T':
+		if len(body) < 1 {
+			return
+		}
+		t.text[id] = decodeText(body[0], body[1:])
+	case id == "COMM":
+		if len(body) < 4 {
+			return
+		}
+		_, value := splitEncoded(body[0], body[4:])
+		if t.comment == "" {
+			t.comment = decodeText(body[0], value)
+		}
+	case id == "APIC":
+		if t.picture != nil || len(body) < 2 {
+			return
+		}
+		enc := body[0]
+		rest := body[1:]
+		if major == 2 {
+			if len(rest) < 4 {
+				return
+			}
+			rest = rest[3:] // image format
+		} else {
+			i := bytes.IndexByte(rest, 0)
+			if i < 0 {
+				return
+			}
+			rest = rest[i+1:] // mime type
+		}
+		if len(rest) < 1 {
+			return
+		}
+		_, data := splitEncoded(enc, rest[1:]) // picture type, description
+		t.picture = data
+	case id == "CHAP":
+		t.parseChapter(body, major)
+	case id == "CTOC":
+		t.parseTOC(body)
+	}
+}
+
+func (t *id3Tag) parseChapter(body []byte, major byte) {
+	i := bytes.IndexByte(body, 0)
+	if i < 0 || len(body) < i+17 {
+		return
+	}
+
+	c := id3Chapter{id: string(body[:i])}
+	times := body[i+1:]
+	c.start = time.Duration(binary.BigEndian.Uint32(times[0:4])) * time.Millisecond
+	c.end = time.Duration(binary.BigEndian.Uint32(times[4:8])) * time.Millisecond
+
+	sub := &id3Tag{text: make(map[string]string), user: make(map[string]string)}
+	sub.parseFrames(times[16:], major)
+	c.title = sub.text["TIT2"]
+
+	t.chapters = append(t.chapters, c)
+}
+
+func (t *id3Tag) parseTOC(body []byte) {
+	i := bytes.IndexByte(body, 0)
+	if i < 0 || len(body) < i+3 {
+		return
+	}
+	flags := body[i+1]
+	count := int(body[i+2])
+	if flags&0x02 == 0 && t.toc != nil {
+		return // prefer the top level table of contents
+	}
+
+	rest := body[i+3:]
+	toc := make([]string, 0, count)
+	for n := 0; n < count; n++ {
+		j := bytes.IndexByte(rest, 0)
+		if j < 0 {
+			break
+		}
+		toc = append(toc, string(rest[:j]))
+		rest = rest[j+1:]
+	}
+	t.toc = toc
+}
+
+// orderedChapters returns the chapters in table of contents order, or by start
+// time when the tag has no CTOC frame.
+func (t *id3Tag) orderedChapters() []id3Chapter {
+	if len(t.toc) == 0 {
+		chapters := append([]id3Chapter(nil), t.chapters...)
+		sort.SliceStable(chapters, func(i, j int) bool {
+			return chapters[i].start < chapters[j].start
+		})
+		return chapters
+	}
+
+	byID := make(map[string]id3Chapter, len(t.chapters))
+	for _, c := range t.chapters {
+		byID[c.id] = c
+	}
+	chapters := make([]id3Chapter, 0, len(t.toc))
+	for _, id := range t.toc {
+		if c, ok := byID[id]; ok {
+			chapters = append(chapters, c)
+		}
+	}
+	return chapters
+}
+
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// unsynchronise reverts the ID3 unsynchronisation scheme, which inserts a zero
+// byte after every 0xff.
+func unsynchronise(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// splitEncoded splits b at the first string terminator of encoding enc.
+func splitEncoded(enc byte, b []byte) ([]byte, []byte) {
+	if enc == 1 || enc == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[:i], b[i+2:]
+			}
+		}
+		return b, nil
+	}
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return b, nil
+	}
+	return b[:i], b[i+1:]
+}
+
+// decodeText converts an ID3 text field to UTF-8. Multiple values are joined
+// with a comma.
+func decodeText(enc byte, b []byte) string {
+	var s string
+	switch enc {
+	case 0:
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		s = string(r)
+	case 1, 2:
+		bigEndian := enc == 2
+		if len(b) >= 2 {
+			switch {
+			case b[0] == 0xfe && b[1] == 0xff:
+				bigEndian, b = true, b[2:]
+			case b[0] == 0xff && b[1] == 0xfe:
+				bigEndian, b = false, b[2:]
+			}
+		}
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			if bigEndian {
+				u[i] = binary.BigEndian.Uint16(b[2*i:])
+			} else {
+				u[i] = binary.LittleEndian.Uint16(b[2*i:])
+			}
+		}
+		s = string(utf16.Decode(u))
+	default:
+		s = string(b)
+	}
+
+	s = strings.ReplaceAll(s, "\ufeff", "")
+	s = strings.TrimRight(s, "\x00")
+	s = strings.ReplaceAll(s, "\x00", ", ")
+	return strings.TrimSpace(s)
+}
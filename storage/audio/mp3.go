@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// maxSyncSearch bounds how far past the tag we look for the first frame.
+const maxSyncSearch = 64 * 1024
+
+var mpegBitrates = [2][3][16]int{
+	{ // MPEG 1, layer I, II, III
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{ // MPEG 2 and 2.5, layer I, II, III
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+var mpegSampleRates = map[byte][3]int{
+	3: {44100, 48000, 32000}, // MPEG 1
+	2: {22050, 24000, 16000}, // MPEG 2
+	0: {11025, 12000, 8000},  // MPEG 2.5
+}
+
+// mp3Duration estimates the playing time of the MPEG audio stream in r, which
+// is size bytes long and starts at offset. A Xing, Info or VBRI header gives an
+// exact frame count; otherwise the bitrate of the first frame is assumed
+// constant.
+func mp3Duration(r io.ReaderAt, offset, size int64) time.Duration {
+	buf := make([]byte, maxSyncSearch)
+	n, _ := r.ReadAt(buf, offset)
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xff || buf[i+1]&0xe0 != 0xe0 {
+			continue
+		}
+
+		version := (buf[i+1] >> 3) & 0x03
+		layer := (buf[i+1] >> 1) & 0x03
+		bitrateIndex := buf[i+2] >> 4
+		rateIndex := (buf[i+2] >> 2) & 0x03
+		mono := buf[i+3]>>6 == 3
+		if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			continue
+		}
+
+		table := 0
+		if version != 3 {
+			table = 1
+		}
+		bitrate := mpegBitrates[table][3-layer][bitrateIndex] * 1000
+		sampleRate := mpegSampleRates[version][rateIndex]
+
+		samples := 1152
+		switch {
+		case layer == 3: // layer I
+			samples = 384
+		case layer == 1 && version != 3: // layer III, MPEG 2 and 2.5
+			samples = 576
+		}
+
+		// seconds are computed as floats, as nanoseconds times the size of
+		// a long stream overflow
+		if frames := vbrFrames(buf[i:], version, mono); frames > 0 {
+			return seconds(float64(frames) * float64(samples) / float64(sampleRate))
+		}
+
+		audio := size - offset - int64(i)
+		return seconds(float64(audio) * 8 / float64(bitrate))
+	}
+	return 0
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// vbrFrames returns the frame count of a Xing, Info or VBRI header in the
+// first frame, or zero.
+func vbrFrames(frame []byte, version byte, mono bool) uint32 {
+	side := 32
+	switch {
+	case version == 3 && mono:
+		side = 17
+	case version != 3 && mono:
+		side = 9
+	case version != 3:
+		side = 17
+	}
+
+	xing := 4 + side
+	if len(frame) >= xing+12 {
+		tag := string(frame[xing : xing+4])
+		if (tag == "Xing" || tag == "Info") && frame[xing+7]&0x01 != 0 {
+			return binary.BigEndian.Uint32(frame[xing+8 : xing+12])
+		}
+	}
+
+	const vbri = 4 + 32
+	if len(frame) >= vbri+18 && string(frame[vbri:vbri+4]) == "VBRI" {
+		return binary.BigEndian.Uint32(frame[vbri+14 : vbri+18])
+	}
+	return 0
+}
@@ -0,0 +1,422 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errNoMP4 = errors.New("audio: not an mp4 file")
+
+// maxAtomRead bounds the size of a single atom read into memory.
+const maxAtomRead = 32 << 20
+
+// mp4Tags holds the iTunes style metadata and chapters of an MP4 file.
+type mp4Tags struct {
+	text     map[string]string
+	picture  []byte
+	duration time.Duration
+	chapters []mp4Chapter
+}
+
+type mp4Chapter struct {
+	title string
+	start time.Duration
+}
+
+// mp4Track is the subset of a trak atom needed to read a chapter text track.
+// Sample tables are only remembered by position since audio tracks can have
+// millions of samples; they are parsed for the chapter track alone.
+type mp4Track struct {
+	id        uint32
+	timescale uint32
+	chapRefs  []uint32
+	tables    map[string]atom
+}
+
+type stscEntry struct {
+	firstChunk      uint32
+	samplesPerChunk uint32
+}
+
+type atom struct {
+	typ    string
+	offset int64 // start of the payload
+	size   int64 // payload size
+}
+
+// containers are the atoms that only hold other atoms.
+var containers = map[string]struct{}{
+	"moov": {}, "udta": {}, "ilst": {}, "trak": {}, "mdia": {},
+	"minf": {}, "stbl": {}, "tref": {}, "edts": {},
+}
+
+// readMP4 walks the atom tree of r, which is size bytes long.
+func readMP4(r io.ReaderAt, size int64) (*mp4Tags, error) {
+	first, err := readAtomHeader(r, 0, size)
+	if err != nil || first.typ != "ftyp" {
+		return nil, errNoMP4
+	}
+
+	t := &mp4Tags{text: make(map[string]string)}
+	var tracks []*mp4Track
+	var track *mp4Track
+
+	var walk func(start, end int64, parent string) error
+	walk = func(start, end int64, parent string) error {
+		for pos := start; pos+8 <= end; {
+			a, err := readAtomHeader(r, pos, end)
+			if err != nil {
+				return err
+			}
+			pos = a.offset + a.size
+
+			if parent == "ilst" {
+				t.readItem(r, a)
+				continue
+			}
+
+			switch a.typ {
+			case "trak":
+				track = &mp4Track{}
+				tracks = append(tracks, track)
+				err := walk(a.offset, a.offset+a.size, a.typ)
+				track = nil
+				if err != nil {
+					return err
+				}
+				continue
+			case "meta":
+				// meta is a full box: skip version and flags
+				if err := walk(a.offset+4, a.offset+a.size, a.typ); err != nil {
+					return err
+				}
+				continue
+			case "mvhd":
+				t.readMovieHeader(r, a)
+			case "chpl":
+				t.readNeroChapters(r, a)
+			}
+			if track != nil {
+				track.read(r, a, parent)
+			}
+
+			if _, ok := containers[a.typ]; ok {
+				if err := walk(a.offset, a.offset+a.size, a.typ); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := walk(0, size, ""); err != nil {
+		return nil, err
+	}
+
+	if len(t.chapters) == 0 {
+		t.chapters = quickTimeChapters(r, tracks)
+	}
+	return t, nil
+}
+
+func readAtomHeader(r io.ReaderAt, pos, end int64) (atom, error) {
+	var h [16]byte
+	if _, err := r.ReadAt(h[:8], pos); err != nil {
+		return atom{}, err
+	}
+
+	a := atom{typ: string(h[4:8]), offset: pos + 8}
+	size := int64(binary.BigEndian.Uint32(h[:4]))
+	switch size {
+	case 0:
+		size = end - pos
+	case 1:
+		if _, err := r.ReadAt(h[8:16], pos+8); err != nil {
+			return atom{}, err
+		}
+		size = int64(binary.BigEndian.Uint64(h[8:16]))
+		a.offset += 8
+	}
+
+	a.size = pos + size - a.offset
+	if size < 8 || pos+size > end || a.size < 0 {
+		return atom{}, errNoMP4
+	}
+	return a, nil
+}
+
+func readAtom(r io.ReaderAt, a atom) []byte {
+	if a.size > maxAtomRead {
+		return nil
+	}
+	b := make([]byte, a.size)
+	if _, err := r.ReadAt(b, a.offset); err != nil && err != io.EOF {
+		return nil
+	}
+	return b
+}
+
+// readItem reads one ilst entry: either a well-known atom like ©nam or a
+// freeform "----" atom with mean, name and data children.
+func (t *mp4Tags) readItem(r io.ReaderAt, item atom) {
+	b := readAtom(r, item)
+
+	var name string
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b[:4]))
+		if size < 8 || size > len(b) {
+			return
+		}
+		typ := string(b[4:8])
+		payload := b[8:size]
+		b = b[size:]
+
+		switch typ {
+		case "name":
+			if len(payload) > 4 {
+				name = strings.ToUpper(string(payload[4:]))
+			}
+		case "data":
+			if len(payload) < 8 {
+				continue
+			}
+			kind := binary.BigEndian.Uint32(payload[:4]) & 0xffffff
+			value := payload[8:]
+			switch {
+			case item.typ == "covr":
+				if t.picture == nil {
+					t.picture = value
+				}
+			case item.typ == "----" && name != "":
+				t.text["----:"+name] = string(value)
+			case kind == 1:
+				t.text[item.typ] = string(value)
+			}
+		}
+	}
+}
+
+func (t *mp4Tags) readMovieHeader(r io.ReaderAt, a atom) {
+	b := readAtom(r, a)
+	if len(b) < 20 {
+		return
+	}
+
+	var timescale uint32
+	var duration uint64
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return
+		}
+		timescale = binary.BigEndian.Uint32(b[20:24])
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(b[12:16])
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+	if timescale > 0 {
+		t.duration = seconds(float64(duration) / float64(timescale))
+	}
+}
+
+// readNeroChapters reads the chpl atom written by Nero and ffmpeg. Start times
+// are in units of 100ns.
+func (t *mp4Tags) readNeroChapters(r io.ReaderAt, a atom) {
+	b := readAtom(r, a)
+	if len(b) < 5 {
+		return
+	}
+
+	pos := 4
+	if b[0] == 1 {
+		pos += 4
+	}
+	if pos >= len(b) {
+		return
+	}
+	count := int(b[pos])
+	pos++
+
+	for i := 0; i < count && pos+9 <= len(b); i++ {
+		start := binary.BigEndian.Uint64(b[pos : pos+8])
+		n := int(b[pos+8])
+		pos += 9
+		if pos+n > len(b) {
+			return
+		}
+		t.chapters = append(t.chapters, mp4Chapter{
+			title: string(b[pos : pos+n]),
+			start: time.Duration(start) * 100,
+		})
+		pos += n
+	}
+}
+
+func (tr *mp4Track) read(r io.ReaderAt, a atom, parent string) {
+	switch {
+	case a.typ == "tkhd":
+		p := readAtom(r, a)
+		if len(p) >= 24 && p[0] == 1 {
+			tr.id = binary.BigEndian.Uint32(p[20:24])
+		} else if len(p) >= 16 {
+			tr.id = binary.BigEndian.Uint32(p[12:16])
+		}
+	case a.typ == "chap" && parent == "tref":
+		p := readAtom(r, a)
+		for i := 0; i+4 <= len(p); i += 4 {
+			tr.chapRefs = append(tr.chapRefs, binary.BigEndian.Uint32(p[i:i+4]))
+		}
+	case a.typ == "mdhd":
+		p := readAtom(r, a)
+		if len(p) >= 24 && p[0] == 1 {
+			tr.timescale = binary.BigEndian.Uint32(p[20:24])
+		} else if len(p) >= 16 {
+			tr.timescale = binary.BigEndian.Uint32(p[12:16])
+		}
+	case parent == "stbl":
+		if tr.tables == nil {
+			tr.tables = make(map[string]atom)
+		}
+		tr.tables[a.typ] = a
+	}
+}
+
+// sampleTable is the decoded stbl of a chapter track.
+type sampleTable struct {
+	durations []uint32 // one entry per sample
+	sizes     []uint32
+	offsets   []int64 // one entry per chunk
+	chunks    []stscEntry
+}
+
+// maxChapterSamples bounds the number of chapters read from a text track.
+const maxChapterSamples = 1 << 14
+
+func (tr *mp4Track) sampleTable(r io.ReaderAt) *sampleTable {
+	st := &sampleTable{}
+
+	p := readAtom(r, tr.tables["stts"])
+	for i := 8; i+8 <= len(p); i += 8 {
+		count := binary.BigEndian.Uint32(p[i : i+4])
+		delta := binary.BigEndian.Uint32(p[i+4 : i+8])
+		for n := uint32(0); n < count && len(st.durations) < maxChapterSamples; n++ {
+			st.durations = append(st.durations, delta)
+		}
+	}
+
+	if p = readAtom(r, tr.tables["stsz"]); len(p) >= 12 {
+		fixed := binary.BigEndian.Uint32(p[4:8])
+		count := binary.BigEndian.Uint32(p[8:12])
+		for i := uint32(0); i < count && i < maxChapterSamples; i++ {
+			if fixed != 0 {
+				st.sizes = append(st.sizes, fixed)
+				continue
+			}
+			o := 12 + 4*int(i)
+			if o+4 > len(p) {
+				break
+			}
+			st.sizes = append(st.sizes, binary.BigEndian.Uint32(p[o:o+4]))
+		}
+	}
+
+	p = readAtom(r, tr.tables["stsc"])
+	for i := 8; i+12 <= len(p); i += 12 {
+		st.chunks = append(st.chunks, stscEntry{
+			firstChunk:      binary.BigEndian.Uint32(p[i : i+4]),
+			samplesPerChunk: binary.BigEndian.Uint32(p[i+4 : i+8]),
+		})
+	}
+
+	if a, ok := tr.tables["co64"]; ok {
+		p = readAtom(r, a)
+		for i := 8; i+8 <= len(p); i += 8 {
+			st.offsets = append(st.offsets, int64(binary.BigEndian.Uint64(p[i:i+8])))
+		}
+	} else {
+		p = readAtom(r, tr.tables["stco"])
+		for i := 8; i+4 <= len(p); i += 4 {
+			st.offsets = append(st.offsets, int64(binary.BigEndian.Uint32(p[i:i+4])))
+		}
+	}
+	return st
+}
+
+// sampleOffsets resolves the file offset of every sample in the table.
+func (st *sampleTable) sampleOffsets() []int64 {
+	var offsets []int64
+	sample := 0
+	for c, chunkOffset := range st.offsets {
+		chunk := uint32(c + 1)
+		perChunk := uint32(0)
+		for _, e := range st.chunks {
+			if e.firstChunk > chunk {
+				break
+			}
+			perChunk = e.samplesPerChunk
+		}
+
+		pos := chunkOffset
+		for n := uint32(0); n < perChunk && sample < len(st.sizes); n++ {
+			offsets = append(offsets, pos)
+			pos += int64(st.sizes[sample])
+			sample++
+		}
+	}
+	return offsets
+}
+
+// quickTimeChapters reads the text track referenced by a tref/chap atom, as
+// written by iTunes and most m4b tools.
+func quickTimeChapters(r io.ReaderAt, tracks []*mp4Track) []mp4Chapter {
+	byID := make(map[uint32]*mp4Track, len(tracks))
+	for _, tr := range tracks {
+		byID[tr.id] = tr
+	}
+
+	var text *mp4Track
+	for _, tr := range tracks {
+		for _, ref := range tr.chapRefs {
+			if t, ok := byID[ref]; ok && t.timescale > 0 {
+				text = t
+				break
+			}
+		}
+	}
+	if text == nil {
+		return nil
+	}
+
+	st := text.sampleTable(r)
+
+	var chapters []mp4Chapter
+	var start uint64
+	for i, offset := range st.sampleOffsets() {
+		var title string
+		if size := st.sizes[i]; size >= 2 && size < 1<<16 {
+			b := make([]byte, size)
+			if _, err := r.ReadAt(b, offset); err == nil {
+				n := int(binary.BigEndian.Uint16(b[:2]))
+				if 2+n <= len(b) {
+					title = string(b[2 : 2+n])
+				}
+			}
+		}
+		chapters = append(chapters, mp4Chapter{
+			title: title,
+			start: seconds(float64(start) / float64(text.timescale)),
+		})
+		if i < len(st.durations) {
+			start += uint64(st.durations[i])
+		}
+	}
+
+	sort.SliceStable(chapters, func(i, j int) bool {
+		return chapters[i].start < chapters[j].start
+	})
+	return chapters
+}
@@ -0,0 +1,214 @@
+/*
+Package comic supports comic book archives: CBZ, a zip of page images, and
+CBR, a RAR of page images. Pages are read in the natural order of their
+names, so "page 2" comes before "page 10".
+*/
+package comic
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"bookarr/storage"
+
+	"github.com/nwaples/rardecode/v2"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// CBZMIMEType is the content type of a zip comic archive.
+	CBZMIMEType = "application/x-cbz"
+	// CBRMIMEType is the content type of a RAR comic archive.
+	CBRMIMEType = "application/x-cbr"
+)
+
+func init() {
+	storage.RegisterFormat(storage.Format{
+		Name:       "CBZ",
+		MIMEType:   CBZMIMEType,
+		Extensions: []string{".cbz"},
+		Extractor:  extractor{},
+	})
+	storage.RegisterFormat(storage.Format{
+		Name:       "CBR",
+		MIMEType:   CBRMIMEType,
+		Extensions: []string{".cbr"},
+		Extractor:  extractor{},
+	})
+}
+
+var pageExtensions = map[string]struct{}{
+	".jpg": {}, ".jpeg": {}, ".png": {}, ".gif": {}, ".webp": {},
+}
+
+// isPage reports whether the archive member name is a page image. Hidden
+// files and the resource forks macOS adds to archives are skipped.
+func isPage(name string) bool {
+	if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+		return false
+	}
+	_, ok := pageExtensions[strings.ToLower(path.Ext(name))]
+	return ok
+}
+
+func sortPages(names []string) {
+	sort.SliceStable(names, func(i, j int) bool { return storage.NaturalLess(names[i], names[j]) })
+}
+
+// isZip reports whether filename is a zip archive. Many .cbr files are zip
+// archives renamed, so the content decides rather than the extension.
+func isZip(filename string) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false, err
+	}
+	return bytes.Equal(header, []byte("PK\x03\x04")), nil
+}
+
+// Pages returns the names of the page images of the archive filename in
+// reading order.
+func Pages(filename string) ([]string, error) {
+	zipped, err := isZip(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if zipped {
+		r, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if !f.FileInfo().IsDir() && isPage(f.Name) {
+				names = append(names, f.Name)
+			}
+		}
+	} else {
+		files, err := rardecode.List(filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if !f.IsDir && isPage(f.Name) {
+				names = append(names, f.Name)
+			}
+		}
+	}
+	sortPages(names)
+	return names, nil
+}
+
+// OpenPage opens the page image called name in the archive filename.
+func OpenPage(filename, name string) (io.ReadCloser, error) {
+	zipped, err := isZip(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if zipped {
+		r, err := zip.OpenReader(filename)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range r.File {
+			if f.Name == name {
+				rc, err := f.Open()
+				if err != nil {
+					r.Close()
+					return nil, err
+				}
+				return &pageReader{ReadCloser: rc, archive: r}, nil
+			}
+		}
+		r.Close()
+		return nil, os.ErrNotExist
+	}
+
+	files, err := rardecode.List(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Name == name {
+			return f.Open()
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// pageReader closes the archive along with the page.
+type pageReader struct {
+	io.ReadCloser
+	archive io.Closer
+}
+
+func (r *pageReader) Close() error {
+	err := r.ReadCloser.Close()
+	if cerr := r.archive.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Comic is the metadata of a comic archive, which only knows its pages.
+type Comic struct {
+	storage.NOOPMetadata
+	Pages []string
+}
+
+func (c *Comic) GetPageCount() int { return len(c.Pages) }
+func (c *Comic) HasCover() bool    { return len(c.Pages) > 0 }
+
+type extractor struct{}
+
+func (extractor) Metadata(filename string) (storage.Metadata, error) {
+	pages, err := Pages(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &Comic{Pages: pages}, nil
+}
+
+// Cover returns the first page.
+func (extractor) Cover(filename string) (image.Image, error) {
+	pages, err := Pages(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, storage.ErrNotRecognised
+	}
+	rc, err := OpenPage(filename, pages[0])
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	img, _, err := image.Decode(rc)
+	return img, err
+}
+
+func (extractor) Pages(filename string) ([]string, error) {
+	return Pages(filename)
+}
+
+func (extractor) Page(filename, name string) (io.ReadCloser, error) {
+	return OpenPage(filename, name)
+}
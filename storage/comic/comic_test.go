@@ -0,0 +1,63 @@
+package comic
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeZip(t *testing.T, name string, files []string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for _, name := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(name))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return filename
+}
+
+func TestPages(t *testing.T) {
+	// a zip named .cbr, as often found in the wild
+	filename := writeZip(t, "issue.cbr", []string{
+		"Issue/page 10.jpg",
+		"Issue/page 2.JPG",
+		"Issue/page 1.png",
+		"__MACOSX/Issue/._page 1.png",
+		"Issue/.thumb.jpg",
+		"ComicInfo.xml",
+	})
+
+	pages, err := Pages(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Issue/page 1.png", "Issue/page 2.JPG", "Issue/page 10.jpg"}
+	if !reflect.DeepEqual(pages, want) {
+		t.Fatalf("Pages = %v, want %v", pages, want)
+	}
+
+	rc, err := OpenPage(filename, pages[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(rc)
+	if string(b) != "Issue/page 10.jpg" {
+		t.Errorf("OpenPage read %q", b)
+	}
+}
@@ -0,0 +1,94 @@
+package dir
+
+import (
+	"bookarr/storage"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// formatPreference orders the formats of a book when choosing the file
+// whose name, metadata and cover describe it.
+var formatPreference = []string{".epub", ".fb2", ".mobi", ".pdf", ".cbz", ".cbr"}
+
+func extensionRank(name string) int {
+	ext := strings.ToLower(filepath.Ext(name))
+	for i, p := range formatPreference {
+		if p == ext {
+			return i
+		}
+	}
+	return len(formatPreference)
+}
+
+// formatRank ranks files with recognised metadata first, then by preferred
+// format.
+func formatRank(e storage.Entry) int {
+	rank := extensionRank(e.Name)
+	if _, ok := e.Metadata.(*storage.NOOPMetadata); ok {
+		rank += len(formatPreference) + 1
+	}
+	return rank
+}
+
+// groupFormats merges the entries of files holding the same book, those
+// sharing a base name or an identifier, into one entry listing every
+// format. Folders are left alone.
+func groupFormats(entries []storage.Entry) []storage.Entry {
+	var out []storage.Entry
+	byKey := make(map[string]int)
+	for _, e := range entries {
+		if len(e.Files) == 0 {
+			out = append(out, e)
+			continue
+		}
+
+		keys := []string{"name:" + strings.ToLower(strings.TrimSuffix(e.Name, filepath.Ext(e.Name)))}
+		if id := strings.TrimSpace(e.Metadata.GetIdentifier()); id != "" {
+			keys = append(keys, "id:"+id)
+		}
+		i := -1
+		for _, k := range keys {
+			if j, ok := byKey[k]; ok {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			out = append(out, e)
+			i = len(out) - 1
+		} else {
+			out[i] = mergeFormats(out[i], e)
+		}
+		for _, k := range keys {
+			if _, ok := byKey[k]; !ok {
+				byKey[k] = i
+			}
+		}
+	}
+	return out
+}
+
+// mergeFormats returns the entry of the book held by the files of a and b,
+// described by the preferred one.
+func mergeFormats(a, b storage.Entry) storage.Entry {
+	primary, other := a, b
+	if formatRank(b) < formatRank(a) {
+		primary, other = b, a
+	}
+
+	files := append(append([]storage.BookFile{}, primary.Files...), other.Files...)
+	rest := files[1:]
+	sort.SliceStable(rest, func(i, j int) bool {
+		return extensionRank(rest[i].Name) < extensionRank(rest[j].Name)
+	})
+	primary.Files = files
+
+	if other.Updated.After(primary.Updated) {
+		primary.Updated = other.Updated
+	}
+	if other.Added.Before(primary.Added) {
+		primary.Added = other.Added
+	}
+	return primary
+}
@@ -0,0 +1,49 @@
+package dir
+
+import (
+	"bookarr/storage"
+	"reflect"
+	"testing"
+)
+
+type idMeta struct {
+	storage.NOOPMetadata
+	id string
+}
+
+func (m *idMeta) GetIdentifier() string { return m.id }
+
+func Test_groupFormats(t *testing.T) {
+	book := func(name string, m storage.Metadata) storage.Entry {
+		return storage.Entry{
+			Name:     name,
+			Metadata: m,
+			Files:    []storage.BookFile{{Name: name}},
+		}
+	}
+	entries := []storage.Entry{
+		{Name: "Folder", Aquisition: "subsection", Metadata: &storage.NOOPMetadata{}},
+		book("Dune.pdf", &storage.NOOPMetadata{}),
+		book("dune.epub", &idMeta{id: "urn:isbn:9780441013593"}),
+		book("dune-herbert.mobi", &idMeta{id: "urn:isbn:9780441013593"}),
+		book("Emma.epub", &idMeta{}),
+	}
+
+	got := groupFormats(entries)
+	if len(got) != 3 {
+		t.Fatalf("groupFormats returned %d entries, want 3", len(got))
+	}
+	if got[1].Name != "dune.epub" {
+		t.Errorf("primary file = %s, want dune.epub", got[1].Name)
+	}
+	var files []string
+	for _, f := range got[1].Files {
+		files = append(files, f.Name)
+	}
+	if want := []string{"dune.epub", "dune-herbert.mobi", "Dune.pdf"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+	if got[2].Name != "Emma.epub" || len(got[2].Files) != 1 {
+		t.Errorf("unrelated book merged: %+v", got[2])
+	}
+}
@@ -2,85 +2,58 @@ package dir
 
 import (
 	"bookarr/storage"
-	"bookarr/storage/epub"
-	"errors"
 	"image"
 	"log"
 )
 
-var errNotRecognised = errors.New("not recognised")
+var errNotRecognised = storage.ErrNotRecognised
 
-func addMetadata(e *storage.Entry, filename string) error {
-	switch e.Type {
-	case "application/epub+zip":
-		return addEpubMetadata(e, filename)
+// lookupExtractor finds the extractor for filename, preferring the format
+// registered for contentType and falling back to extension and content
+// sniffing.
+func lookupExtractor(filename, contentType string) storage.Extractor {
+	if f, ok := storage.LookupDirFormat(filename); ok {
+		return f.Extractor
+	}
+	if f, ok := storage.FormatByMIMEType(contentType); ok && f.Extractor != nil {
+		return f.Extractor
+	}
+	if f, ok := storage.LookupFormat(filename); ok && f.Extractor != nil {
+		return f.Extractor
 	}
+	return nil
+}
 
+func addMetadata(e *storage.Entry, filename string) error {
 	e.Metadata = &storage.NOOPMetadata{}
-	return errNotRecognised
-}
 
-func addEpubMetadata(e *storage.Entry, filename string) error {
-	e.Metadata = getEpubMetadata(filename)
-	if e.Metadata == nil {
+	ex := lookupExtractor(filename, e.Type)
+	if ex == nil {
 		return errNotRecognised
 	}
-	return nil
-}
 
-func getEpubMetadata(filename string) storage.Metadata {
-	metadata, err := epub.OpenReader(filename)
-	if err != nil {
-		return nil
+	m, err := ex.Metadata(filename)
+	if err != nil || m == nil {
+		return errNotRecognised
 	}
-	defer metadata.Close()
-	return metadata.Rootfiles[0]
+	e.Metadata = m
+	return nil
 }
 
-func getEpubCover(filename string) *image.Image {
-	epub, err := epub.OpenReader(filename)
-	if err != nil {
-		log.Printf("File OpenReader err: %s", err)
+func getCover(filename string) image.Image {
+	ex := lookupExtractor(filename, "")
+	if ex == nil {
 		return nil
 	}
-	defer epub.Close()
-	p := epub.Rootfiles[0]
-
-	cover := ""
-	for _, meta := range p.Meta {
-		if meta.Name == "cover" {
-			cover = meta.Content
-			break
-		}
-	}
-	if cover != "" {
-		for _, item := range p.Manifest.Items {
-			if item.ID == cover {
-				f, err := item.Open()
-				if err != nil {
-					log.Printf("File item.Open err: %s", err)
-					return nil
-				}
 
-				img, _, err := image.Decode(f)
-				if err != nil {
-					log.Printf("imageDecode err: %s", err)
-					return nil
-				}
-				return &img
-			}
+	img, err := ex.Cover(filename)
+	if err != nil {
+		if err != errNotRecognised {
+			log.Printf("getCover err: %s", err)
 		}
+		return nil
 	}
-	return nil
-}
-
-var supportedBookExtensions = map[string]struct{}{
-	".mobi": {},
-	".epub": {},
-	".pdf":  {},
-	".cbz":  {},
-	".cbr":  {},
-	".fb2":  {},
+	return img
 }
 
 var supportedImageExtensions = map[string]struct{}{
@@ -89,3 +62,9 @@ var supportedImageExtensions = map[string]struct{}{
 	".jpeg": {},
 	".gif":  {},
 }
+
+// isBookExtension reports whether ext belongs to a registered book format.
+func isBookExtension(ext string) bool {
+	_, ok := storage.FormatByExtension(ext)
+	return ok
+}
@@ -0,0 +1,141 @@
+package dir
+
+import (
+	"bookarr/storage"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// firstSeen records when bookarr first listed every book, which is what
+// "recently added" means to users: file modification times change when
+// books are copied around or edited.
+type firstSeen struct {
+	file string
+
+	mu    sync.Mutex
+	times map[string]time.Time
+	dirty bool
+	timer *time.Timer
+}
+
+// saveDelay is how long new records wait to be saved, so a walk over the
+// whole library writes the file once rather than once per folder.
+var saveDelay = 10 * time.Second
+
+// loadFirstSeen reads the records kept in file. An empty file name keeps
+// them in memory only. When there are no records yet, the books already in
+// rootDir are dated by modification time, so they don't all show up as new.
+func loadFirstSeen(file, rootDir string) *firstSeen {
+	s := &firstSeen{file: file, times: make(map[string]time.Time)}
+	if file == "" {
+		s.seed(rootDir)
+		return s
+	}
+
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.seed(rootDir)
+		s.save()
+		return s
+	}
+	if err != nil {
+		log.Printf("loadFirstSeen err: %s", err)
+		return s
+	}
+	if err := json.Unmarshal(b, &s.times); err != nil {
+		log.Printf("loadFirstSeen %s err: %s", file, err)
+	}
+	return s
+}
+
+// seed records every book below rootDir at its modification time.
+func (s *firstSeen) seed(rootDir string) {
+	err := filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != rootDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, ok := storage.LookupDirFormat(path); !ok {
+				return nil
+			}
+		} else if !isBookExtension(filepath.Ext(d.Name())) || fileShouldBeIgnored(d.Name()) {
+			return nil
+		}
+
+		if info, err := d.Info(); err == nil {
+			rel, _ := filepath.Rel(rootDir, path)
+			s.times["/"+filepath.ToSlash(rel)] = info.ModTime()
+			s.dirty = true
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("firstSeen seed err: %s", err)
+	}
+}
+
+// get returns when the book at path, relative to the library root, was
+// first seen, recording it now when it is new.
+func (s *firstSeen) get(path string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.times[path]; ok {
+		return t
+	}
+	t := time.Now()
+	s.times[path] = t
+	s.dirty = true
+	if s.file != "" && s.timer == nil {
+		s.timer = time.AfterFunc(saveDelay, s.save)
+	}
+	return t
+}
+
+// save writes the records when books were added since the last save. It
+// runs by itself saveDelay after a book is first seen.
+func (s *firstSeen) save() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if !s.dirty || s.file == "" {
+		return
+	}
+
+	b, err := json.Marshal(s.times)
+	if err != nil {
+		log.Printf("firstSeen save err: %s", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.file), 0o755); err != nil {
+		log.Printf("firstSeen save err: %s", err)
+		return
+	}
+	tmp := s.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		log.Printf("firstSeen save err: %s", err)
+		return
+	}
+	if err := os.Rename(tmp, s.file); err != nil {
+		log.Printf("firstSeen save err: %s", err)
+		return
+	}
+	s.dirty = false
+}
@@ -0,0 +1,66 @@
+package dir
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_firstSeen(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(t.TempDir(), "first-seen.json")
+
+	old := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	book := filepath.Join(root, "old.epub")
+	if err := os.WriteFile(book, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(book, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	s := loadFirstSeen(file, root)
+	if got := s.get("/old.epub"); !got.Equal(old) {
+		t.Errorf("existing book first seen %s, want modification time %s", got, old)
+	}
+
+	added := s.get("/new.epub")
+	if time.Since(added) > time.Minute {
+		t.Errorf("new book first seen %s, want now", added)
+	}
+	s.save()
+
+	s = loadFirstSeen(file, root)
+	if got := s.get("/new.epub"); !got.Equal(added) {
+		t.Errorf("reloaded first seen %s, want %s", got, added)
+	}
+}
+
+func Test_firstSeenDelayedSave(t *testing.T) {
+	defer func(d time.Duration) { saveDelay = d }(saveDelay)
+	saveDelay = 50 * time.Millisecond
+
+	root := t.TempDir()
+	file := filepath.Join(t.TempDir(), "first-seen.json")
+	s := loadFirstSeen(file, root)
+	for _, p := range []string{"/a.epub", "/b.epub", "/c.epub"} {
+		s.get(p)
+	}
+	if _, err := os.Stat(file); err == nil {
+		t.Error("first seen saved right away")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var times map[string]time.Time
+		if b, err := os.ReadFile(file); err == nil && json.Unmarshal(b, &times) == nil && len(times) == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("new books were never saved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
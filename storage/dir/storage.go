@@ -4,7 +4,6 @@ import (
 	"bookarr/storage"
 	"bufio"
 	"bytes"
-	"image"
 	_ "image/gif"
 	"image/jpeg"
 	_ "image/png"
@@ -13,19 +12,36 @@ import (
 	"mime"
 	"os"
 	"path/filepath"
-	"sort"
 )
 
 type fileStore struct {
-	rootDir string
+	rootDir   string
+	seenFile  string
+	firstSeen *firstSeen
 }
 
-func NewFileStore(rootDir string) storage.Store {
+// Option configures optional features of the store.
+type Option func(*fileStore)
+
+// WithFirstSeenFile keeps the time every book was first seen in file, so it
+// survives restarts and is used as the date the book was added.
+func WithFirstSeenFile(file string) Option {
+	return func(fs *fileStore) {
+		fs.seenFile = file
+	}
+}
+
+func NewFileStore(rootDir string, opts ...Option) storage.Store {
 	rootDir, err := absoluteCanonicalPath(rootDir)
 	if err != nil {
 		log.Fatal(err)
 	}
-	return &fileStore{rootDir: rootDir}
+	fs := &fileStore{rootDir: rootDir}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	fs.firstSeen = loadFirstSeen(fs.seenFile, rootDir)
+	return fs
 }
 
 func (fs *fileStore) File(path string) *storage.File {
@@ -53,10 +69,11 @@ func (fs *fileStore) File(path string) *storage.File {
 		Reader:        f,
 		ContentType:   mime.TypeByExtension(filepath.Ext(safePath)),
 		ContentLength: stat.Size(),
+		ModTime:       stat.ModTime(),
 	}
 }
 
-func (fs *fileStore) List(path string) ([]storage.Entry, error) {
+func (fs *fileStore) List(path string, opts storage.ListOptions) ([]storage.Entry, error) {
 	fPath := filepath.Join(fs.rootDir, path)
 
 	safePath, err := verifyPath(fPath, fs.rootDir)
@@ -72,96 +89,101 @@ func (fs *fileStore) List(path string) ([]storage.Entry, error) {
 		if !entry.IsDir() && fileShouldBeIgnored(entry.Name()) {
 			continue
 		}
-		filename := filepath.Join(safePath, entry.Name())
-		pathType := getPathType(filename)
 		info, err := entry.Info()
 		if err != nil {
 			continue
 		}
-		e := storage.Entry{
-			Name:       entry.Name(),
-			Type:       getMimeType(entry.Name(), pathType),
-			Aquisition: getRel(entry.Name(), pathType),
-			Updated:    info.ModTime(),
-		}
 
-		if err := addMetadata(&e, filename); err != nil {
-			if err != errNotRecognised {
-				log.Printf("addMetadata err: %s", err)
-				continue
-			}
+		e, err := fs.newEntry(filepath.Join(safePath, entry.Name()), info)
+		if err != nil {
+			log.Printf("addMetadata err: %s", err)
+			continue
 		}
-
 		entries = append(entries, e)
 	}
 
-	sortEntries(&entries)
-	return entries, nil
-}
-
-func sortEntries(entries *[]storage.Entry) {
-	sortByName(entries)
-	sortByAuthor(entries)
-}
+	grouped := entries[:0]
+	for _, e := range groupFormats(entries) {
+		if opts.Match(e) {
+			grouped = append(grouped, e)
+		}
+	}
+	entries = grouped
 
-func sortByName(entries *[]storage.Entry) {
-	sortEntriesBy(entries, func(a, b storage.Entry) bool {
-		return a.Name < b.Name
-	})
+	storage.SortEntries(entries, opts.Sort)
+	return entries, nil
 }
 
-func sortByAuthor(entries *[]storage.Entry) {
-	sortEntriesBy(entries, func(a, b storage.Entry) bool {
-		as := a.Metadata.GetCreator()
-		bs := b.Metadata.GetCreator()
-		return as < bs
-	})
-}
+func (fs *fileStore) Entry(path string) (*storage.Entry, error) {
+	fPath := filepath.Join(fs.rootDir, path)
 
-func sortEntriesBy(entries *[]storage.Entry, less func(a, b storage.Entry) bool) {
-	sorter := &entrySorter{
-		entries: *entries,
-		less:    less,
+	safePath, err := verifyPath(fPath, fs.rootDir)
+	if err != nil {
+		log.Printf("File verifyPath err: %s", err)
+		return nil, err
 	}
-	sort.Sort(sorter)
-}
 
-type entrySorter struct {
-	entries []storage.Entry
-	less    func(a, b storage.Entry) bool
-}
+	info, err := os.Stat(safePath)
+	if err != nil {
+		return nil, err
+	}
 
-func (s *entrySorter) Len() int {
-	return len(s.entries)
+	e, err := fs.newEntry(safePath, info)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
 }
 
-func (s *entrySorter) Swap(i, j int) {
-	s.entries[i], s.entries[j] = s.entries[j], s.entries[i]
-}
+// newEntry builds the listing entry of filename, reading its metadata when
+// the format is recognised.
+func (fs *fileStore) newEntry(filename string, info os.FileInfo) (storage.Entry, error) {
+	pathType := getPathType(filename)
+	e := storage.Entry{
+		Name:       info.Name(),
+		Type:       getMimeType(info.Name(), pathType),
+		Aquisition: getRel(info.Name(), pathType),
+		Updated:    info.ModTime(),
+		Added:      info.ModTime(),
+		Metadata:   &storage.NOOPMetadata{},
+	}
+	if info.IsDir() && pathType != storage.PathTypeAudiobook {
+		return e, nil
+	}
+	if !info.IsDir() && e.Aquisition == "http://opds-spec.org/acquisition" {
+		e.Files = []storage.BookFile{{Name: e.Name, Type: e.Type, Length: info.Size()}}
+	}
+	if e.Aquisition == "http://opds-spec.org/acquisition" {
+		if rel, err := filepath.Rel(fs.rootDir, filename); err == nil {
+			e.Added = fs.firstSeen.get("/" + filepath.ToSlash(rel))
+		}
+	}
 
-func (s *entrySorter) Less(i, j int) bool {
-	return s.less(s.entries[i], s.entries[j])
+	if err := addMetadata(&e, filename); err != nil && err != errNotRecognised {
+		return e, err
+	}
+	return e, nil
 }
 
 func (fs *fileStore) Cover(path string) *storage.File {
 	fPath := filepath.Join(fs.rootDir, path)
-	ext := filepath.Ext(fPath)
-	if _, ok := supportedBookExtensions[ext]; !ok {
-		return nil
-	}
-
 	safePath, err := verifyPath(fPath, fs.rootDir)
 	if err != nil {
 		log.Printf("File verifyPath err: %s", err)
 		return nil
 	}
 
-	var cover *image.Image
-	switch ext {
-	case ".epub":
-		cover = getEpubCover(safePath)
+	ext := filepath.Ext(safePath)
+	if !isBookExtension(ext) && getPathType(safePath) != storage.PathTypeAudiobook {
+		return nil
+	}
+
+	stat, err := os.Stat(safePath)
+	if err != nil {
+		return nil
 	}
 
+	cover := getCover(safePath)
 	if cover == nil {
 		return nil
 	}
@@ -169,16 +191,61 @@ func (fs *fileStore) Cover(path string) *storage.File {
 	var b bytes.Buffer
 	w := bufio.NewWriter(&b)
 
-	if err := jpeg.Encode(w, *cover, nil); err != nil {
+	if err := jpeg.Encode(w, cover, nil); err != nil {
 		return nil
 	}
 
-	r := bufio.NewReader(&b)
-	rc := io.NopCloser(r)
 	return &storage.File{
-		Reader:        rc,
+		Reader:        storage.NopSeekCloser(bytes.NewReader(b.Bytes())),
 		ContentType:   mime.TypeByExtension(".jpeg"), // "image/jpeg
 		ContentLength: int64(b.Len()),
+		ModTime:       stat.ModTime(),
+	}
+}
+
+func (fs *fileStore) Page(path string, n int) *storage.File {
+	fPath := filepath.Join(fs.rootDir, path)
+	safePath, err := verifyPath(fPath, fs.rootDir)
+	if err != nil {
+		log.Printf("File verifyPath err: %s", err)
+		return nil
+	}
+
+	ex, ok := lookupExtractor(safePath, "").(storage.PageExtractor)
+	if !ok {
+		return nil
+	}
+	stat, err := os.Stat(safePath)
+	if err != nil {
+		return nil
+	}
+	pages, err := ex.Pages(safePath)
+	if err != nil {
+		log.Printf("Page Pages err: %s", err)
+		return nil
+	}
+	if n < 0 || n >= len(pages) {
+		return nil
+	}
+
+	rc, err := ex.Page(safePath, pages[n])
+	if err != nil {
+		log.Printf("Page err: %s", err)
+		return nil
+	}
+	defer rc.Close()
+
+	// pages are small, reading them lets us tell the length
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		log.Printf("Page read err: %s", err)
+		return nil
+	}
+	return &storage.File{
+		Reader:        storage.NopSeekCloser(bytes.NewReader(b)),
+		ContentType:   mime.TypeByExtension(filepath.Ext(pages[n])),
+		ContentLength: int64(len(b)),
+		ModTime:       stat.ModTime(),
 	}
 }
 
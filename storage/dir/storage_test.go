@@ -0,0 +1,49 @@
+package dir
+
+import (
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"bookarr/storage"
+)
+
+func Test_fileStoreListFormat(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"book.epub", "book.pdf", "other.pdf"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte("not a real book"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := NewFileStore(root)
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"", []string{"book.epub", "other.pdf"}},
+		{mime.TypeByExtension(".epub"), []string{"book.epub"}},
+		{mime.TypeByExtension(".pdf"), []string{"book.epub", "other.pdf"}},
+		{"application/x-cbz", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			entries, err := fs.List("/", storage.ListOptions{Format: tt.format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name)
+				if e.Name == "book.epub" && len(e.Files) != 2 {
+					t.Errorf("book.epub has %d files, want both formats", len(e.Files))
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("List(Format: %q) = %v, want %v", tt.format, got, tt.want)
+			}
+		})
+	}
+}
@@ -23,7 +23,7 @@ func fileShouldBeIgnored(filename string) bool {
 	}
 
 	ext := filepath.Ext(filename)
-	if _, ok := supportedBookExtensions[ext]; ok {
+	if isBookExtension(ext) {
 		return includeFile
 	}
 	if _, ok := supportedImageExtensions[ext]; ok {
@@ -34,6 +34,9 @@ func fileShouldBeIgnored(filename string) bool {
 }
 
 func getRel(filename string, pathType storage.PathType) string {
+	if pathType == storage.PathTypeAudiobook {
+		return "http://opds-spec.org/acquisition"
+	}
 	if pathType == storage.PathTypeAquisition || pathType == storage.PathTypeNavigation {
 		return "subsection"
 	}
@@ -55,6 +58,8 @@ func getMimeType(name string, pathType storage.PathType) string {
 		return "application/atom+xml;profile=opds-catalog;kind=acquisition"
 	case storage.PathTypeNavigation:
 		return "application/atom+xml;profile=opds-catalog;kind=navigation"
+	case storage.PathTypeAudiobook:
+		return string(storage.PathTypeAudiobook)
 	default:
 		return mime.TypeByExtension(".xml")
 	}
@@ -71,6 +76,10 @@ func getPathType(dirpath string) storage.PathType {
 		return storage.PathTypeFile
 	}
 
+	if _, ok := storage.LookupDirFormat(dirpath); ok {
+		return storage.PathTypeAudiobook
+	}
+
 	dirEntries, err := os.ReadDir(dirpath)
 	if err != nil {
 		log.Printf("getPathType: readDir err: %s", err)
@@ -78,7 +87,11 @@ func getPathType(dirpath string) storage.PathType {
 	}
 
 	for _, entry := range dirEntries {
-		if entry.IsDir() {
+		if !entry.IsDir() {
+			continue
+		}
+		// folders holding a single book are entries, not subsections
+		if _, ok := storage.LookupDirFormat(filepath.Join(dirpath, entry.Name())); !ok {
 			return storage.PathTypeNavigation
 		}
 	}
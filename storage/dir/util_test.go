@@ -4,6 +4,8 @@ import (
 	"os"
 	"testing"
 	"time"
+
+	_ "bookarr/storage/epub" // list EPUB files as books
 )
 
 func Test_verifyPath(t *testing.T) {
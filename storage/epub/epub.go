@@ -11,6 +11,10 @@ import (
 	"io"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+
+	"bookarr/storage"
 )
 
 const containerPath = "META-INF/container.xml"
@@ -62,6 +66,8 @@ type Container struct {
 
 // Package represents an epub content.opf file.
 type Package struct {
+	// UniqueIdentifier is the id of the identifier element naming the book.
+	UniqueIdentifier string `xml:"unique-identifier,attr"`
 	Metadata
 	Manifest
 	Spine
@@ -69,22 +75,25 @@ type Package struct {
 
 // Metadata contains publishing information about the epub.
 type Metadata struct {
-	Title       string `xml:"metadata>title"`
-	Language    string `xml:"metadata>language"`
-	Identifier  string `xml:"metadata>idenifier"`
-	Creator     string `xml:"metadata>creator"`
-	Contributor string `xml:"metadata>contributor"`
-	Publisher   string `xml:"metadata>publisher"`
-	Subject     string `xml:"metadata>subject"`
-	Description string `xml:"metadata>description"`
-	Event       []struct {
+	Title        string       `xml:"metadata>title"`
+	Language     string       `xml:"metadata>language"`
+	Identifiers  []Identifier `xml:"metadata>identifier"`
+	Creators     []Creator    `xml:"metadata>creator"`
+	Contributors []Creator    `xml:"metadata>contributor"`
+	Publisher    string       `xml:"metadata>publisher"`
+	Subjects     []Subject    `xml:"metadata>subject"`
+	Description  string       `xml:"metadata>description"`
+	Event        []struct {
 		Name string `xml:"event,attr"`
 		Date string `xml:",innerxml"`
 	} `xml:"metadata>date"`
 	Meta []struct {
-		Text    string `xml:",chardata"`
-		Name    string `xml:"name,attr"`
-		Content string `xml:"content,attr"`
+		Text     string `xml:",chardata"`
+		Name     string `xml:"name,attr"`
+		Content  string `xml:"content,attr"`
+		ID       string `xml:"id,attr"`
+		Property string `xml:"property,attr"`
+		Refines  string `xml:"refines,attr"`
 	} `xml:"metadata>meta"`
 	Type     string `xml:"metadata>type"`
 	Format   string `xml:"metadata>format"`
@@ -94,15 +103,248 @@ type Metadata struct {
 	Rights   string `xml:"metadata>rights"`
 }
 
+// Identifier is a dc:identifier element. Scheme is the EPUB 2 opf:scheme
+// attribute.
+type Identifier struct {
+	ID     string `xml:"id,attr"`
+	Scheme string `xml:"scheme,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// Creator is a dc:creator or dc:contributor element. EPUB 2 records the sort
+// name and role as attributes, EPUB 3 as meta elements refining the id.
+type Creator struct {
+	ID     string `xml:"id,attr"`
+	FileAs string `xml:"file-as,attr"`
+	Role   string `xml:"role,attr"`
+	Name   string `xml:",chardata"`
+}
+
+// Subject is a dc:subject element, with the EPUB 3 authority and term
+// attributes.
+type Subject struct {
+	Authority string `xml:"authority,attr"`
+	Term      string `xml:"term,attr"`
+	Text      string `xml:",chardata"`
+}
+
 func (p *Package) GetTitle() string       { return p.Title }
 func (p *Package) GetLanguage() string    { return p.Language }
-func (p *Package) GetIdentifier() string  { return p.Identifier }
-func (p *Package) GetCreator() string     { return p.Creator }
-func (p *Package) GetContributor() string { return p.Contributor }
 func (p *Package) GetPublisher() string   { return p.Publisher }
-func (p *Package) GetSubject() string     { return p.Subject }
 func (p *Package) GetDescription() string { return p.Description }
-func (p *Package) HasCover() bool {
+func (p *Package) GetRights() string      { return strings.TrimSpace(p.Rights) }
+func (p *Package) HasCover() bool         { return p.CoverItem() != nil }
+
+// GetIdentifier returns the unique identifier of the package.
+func (p *Package) GetIdentifier() string {
+	for _, id := range p.Identifiers {
+		if id.ID != "" && id.ID == p.UniqueIdentifier {
+			return strings.TrimSpace(id.Value)
+		}
+	}
+	if len(p.Identifiers) > 0 {
+		return strings.TrimSpace(p.Identifiers[0].Value)
+	}
+	return ""
+}
+
+func (p *Package) GetCreator() string {
+	if len(p.Creators) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(p.Creators[0].Name)
+}
+
+func (p *Package) GetContributor() string {
+	if len(p.Contributors) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(p.Contributors[0].Name)
+}
+
+// GetSubject returns the subjects separated by commas.
+func (p *Package) GetSubject() string {
+	var subjects []string
+	for _, s := range p.Subjects {
+		if t := strings.TrimSpace(s.Text); t != "" {
+			subjects = append(subjects, t)
+		}
+	}
+	return strings.Join(subjects, ", ")
+}
+
+// GetIdentifiers returns every identifier, ISBNs written as URNs.
+func (p *Package) GetIdentifiers() []string {
+	var out []string
+	for _, id := range p.Identifiers {
+		v := strings.TrimSpace(id.Value)
+		if v == "" {
+			continue
+		}
+		lower := strings.ToLower(v)
+		switch {
+		case strings.EqualFold(id.Scheme, "isbn") && !strings.HasPrefix(lower, "urn:"):
+			v = "urn:isbn:" + strings.ReplaceAll(v, "-", "")
+		case strings.EqualFold(id.Scheme, "uuid") && !strings.HasPrefix(lower, "urn:"):
+			v = "urn:uuid:" + v
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// GetAuthors returns the creators. Creators without a role are authors.
+func (p *Package) GetAuthors() []storage.Person {
+	var out []storage.Person
+	for _, c := range p.people(p.Creators) {
+		if c.Role == "" || c.Role == "aut" {
+			c.Role = "aut"
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// GetContributors returns the contributors, and the creators credited with
+// a role other than author, such as illustrators.
+func (p *Package) GetContributors() []storage.Person {
+	var out []storage.Person
+	for _, c := range p.people(p.Creators) {
+		if c.Role != "" && c.Role != "aut" {
+			out = append(out, c)
+		}
+	}
+	return append(out, p.people(p.Contributors)...)
+}
+
+func (p *Package) people(creators []Creator) []storage.Person {
+	var out []storage.Person
+	for _, c := range creators {
+		person := storage.Person{Name: strings.TrimSpace(c.Name), SortAs: c.FileAs, Role: c.Role}
+		if person.Name == "" {
+			continue
+		}
+		if c.ID != "" {
+			for _, meta := range p.Meta {
+				if meta.Refines != "#"+c.ID {
+					continue
+				}
+				switch meta.Property {
+				case "file-as":
+					person.SortAs = strings.TrimSpace(meta.Text)
+				case "role":
+					person.Role = strings.TrimSpace(meta.Text)
+				}
+			}
+		}
+		out = append(out, person)
+	}
+	return out
+}
+
+// GetSubjects returns the subjects, with their authority, such as BISAC,
+// when given.
+func (p *Package) GetSubjects() []storage.Subject {
+	var out []storage.Subject
+	for _, s := range p.Subjects {
+		label := strings.TrimSpace(s.Text)
+		if label == "" {
+			continue
+		}
+		term := s.Term
+		if term == "" {
+			term = label
+		}
+		out = append(out, storage.Subject{Term: term, Scheme: s.Authority, Label: label})
+	}
+	return out
+}
+
+// GetAgeRating returns the lower bound of the schema.org typical age range,
+// e.g. 8 for "8-12" or 13 for "13+".
+func (p *Package) GetAgeRating() int {
+	for _, meta := range p.Meta {
+		value := ""
+		switch {
+		case meta.Property == "schema:typicalAgeRange":
+			value = meta.Text
+		case meta.Name == "schema:typicalAgeRange":
+			value = meta.Content
+		default:
+			continue
+		}
+		value = strings.TrimSpace(value)
+		end := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+		if end < 0 {
+			end = len(value)
+		}
+		if age, err := strconv.Atoi(value[:end]); err == nil {
+			return age
+		}
+	}
+	return 0
+}
+
+// GetDate returns the publication date, or the first date when no event is
+// named.
+func (p *Package) GetDate() string {
+	for _, e := range p.Event {
+		if e.Name == "publication" {
+			return strings.TrimSpace(e.Date)
+		}
+	}
+	if len(p.Event) > 0 {
+		return strings.TrimSpace(p.Event[0].Date)
+	}
+	return ""
+}
+
+// GetSeries returns the calibre series, or the first EPUB 3 collection.
+func (p *Package) GetSeries() string {
+	name, _ := p.series()
+	return name
+}
+
+// GetSeriesIndex returns the position of the book in its series.
+func (p *Package) GetSeriesIndex() string {
+	_, index := p.series()
+	return index
+}
+
+func (p *Package) series() (name, index string) {
+	for _, meta := range p.Meta {
+		switch meta.Name {
+		case "calibre:series":
+			name = meta.Content
+		case "calibre:series_index":
+			index = meta.Content
+		}
+	}
+	if name != "" {
+		return name, index
+	}
+
+	id := ""
+	for _, meta := range p.Meta {
+		if meta.Property == "belongs-to-collection" && meta.Refines == "" {
+			name, id = strings.TrimSpace(meta.Text), meta.ID
+			break
+		}
+	}
+	if name == "" || id == "" {
+		return name, ""
+	}
+	for _, meta := range p.Meta {
+		if meta.Property == "group-position" && meta.Refines == "#"+id {
+			return name, strings.TrimSpace(meta.Text)
+		}
+	}
+	return name, ""
+}
+
+// CoverItem returns the manifest item referenced by the cover meta element, or
+// nil when the package does not declare a cover.
+func (p *Package) CoverItem() *Item {
 	cover := ""
 	for _, meta := range p.Meta {
 		if meta.Name == "cover" {
@@ -110,15 +352,17 @@ func (p *Package) HasCover() bool {
 			break
 		}
 	}
-	if cover != "" {
-		for _, item := range p.Manifest.Items {
-			if item.ID == cover {
-				return true
-			}
+	if cover == "" {
+		return nil
+	}
+	for i := range p.Manifest.Items {
+		if p.Manifest.Items[i].ID == cover {
+			return &p.Manifest.Items[i]
 		}
 	}
-	return false
+	return nil
 }
+
 func (m *Metadata) HasThumbnail() bool { return false }
 
 // Manifest lists every file that is part of the epub.
@@ -131,7 +375,10 @@ type Item struct {
 	ID        string `xml:"id,attr"`
 	HREF      string `xml:"href,attr"`
 	MediaType string `xml:"media-type,attr"`
-	f         *zip.File
+	// Properties lists the roles of the item, e.g. "nav" for the EPUB 3
+	// navigation document.
+	Properties string `xml:"properties,attr"`
+	f          *zip.File
 }
 
 // Spine defines the reading order of the epub documents.
@@ -215,6 +462,10 @@ func (r *Reader) init(z *zip.Reader) error {
 
 // setContainer unmarshals the epub's container.xml file.
 func (r *Reader) setContainer() error {
+	if r.files[containerPath] == nil {
+		return ErrNoRootfile
+	}
+
 	f, err := r.files[containerPath].Open()
 	if err != nil {
 		return err
@@ -307,6 +558,21 @@ func (item *Item) Open() (r io.ReadCloser, err error) {
 	return item.f.Open()
 }
 
+// Open returns a ReadCloser reading the file of the archive at name, a path
+// relative to its root such as "OEBPS/chapter1.xhtml".
+func (r *Reader) Open(name string) (io.ReadCloser, error) {
+	f := r.files[name]
+	if f == nil {
+		return nil, os.ErrNotExist
+	}
+	return f.Open()
+}
+
+// ItemPath returns the location of item in the archive.
+func (rf *Rootfile) ItemPath(item *Item) string {
+	return path.Join(path.Dir(rf.FullPath), item.HREF)
+}
+
 // Close closes the epub file, rendering it unusable for I/O.
 func (rc *ReadCloser) Close() {
 	rc.f.Close()
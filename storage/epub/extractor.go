@@ -0,0 +1,142 @@
+package epub
+
+import (
+	"bookarr/storage"
+	"bytes"
+	"encoding/xml"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+)
+
+// MIMEType is the content type of an EPUB archive.
+const MIMEType = "application/epub+zip"
+
+func init() {
+	storage.RegisterFormat(storage.Format{
+		Name:       "EPUB",
+		MIMEType:   MIMEType,
+		Extensions: []string{".epub"},
+		Sniff:      sniff,
+		Extractor:  extractor{},
+	})
+}
+
+// sniff recognises the uncompressed mimetype entry that the OCF spec requires
+// to be the first file in the zip.
+func sniff(header []byte) bool {
+	return storage.HasPrefixAt(header, 0, "PK\x03\x04") &&
+		storage.HasPrefixAt(header, 30, "mimetype"+MIMEType)
+}
+
+type extractor struct{}
+
+func (extractor) Metadata(filename string) (storage.Metadata, error) {
+	rc, err := OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return rc.Rootfiles[0], nil
+}
+
+func (extractor) Cover(filename string) (image.Image, error) {
+	rc, err := OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	item := rc.Rootfiles[0].CoverItem()
+	if item == nil {
+		return nil, storage.ErrNotRecognised
+	}
+
+	f, err := item.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// Text returns the character data of all spine documents in reading order,
+// one paragraph per line.
+func (extractor) Text(filename string) (io.ReadCloser, error) {
+	rc, err := OpenReader(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var b bytes.Buffer
+	for _, itemref := range rc.Rootfiles[0].Spine.Itemrefs {
+		if itemref.Item == nil {
+			continue
+		}
+		if err := writeText(&b, itemref.Item); err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(&b), nil
+}
+
+// blockElements end a line of text when they close.
+var blockElements = map[string]struct{}{
+	"p": {}, "div": {}, "br": {}, "li": {}, "tr": {},
+	"h1": {}, "h2": {}, "h3": {}, "h4": {}, "h5": {}, "h6": {},
+}
+
+func writeText(w *bytes.Buffer, item *Item) error {
+	f, err := item.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	d := xml.NewDecoder(f)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	skip := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "script" || t.Name.Local == "style" || t.Name.Local == "head" {
+				skip++
+			}
+		case xml.EndElement:
+			if t.Name.Local == "script" || t.Name.Local == "style" || t.Name.Local == "head" {
+				skip--
+			}
+			if _, ok := blockElements[t.Name.Local]; ok && w.Len() > 0 {
+				w.WriteByte('\n')
+			}
+		case xml.CharData:
+			if skip > 0 {
+				continue
+			}
+			if s := strings.Join(strings.Fields(string(t)), " "); s != "" {
+				w.WriteString(s)
+				w.WriteByte(' ')
+			}
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package epub
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const ncxMediaType = "application/x-dtbncx+xml"
+
+// NavPoint is an entry of the table of contents.
+type NavPoint struct {
+	Title string
+	// Href is the location of the entry in the archive, with a fragment
+	// when it starts inside a document, e.g. "OEBPS/ch1.xhtml#part2".
+	Href     string
+	Children []NavPoint
+}
+
+// TOC returns the table of contents of the first package, read from the
+// EPUB 3 navigation document, or else from the EPUB 2 NCX. It is empty when
+// the book has neither.
+func (r *Reader) TOC() ([]NavPoint, error) {
+	rf := r.Rootfiles[0]
+	var nav, ncx *Item
+	for i := range rf.Manifest.Items {
+		item := &rf.Manifest.Items[i]
+		if hasProperty(item.Properties, "nav") {
+			nav = item
+		}
+		if item.MediaType == ncxMediaType {
+			ncx = item
+		}
+	}
+
+	switch {
+	case nav != nil:
+		f, err := nav.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseNav(f, rf.ItemPath(nav))
+	case ncx != nil:
+		f, err := ncx.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseNCX(f, rf.ItemPath(ncx))
+	}
+	return nil, nil
+}
+
+func hasProperty(properties, name string) bool {
+	for _, p := range strings.Fields(properties) {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the location in the archive of href, found in the
+// document at base.
+func resolve(base, href string) string {
+	u, err := url.Parse(href)
+	if err != nil || u.IsAbs() {
+		return href
+	}
+	p := path.Join(path.Dir(base), u.Path)
+	if u.Path == "" {
+		p = base
+	}
+	if u.Fragment != "" {
+		p += "#" + u.Fragment
+	}
+	return p
+}
+
+// parseNav reads the toc nav element of the EPUB 3 navigation document at
+// base.
+func parseNav(r io.Reader, base string) ([]NavPoint, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	var toc *html.Node
+	var find func(n *html.Node)
+	find = func(n *html.Node) {
+		if toc != nil {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "nav" && attr(n, "epub:type") == "toc" {
+			toc = n
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			find(c)
+		}
+	}
+	find(doc)
+	if toc == nil {
+		return nil, nil
+	}
+	for c := toc.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "ol" {
+			return navList(c, base), nil
+		}
+	}
+	return nil, nil
+}
+
+// navList returns the entries of the ol element of a nav.
+func navList(ol *html.Node, base string) []NavPoint {
+	var out []NavPoint
+	for li := ol.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.Data != "li" {
+			continue
+		}
+		var p NavPoint
+		for c := li.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "a", "span":
+				p.Title = strings.Join(strings.Fields(text(c)), " ")
+				if href := attr(c, "href"); href != "" {
+					p.Href = resolve(base, href)
+				}
+			case "ol":
+				p.Children = navList(c, base)
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(text(c))
+	}
+	return b.String()
+}
+
+type ncxPoint struct {
+	Label   string     `xml:"navLabel>text"`
+	Content ncxContent `xml:"content"`
+	Points  []ncxPoint `xml:"navPoint"`
+}
+
+type ncxContent struct {
+	Src string `xml:"src,attr"`
+}
+
+// parseNCX reads the navigation map of the EPUB 2 NCX document at base.
+func parseNCX(r io.Reader, base string) ([]NavPoint, error) {
+	var ncx struct {
+		Points []ncxPoint `xml:"navMap>navPoint"`
+	}
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	if err := d.Decode(&ncx); err != nil {
+		return nil, err
+	}
+	var convert func([]ncxPoint) []NavPoint
+	convert = func(points []ncxPoint) []NavPoint {
+		var out []NavPoint
+		for _, p := range points {
+			out = append(out, NavPoint{
+				Title:    strings.Join(strings.Fields(p.Label), " "),
+				Href:     resolve(base, p.Content.Src),
+				Children: convert(p.Points),
+			})
+		}
+		return out
+	}
+	return convert(ncx.Points), nil
+}
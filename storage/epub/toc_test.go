@@ -0,0 +1,67 @@
+package epub
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNav(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="utf-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<body>
+<nav epub:type="landmarks"><ol><li><a href="cover.xhtml">Cover</a></li></ol></nav>
+<nav epub:type="toc"><h1>Contents</h1>
+<ol>
+  <li><a href="text/ch1.xhtml">Chapter
+    One</a></li>
+  <li><span>Part Two</span>
+    <ol><li><a href="text/ch2.xhtml#s1">Section <em>1</em></a></li></ol>
+  </li>
+</ol>
+</nav>
+</body>
+</html>`
+	got, err := parseNav(strings.NewReader(doc), "OEBPS/nav.xhtml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NavPoint{
+		{Title: "Chapter One", Href: "OEBPS/text/ch1.xhtml"},
+		{Title: "Part Two", Children: []NavPoint{{Title: "Section 1", Href: "OEBPS/text/ch2.xhtml#s1"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNav = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseNCX(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<navMap>
+  <navPoint id="n1" playOrder="1">
+    <navLabel><text>Chapter 1</text></navLabel>
+    <content src="ch1.html"/>
+    <navPoint id="n2" playOrder="2">
+      <navLabel><text>Scene 1</text></navLabel>
+      <content src="ch1.html#scene1"/>
+    </navPoint>
+  </navPoint>
+  <navPoint id="n3" playOrder="3">
+    <navLabel><text>Chapter 2</text></navLabel>
+    <content src="../ch2.html"/>
+  </navPoint>
+</navMap>
+</ncx>`
+	got, err := parseNCX(strings.NewReader(doc), "OEBPS/toc.ncx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NavPoint{
+		{Title: "Chapter 1", Href: "OEBPS/ch1.html", Children: []NavPoint{{Title: "Scene 1", Href: "OEBPS/ch1.html#scene1"}}},
+		{Title: "Chapter 2", Href: "ch2.html"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNCX = %+v, want %+v", got, want)
+	}
+}
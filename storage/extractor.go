@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"maps"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrNotRecognised is returned when no registered format can handle a file.
+var ErrNotRecognised = errors.New("not recognised")
+
+// sniffLen is the number of bytes handed to Format.Sniff.
+const sniffLen = 512
+
+// Extractor reads the metadata and cover of a single book format.
+type Extractor interface {
+	Metadata(filename string) (Metadata, error)
+	Cover(filename string) (image.Image, error)
+}
+
+// TextExtractor is implemented by extractors that can also return the plain
+// text content of a book.
+type TextExtractor interface {
+	Text(filename string) (io.ReadCloser, error)
+}
+
+// PageExtractor is implemented by extractors of formats made of page
+// images, such as comic archives.
+type PageExtractor interface {
+	// Pages returns the names of the page images in reading order.
+	Pages(filename string) ([]string, error)
+	// Page opens the page image called name.
+	Page(filename, name string) (io.ReadCloser, error)
+}
+
+// Format describes a book format known to the extractor registry.
+type Format struct {
+	// Name is a short human readable name, e.g. "EPUB".
+	Name string
+	// MIMEType is the canonical content type of the format.
+	MIMEType string
+	// Extensions lists the file extensions, including the leading dot.
+	Extensions []string
+	// Sniff reports whether header, the first bytes of a file, belongs to
+	// this format. It may be nil when the format can not be detected by
+	// content.
+	Sniff func(header []byte) bool
+	// MatchDir reports whether the folder dir holds a single book in this
+	// format, such as an audiobook split in tracks. It may be nil for
+	// formats that are stored as one file.
+	MatchDir func(dir string) bool
+	// Extractor reads metadata and covers. It may be nil for formats that
+	// are served as-is.
+	Extractor Extractor
+}
+
+var registry = struct {
+	sync.RWMutex
+	formats []*Format
+	byExt   map[string]*Format
+	byMIME  map[string]*Format
+}{
+	byExt:  make(map[string]*Format),
+	byMIME: make(map[string]*Format),
+}
+
+// RegisterFormat makes a format known to all stores. It is meant to be called
+// from the init function of the package implementing the format. A later
+// registration with the same name or extension replaces the earlier one in
+// place, keeping its position in the sniffing order.
+func RegisterFormat(f Format) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	p := &f
+	replaced := false
+	formats := make([]*Format, 0, len(registry.formats)+1)
+	for _, old := range registry.formats {
+		if !overlaps(old, p) {
+			formats = append(formats, old)
+			continue
+		}
+		forget(old)
+		if !replaced {
+			formats = append(formats, p)
+			replaced = true
+		}
+	}
+	if !replaced {
+		formats = append(formats, p)
+	}
+	registry.formats = formats
+
+	for _, ext := range f.Extensions {
+		ext = strings.ToLower(ext)
+		registry.byExt[ext] = p
+		if f.MIMEType != "" {
+			_ = mime.AddExtensionType(ext, f.MIMEType)
+		}
+	}
+	if f.MIMEType != "" {
+		registry.byMIME[f.MIMEType] = p
+	}
+}
+
+// overlaps reports whether a and b share their name or an extension.
+func overlaps(a, b *Format) bool {
+	if a.Name == b.Name {
+		return true
+	}
+	for _, ext := range a.Extensions {
+		if slices.ContainsFunc(b.Extensions, func(e string) bool { return strings.EqualFold(e, ext) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// forget removes the lookups that point at f. The registry must be locked.
+func forget(f *Format) {
+	maps.DeleteFunc(registry.byExt, func(_ string, g *Format) bool { return g == f })
+	maps.DeleteFunc(registry.byMIME, func(_ string, g *Format) bool { return g == f })
+}
+
+// FormatByExtension returns the format registered for ext.
+func FormatByExtension(ext string) (Format, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	f, ok := registry.byExt[strings.ToLower(ext)]
+	if !ok {
+		return Format{}, false
+	}
+	return *f, true
+}
+
+// FormatByMIMEType returns the format registered for the content type t.
+// Parameters such as charset are ignored.
+func FormatByMIMEType(t string) (Format, bool) {
+	if mt, _, err := mime.ParseMediaType(t); err == nil {
+		t = mt
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	f, ok := registry.byMIME[t]
+	if !ok {
+		return Format{}, false
+	}
+	return *f, true
+}
+
+// SniffFormat detects the format of header, the first bytes of a file, by
+// asking every registered format in registration order.
+func SniffFormat(header []byte) (Format, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, f := range registry.formats {
+		if f.Sniff != nil && f.Sniff(header) {
+			return *f, true
+		}
+	}
+	return Format{}, false
+}
+
+// LookupFormat returns the format of filename by extension. The contents of
+// the file are only sniffed when no registered format claims the extension.
+func LookupFormat(filename string) (Format, bool) {
+	if f, ok := FormatByExtension(filepath.Ext(filename)); ok {
+		return f, true
+	}
+
+	fh, err := os.Open(filename)
+	if err != nil {
+		return Format{}, false
+	}
+	defer fh.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(fh, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return Format{}, false
+	}
+	return SniffFormat(header[:n])
+}
+
+// LookupDirFormat returns the format of the book stored as the folder dir.
+func LookupDirFormat(dir string) (Format, bool) {
+	registry.RLock()
+	formats := registry.formats
+	registry.RUnlock()
+
+	for _, f := range formats {
+		if f.MatchDir != nil && f.MatchDir(dir) {
+			return *f, true
+		}
+	}
+	return Format{}, false
+}
+
+// HasPrefixAt reports whether header contains prefix at offset. It is a
+// helper for Sniff implementations.
+func HasPrefixAt(header []byte, offset int, prefix string) bool {
+	if len(header) < offset+len(prefix) {
+		return false
+	}
+	return bytes.Equal(header[offset:offset+len(prefix)], []byte(prefix))
+}
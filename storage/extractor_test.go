@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"image"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type testExtractor struct{}
+
+func (testExtractor) Metadata(string) (Metadata, error) { return NOOPMetadata{}, nil }
+func (testExtractor) Cover(string) (image.Image, error) { return nil, ErrNotRecognised }
+
+// restoreRegistry puts the registry back as it was once t ends, so formats
+// registered by the test don't leak into others.
+func restoreRegistry(t *testing.T) {
+	registry.Lock()
+	formats := slices.Clone(registry.formats)
+	byExt := maps.Clone(registry.byExt)
+	byMIME := maps.Clone(registry.byMIME)
+	registry.Unlock()
+
+	t.Cleanup(func() {
+		registry.Lock()
+		defer registry.Unlock()
+		registry.formats, registry.byExt, registry.byMIME = formats, byExt, byMIME
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	restoreRegistry(t)
+	RegisterFormat(Format{
+		Name:       "Test",
+		MIMEType:   "application/x-bookarr-test",
+		Extensions: []string{".bkt"},
+		Sniff:      func(h []byte) bool { return HasPrefixAt(h, 2, "BKT") },
+		Extractor:  testExtractor{},
+	})
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	RegisterFormat(Format{
+		Name:       "Plain",
+		MIMEType:   "application/x-bookarr-plain",
+		Extensions: []string{".bkp"},
+	})
+
+	sniffed := write("renamed.bin", "xxBKT and more")
+	other := write("other", "nothing to see")
+	known := write("book.bkp", "xxBKT but plain")
+
+	tests := []struct {
+		name   string
+		lookup func() (Format, bool)
+		want   string
+	}{
+		{"by extension", func() (Format, bool) { return FormatByExtension(".BKT") }, "Test"},
+		{"by mime type", func() (Format, bool) { return FormatByMIMEType("application/x-bookarr-test; charset=utf-8") }, "Test"},
+		{"by content", func() (Format, bool) { return LookupFormat(sniffed) }, "Test"},
+		{"unknown content", func() (Format, bool) { return LookupFormat(other) }, ""},
+		{"known extension not sniffed", func() (Format, bool) { return LookupFormat(known) }, "Plain"},
+		{"unknown extension", func() (Format, bool) { return FormatByExtension(".nope") }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, ok := tt.lookup()
+			if ok != (tt.want != "") {
+				t.Fatalf("lookup ok = %v, want %v", ok, tt.want != "")
+			}
+			if ok && f.Name != tt.want {
+				t.Errorf("lookup name = %q, want %q", f.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterFormatReplaces(t *testing.T) {
+	restoreRegistry(t)
+	sniff := func(h []byte) bool { return HasPrefixAt(h, 0, "BKT") }
+	RegisterFormat(Format{Name: "Old", MIMEType: "application/x-bookarr-old", Extensions: []string{".bkt"}, Sniff: sniff})
+	RegisterFormat(Format{Name: "New", MIMEType: "application/x-bookarr-new", Extensions: []string{".BKT"}, Sniff: sniff})
+
+	n := 0
+	registry.RLock()
+	for _, f := range registry.formats {
+		if f.Name == "Old" || f.Name == "New" {
+			n++
+		}
+	}
+	registry.RUnlock()
+	if n != 1 {
+		t.Errorf("registered formats = %d, want 1", n)
+	}
+	if f, ok := SniffFormat([]byte("BKT")); !ok || f.Name != "New" {
+		t.Errorf("SniffFormat = %q, %v, want %q", f.Name, ok, "New")
+	}
+	if _, ok := FormatByMIMEType("application/x-bookarr-old"); ok {
+		t.Error("FormatByMIMEType still finds the replaced format")
+	}
+}
@@ -0,0 +1,405 @@
+/*
+Package fb2 provides basic support for reading FictionBook 2 documents.
+https://github.com/gribuser/fb2
+*/
+package fb2
+
+import (
+	"bookarr/storage"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// MIMEType is the content type of a FictionBook document.
+const MIMEType = "text/fb2+xml"
+
+// ErrNoFictionBook occurs when the document root is not a FictionBook element.
+var ErrNoFictionBook = errors.New("fb2: not a FictionBook document")
+
+func init() {
+	storage.RegisterFormat(storage.Format{
+		Name:       "FB2",
+		MIMEType:   MIMEType,
+		Extensions: []string{".fb2"},
+		Sniff:      sniff,
+		Extractor:  extractor{},
+	})
+}
+
+func sniff(header []byte) bool {
+	return bytes.Contains(header, []byte("<FictionBook"))
+}
+
+// Node is an element or, when Name is empty, a text node of the document.
+type Node struct {
+	Name     string
+	Attr     map[string]string
+	Children []*Node
+	Text     string
+}
+
+// Child returns the first child element called name, or nil.
+func (n *Node) Child(name string) *Node {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// All returns the child elements called name.
+func (n *Node) All(name string) []*Node {
+	if n == nil {
+		return nil
+	}
+	var out []*Node
+	for _, c := range n.Children {
+		if c.Name == name {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// paragraphs are the elements that end a line of text.
+var paragraphs = map[string]struct{}{
+	"p": {}, "v": {}, "subtitle": {}, "text-author": {}, "title": {}, "empty-line": {},
+}
+
+// Content returns the concatenated text of the node and its descendants with
+// white space collapsed.
+func (n *Node) Content() string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	var walk func(*Node)
+	walk = func(n *Node) {
+		b.WriteString(n.Text)
+		for _, c := range n.Children {
+			walk(c)
+		}
+		if _, ok := paragraphs[n.Name]; ok {
+			b.WriteByte(' ')
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Href returns the xlink:href attribute of an image or link element.
+func (n *Node) Href() string {
+	return n.Attr["href"]
+}
+
+// Author is a person credited in the title info.
+type Author struct {
+	FirstName  string
+	MiddleName string
+	LastName   string
+	Nickname   string
+}
+
+// Name returns the author name in reading order.
+func (a Author) Name() string {
+	name := strings.Join(strings.Fields(a.FirstName+" "+a.MiddleName+" "+a.LastName), " ")
+	if name == "" {
+		return a.Nickname
+	}
+	return name
+}
+
+// SortName returns the author name as "Last, First Middle".
+func (a Author) SortName() string {
+	if a.LastName == "" {
+		return a.Name()
+	}
+	first := strings.TrimSpace(a.FirstName + " " + a.MiddleName)
+	if first == "" {
+		return a.LastName
+	}
+	return a.LastName + ", " + first
+}
+
+// Binary is an embedded file, usually an image.
+type Binary struct {
+	ID          string
+	ContentType string
+	Data        []byte
+}
+
+// Book is a parsed FictionBook document.
+type Book struct {
+	Title       string
+	Authors     []Author
+	Translators []Author
+	Genres      []string
+	Language    string
+	Date        string
+	// Modified is the date the document itself was last edited, from its
+	// document-info.
+	Modified       string
+	ID             string
+	Publisher      string
+	ISBN           string
+	SequenceName   string
+	SequenceNumber string
+	// Annotation is the description of the book, as FictionBook markup.
+	Annotation *Node
+	// Cover is the id of the cover binary, without the leading #.
+	Cover    string
+	Bodies   []*Node
+	Binaries map[string]*Binary
+
+	hasCover bool
+}
+
+// Open parses the FictionBook document in the named file.
+func Open(name string) (*Book, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a FictionBook document. Documents in legacy encodings such as
+// windows-1251 are converted to UTF-8.
+func Parse(r io.Reader) (*Book, error) {
+	root, err := parseTree(r)
+	if err != nil {
+		return nil, err
+	}
+	if root.Name != "FictionBook" {
+		return nil, ErrNoFictionBook
+	}
+
+	b := &Book{Binaries: make(map[string]*Binary)}
+
+	desc := root.Child("description")
+	title := desc.Child("title-info")
+	b.Title = title.Child("book-title").Content()
+	b.Authors = authors(title.All("author"))
+	b.Translators = authors(title.All("translator"))
+	for _, g := range title.All("genre") {
+		b.Genres = append(b.Genres, g.Content())
+	}
+	b.Language = title.Child("lang").Content()
+	b.Date = dateValue(title.Child("date"))
+	if seq := title.Child("sequence"); seq != nil {
+		b.SequenceName = seq.Attr["name"]
+		b.SequenceNumber = seq.Attr["number"]
+	}
+	b.Annotation = title.Child("annotation")
+	if img := title.Child("coverpage").Child("image"); img != nil {
+		b.Cover = strings.TrimPrefix(img.Href(), "#")
+	}
+
+	info := desc.Child("document-info")
+	b.ID = info.Child("id").Content()
+	b.Modified = dateValue(info.Child("date"))
+	publish := desc.Child("publish-info")
+	b.Publisher = publish.Child("publisher").Content()
+	b.ISBN = publish.Child("isbn").Content()
+	if b.Date == "" {
+		b.Date = publish.Child("year").Content()
+	}
+
+	b.Bodies = root.All("body")
+	for _, bin := range root.All("binary") {
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(bin.Content()), ""))
+		if err != nil {
+			continue
+		}
+		b.Binaries[bin.Attr["id"]] = &Binary{
+			ID:          bin.Attr["id"],
+			ContentType: bin.Attr["content-type"],
+			Data:        data,
+		}
+	}
+	b.hasCover = b.Binaries[b.Cover] != nil
+	return b, nil
+}
+
+// dateValue returns the machine readable value of a date element, falling
+// back to its text.
+func dateValue(date *Node) string {
+	if date == nil {
+		return ""
+	}
+	if v := date.Attr["value"]; v != "" {
+		return v
+	}
+	return date.Content()
+}
+
+func authors(nodes []*Node) []Author {
+	var out []Author
+	for _, n := range nodes {
+		a := Author{
+			FirstName:  n.Child("first-name").Content(),
+			MiddleName: n.Child("middle-name").Content(),
+			LastName:   n.Child("last-name").Content(),
+			Nickname:   n.Child("nickname").Content(),
+		}
+		if a.Name() != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// parseTree reads the document into a tree of nodes. Namespace prefixes are
+// dropped, so xlink:href is available as the href attribute.
+func parseTree(r io.Reader) (*Node, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.CharsetReader = charset.NewReaderLabel
+	d.Entity = xml.HTMLEntity
+
+	root := &Node{}
+	stack := []*Node{root}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &Node{Name: t.Name.Local, Attr: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				n.Attr[a.Name.Local] = a.Value
+			}
+			parent.Children = append(parent.Children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.Children = append(parent.Children, &Node{Text: string(t)})
+		}
+	}
+
+	for _, n := range root.Children {
+		if n.Name != "" {
+			return n, nil
+		}
+	}
+	return nil, ErrNoFictionBook
+}
+
+func (b *Book) GetTitle() string    { return b.Title }
+func (b *Book) GetLanguage() string { return b.Language }
+func (b *Book) GetIdentifier() string {
+	if b.ISBN != "" {
+		return b.ISBN
+	}
+	return b.ID
+}
+func (b *Book) GetCreator() string {
+	if len(b.Authors) == 0 {
+		return ""
+	}
+	return b.Authors[0].Name()
+}
+func (b *Book) GetContributor() string {
+	if len(b.Translators) == 0 {
+		return ""
+	}
+	return b.Translators[0].Name()
+}
+func (b *Book) GetPublisher() string   { return b.Publisher }
+func (b *Book) GetSubject() string     { return strings.Join(b.Genres, ", ") }
+func (b *Book) GetDescription() string { return b.Annotation.Content() }
+func (b *Book) HasCover() bool         { return b.hasCover }
+func (b *Book) GetSeries() string      { return b.SequenceName }
+func (b *Book) GetSeriesIndex() string { return b.SequenceNumber }
+func (b *Book) GetDate() string        { return b.Date }
+func (b *Book) HasThumbnail() bool     { return false }
+func (b *Book) GetRights() string      { return "" }
+
+func (b *Book) GetAuthors() []storage.Person {
+	return people(b.Authors, "aut")
+}
+
+func (b *Book) GetContributors() []storage.Person {
+	return people(b.Translators, "trl")
+}
+
+// GetSubjects returns the genres, which come from the FB2 genre list.
+func (b *Book) GetSubjects() []storage.Subject {
+	var out []storage.Subject
+	for _, g := range b.Genres {
+		out = append(out, storage.Subject{Term: g, Scheme: "FB2", Label: g})
+	}
+	return out
+}
+
+func (b *Book) GetIdentifiers() []string {
+	var out []string
+	if b.ISBN != "" {
+		out = append(out, "urn:isbn:"+strings.ReplaceAll(b.ISBN, "-", ""))
+	}
+	if b.ID != "" {
+		out = append(out, b.ID)
+	}
+	return out
+}
+
+func people(authors []Author, role string) []storage.Person {
+	var out []storage.Person
+	for _, a := range authors {
+		if a.Name() != "" {
+			out = append(out, storage.Person{Name: a.Name(), SortAs: a.SortName(), Role: role})
+		}
+	}
+	return out
+}
+
+type extractor struct{}
+
+func (extractor) Metadata(filename string) (storage.Metadata, error) {
+	b, err := Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	// drop the content, only the description is kept in listings
+	b.Bodies = nil
+	b.Binaries = nil
+	return b, nil
+}
+
+func (extractor) Cover(filename string) (image.Image, error) {
+	b, err := Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	bin := b.Binaries[b.Cover]
+	if bin == nil {
+		return nil, storage.ErrNotRecognised
+	}
+	img, _, err := image.Decode(bytes.NewReader(bin.Data))
+	return img, err
+}
@@ -0,0 +1,129 @@
+package fb2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func pngBase64(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 3))); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func document(t *testing.T) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<FictionBook xmlns="http://www.gribuser.ru/xml/fictionbook/2.0" xmlns:l="http://www.w3.org/1999/xlink">
+<description>
+<title-info>
+<genre>sf</genre>
+<author><first-name>Ivan</first-name><last-name>Petrov</last-name></author>
+<author><nickname>Anon</nickname></author>
+<translator><first-name>Jane</first-name><last-name>Doe</last-name></translator>
+<book-title>Test Book</book-title>
+<annotation><p>First.</p><p>Second.</p></annotation>
+<date value="1999-05-01">May 1999</date>
+<coverpage><image l:href="#cover.png"/></coverpage>
+<lang>ru</lang>
+<sequence name="Series" number="2"/>
+</title-info>
+<document-info><id>doc-1</id><date>2010-06-07</date></document-info>
+<publish-info><publisher>Press</publisher><isbn>978-0-00-000000-2</isbn></publish-info>
+</description>
+<body><section><p>Text<a l:href="#n1" type="note">[1]</a>.</p><image l:href="#pic.png"/></section></body>
+<body name="notes"><section id="n1"><p>A note.</p></section></body>
+<binary id="cover.png" content-type="image/png">` + pngBase64(t) + `</binary>
+<binary id="pic.png" content-type="image/png">
+` + pngBase64(t) + `
+</binary>
+<binary id="broken.png" content-type="image/png">not base64!</binary>
+</FictionBook>`
+}
+
+func TestParse(t *testing.T) {
+	b, err := Parse(strings.NewReader(document(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Title != "Test Book" || b.Language != "ru" || b.Date != "1999-05-01" || b.Modified != "2010-06-07" {
+		t.Errorf("Title, Language, Date, Modified = %q, %q, %q, %q", b.Title, b.Language, b.Date, b.Modified)
+	}
+	if len(b.Authors) != 2 || b.Authors[0].SortName() != "Petrov, Ivan" || b.Authors[1].Name() != "Anon" {
+		t.Errorf("Authors = %+v", b.Authors)
+	}
+	if got := b.GetContributor(); got != "Jane Doe" {
+		t.Errorf("GetContributor = %q", got)
+	}
+	if got := b.GetDescription(); got != "First. Second." {
+		t.Errorf("GetDescription = %q", got)
+	}
+	if got := b.GetIdentifiers(); len(got) != 2 || got[0] != "urn:isbn:9780000000002" || got[1] != "doc-1" {
+		t.Errorf("GetIdentifiers = %q", got)
+	}
+	if b.SequenceName != "Series" || b.SequenceNumber != "2" {
+		t.Errorf("sequence = %q %q", b.SequenceName, b.SequenceNumber)
+	}
+
+	// footnotes are a separate body, linked from the text by note links
+	if len(b.Bodies) != 2 || b.Bodies[1].Attr["name"] != "notes" {
+		t.Fatalf("Bodies = %d", len(b.Bodies))
+	}
+	link := b.Bodies[0].Child("section").Child("p").Child("a")
+	if link.Href() != "#n1" || link.Attr["type"] != "note" {
+		t.Errorf("note link = %+v", link.Attr)
+	}
+	if got := b.Bodies[1].Child("section").Content(); got != "A note." {
+		t.Errorf("note = %q", got)
+	}
+
+	// binaries that are not base64 are dropped, wrapped ones are decoded
+	if _, ok := b.Binaries["broken.png"]; ok {
+		t.Error("undecodable binary kept")
+	}
+	pic := b.Binaries["pic.png"]
+	if pic == nil || pic.ContentType != "image/png" || !bytes.HasPrefix(pic.Data, []byte("\x89PNG")) {
+		t.Errorf("pic.png = %+v", pic)
+	}
+	if b.Cover != "cover.png" || !b.HasCover() {
+		t.Errorf("Cover = %q, HasCover = %v", b.Cover, b.HasCover())
+	}
+}
+
+func TestParseNoFictionBook(t *testing.T) {
+	if _, err := Parse(strings.NewReader(`<html><body/></html>`)); err != ErrNoFictionBook {
+		t.Errorf("Parse err = %v", err)
+	}
+}
+
+func TestExtractor(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "book.fb2")
+	if err := os.WriteFile(filename, []byte(document(t)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := extractor{}.Metadata(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := m.(*Book)
+	if b.Bodies != nil || b.Binaries != nil || !b.HasCover() {
+		t.Errorf("Metadata kept the content or lost the cover: %d bodies, %d binaries", len(b.Bodies), len(b.Binaries))
+	}
+
+	img, err := extractor{}.Cover(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 2 || size.Y != 3 {
+		t.Errorf("cover size = %v", size)
+	}
+}
@@ -0,0 +1,8 @@
+package storage
+
+// Formats served as-is, without metadata. Packages reading a format replace
+// its entry when they register it.
+func init() {
+	RegisterFormat(Format{Name: "MOBI", MIMEType: "application/x-mobipocket-ebook", Extensions: []string{".mobi"}})
+	RegisterFormat(Format{Name: "PDF", MIMEType: "application/pdf", Extensions: []string{".pdf"}})
+}
@@ -0,0 +1,163 @@
+/*
+Package index keeps the metadata of every book of a store in memory, so the
+catalog can be searched and browsed independently of the folder layout.
+*/
+package index
+
+import (
+	"context"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bookarr/storage"
+)
+
+const acquisitionRel = "http://opds-spec.org/acquisition"
+
+// Book is an indexed book and its location in the store.
+type Book struct {
+	// Path is the location of the book in the store, e.g. "/Author/book.epub".
+	Path string
+	storage.Entry
+}
+
+// Dir returns the folder holding the book.
+func (b Book) Dir() string {
+	return path.Dir(b.Path)
+}
+
+// Index is an in-memory catalog of the books in a store.
+type Index struct {
+	store storage.Store
+
+	mu    sync.RWMutex
+	books []Book
+	built bool
+
+	// parent is the index a view made by Filter shows the books of keep
+	// returns true for.
+	parent *Index
+	keep   func(Book) bool
+}
+
+// New returns an empty index of store. The index is built on first use, or
+// by Build and Run.
+func New(store storage.Store) *Index {
+	return &Index{store: store}
+}
+
+// Build walks the whole store and replaces the content of the index.
+func (x *Index) Build() error {
+	var books []Book
+	if err := x.walk("/", &books); err != nil {
+		return err
+	}
+	sort.SliceStable(books, func(i, j int) bool { return books[i].Path < books[j].Path })
+
+	x.mu.Lock()
+	x.books = books
+	x.built = true
+	x.mu.Unlock()
+	return nil
+}
+
+func (x *Index) walk(dir string, books *[]Book) error {
+	entries, err := x.store.List(dir, storage.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		p := path.Join(dir, e.Name)
+		switch {
+		case e.Aquisition == "subsection":
+			if err := x.walk(p, books); err != nil {
+				log.Printf("index walk %s err: %s", p, err)
+			}
+		case strings.HasPrefix(e.Aquisition, acquisitionRel):
+			*books = append(*books, Book{Path: p, Entry: e})
+		}
+	}
+	return nil
+}
+
+// Filter returns a view of the index holding the books keep returns true
+// for, such as those a user may see. The view follows the index as it is
+// rebuilt; it must not be built or run itself.
+func (x *Index) Filter(keep func(Book) bool) *Index {
+	return &Index{parent: x, keep: keep}
+}
+
+// Run builds the index and rebuilds it every interval until ctx is done.
+func (x *Index) Run(ctx context.Context, interval time.Duration) {
+	for {
+		start := time.Now()
+		if err := x.Build(); err != nil {
+			log.Printf("index Build err: %s", err)
+		} else {
+			log.Printf("indexed %d books in %s", x.Len(), time.Since(start).Round(time.Millisecond))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ensureBuilt builds the index when it is used before Build or Run.
+func (x *Index) ensureBuilt() {
+	x.mu.RLock()
+	built := x.built
+	x.mu.RUnlock()
+	if built {
+		return
+	}
+	if err := x.Build(); err != nil {
+		log.Printf("index Build err: %s", err)
+	}
+}
+
+// Len returns the number of indexed books.
+func (x *Index) Len() int {
+	if x.parent != nil {
+		return len(x.Books())
+	}
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.books)
+}
+
+// Updated returns when the most recently updated book changed, or the zero
+// time when the index is empty.
+func (x *Index) Updated() time.Time {
+	var t time.Time
+	for _, b := range x.Books() {
+		if b.Updated.After(t) {
+			t = b.Updated
+		}
+	}
+	return t
+}
+
+// Books returns every indexed book ordered by path.
+func (x *Index) Books() []Book {
+	if x.parent != nil {
+		var out []Book
+		for _, b := range x.parent.Books() {
+			if x.keep(b) {
+				out = append(out, b)
+			}
+		}
+		return out
+	}
+	x.ensureBuilt()
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return append([]Book(nil), x.books...)
+}
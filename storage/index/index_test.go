@@ -0,0 +1,126 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"bookarr/storage"
+)
+
+type meta struct {
+	storage.NOOPMetadata
+	title, creator, series string
+}
+
+func (m meta) GetTitle() string       { return m.title }
+func (m meta) GetCreator() string     { return m.creator }
+func (m meta) GetSeries() string      { return m.series }
+func (m meta) GetSeriesIndex() string { return "" }
+
+// memStore is a store listing fixed entries per folder.
+type memStore struct {
+	storage.Store
+	dirs map[string][]storage.Entry
+}
+
+func (s memStore) List(path string, opts storage.ListOptions) ([]storage.Entry, error) {
+	return s.dirs[path], nil
+}
+
+// catalogMeta is metadata crediting several authors.
+type catalogMeta struct {
+	meta
+	authors []storage.Person
+	ids     []string
+}
+
+func (m catalogMeta) GetAuthors() []storage.Person      { return m.authors }
+func (m catalogMeta) GetContributors() []storage.Person { return nil }
+func (m catalogMeta) GetSubjects() []storage.Subject    { return nil }
+func (m catalogMeta) GetIdentifiers() []string          { return m.ids }
+func (m catalogMeta) GetRights() string                 { return "" }
+
+func book(name string, m storage.Metadata) storage.Entry {
+	return storage.Entry{Name: name, Aquisition: acquisitionRel, Metadata: m}
+}
+
+func TestIndex_Search(t *testing.T) {
+	store := memStore{dirs: map[string][]storage.Entry{
+		"/": {
+			{Name: "Tolkien", Aquisition: "subsection", Metadata: storage.NOOPMetadata{}},
+			book("dune.epub", meta{title: "Dune", creator: "Frank Herbert"}),
+			book("omens.epub", catalogMeta{
+				meta:    meta{title: "Good Omens", creator: "Terry Pratchett"},
+				authors: []storage.Person{{Name: "Terry Pratchett"}, {Name: "Neil Gaiman"}},
+				ids:     []string{"urn:isbn:9780060853983", "urn:uuid:omens"},
+			}),
+			{Name: "cover.jpg", Aquisition: "http://opds-spec.org/image/thumbnail", Metadata: storage.NOOPMetadata{}},
+		},
+		"/Tolkien": {
+			book("fellowship.epub", meta{title: "The Fellowship of the Ring", creator: "J. R. R. Tolkien", series: "The Lord of the Rings"}),
+			book("hobbit.epub", meta{title: "The Hobbit", creator: "J. R. R. Tolkien"}),
+			book("rings.epub", meta{title: "Essays", creator: "Someone", series: "The Rings of Tolkien"}),
+		},
+	}}
+
+	x := New(store)
+	if got := len(x.Books()); got != 5 {
+		t.Fatalf("Books() = %d books, want 5", got)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"dune", []string{"/dune.epub"}},
+		{"TOLKIEN rings", []string{"/Tolkien/fellowship.epub", "/Tolkien/rings.epub"}},
+		{"hobbit tolkien", []string{"/Tolkien/hobbit.epub"}},
+		{"herbert tolkien", nil},
+		{"gaiman omens", []string{"/omens.epub"}},
+		{"urn:uuid:omens", []string{"/omens.epub"}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, b := range x.Search(tt.query) {
+			got = append(got, b.Path)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIndex_Groups(t *testing.T) {
+	newer := book("b.epub", meta{title: "children of Dune", creator: "Herbert, Frank"})
+	newer.Updated = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	store := memStore{dirs: map[string][]storage.Entry{
+		"/": {
+			book("a.epub", meta{title: "Dune", creator: "Frank Herbert"}),
+			newer,
+			book("c.epub", meta{title: "1984", creator: "George Orwell"}),
+		},
+	}}
+	x := New(store)
+
+	author, _ := ViewByName("author")
+	want := []Group{{"Herbert, Frank", 2, newer.Updated}, {"Orwell, George", 1, time.Time{}}}
+	if got := x.Groups(author); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups(author) = %v, want %v", got, want)
+	}
+
+	var titles []string
+	for _, b := range x.Group(author, "herbert, frank") {
+		titles = append(titles, b.Metadata.GetTitle())
+	}
+	if want := []string{"children of Dune", "Dune"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("Group(author) = %v, want %v", titles, want)
+	}
+
+	letter, _ := ViewByName("letter")
+	want = []Group{{"#", 1, time.Time{}}, {"C", 1, newer.Updated}, {"D", 1, time.Time{}}}
+	if got := x.Groups(letter); !reflect.DeepEqual(got, want) {
+		t.Errorf("Groups(letter) = %v, want %v", got, want)
+	}
+}
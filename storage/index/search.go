@@ -0,0 +1,84 @@
+package index
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"bookarr/storage"
+)
+
+// field is a searchable piece of metadata and the weight of a match in it.
+type field struct {
+	text   string
+	weight int
+}
+
+func fields(b Book) []field {
+	m := b.Metadata
+	series, _ := storage.Series(m)
+	return []field{
+		{m.GetTitle(), 8},
+		{names(storage.Authors(m)), 4},
+		{names(storage.Contributors(m)), 2},
+		{series, 4},
+		{m.GetSubject(), 2},
+		{strings.Join(storage.Identifiers(m), " "), 2},
+		{strings.TrimSuffix(b.Name, path.Ext(b.Name)), 1},
+	}
+}
+
+func names(people []storage.Person) string {
+	var s []string
+	for _, p := range people {
+		s = append(s, p.Name)
+	}
+	return strings.Join(s, " ")
+}
+
+// Search returns the books matching every word of query, best matches first.
+// Words are matched case-insensitively against the title, authors, series,
+// subjects, identifiers and file name.
+func (x *Index) Search(query string) []Book {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	type result struct {
+		book  Book
+		score int
+	}
+	var results []result
+	for _, b := range x.Books() {
+		if score := match(fields(b), terms); score > 0 {
+			results = append(results, result{b, score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+
+	out := make([]Book, len(results))
+	for i, r := range results {
+		out[i] = r.book
+	}
+	return out
+}
+
+// match returns the score of a book whose fields contain every term, or 0.
+func match(fields []field, terms []string) int {
+	score := 0
+	for _, term := range terms {
+		best := 0
+		for _, f := range fields {
+			if f.weight > best && strings.Contains(strings.ToLower(f.text), term) {
+				best = f.weight
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		score += best
+	}
+	return score
+}
@@ -0,0 +1,174 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"bookarr/storage"
+)
+
+// View groups the books of the index by a piece of metadata, such as author
+// or series.
+type View struct {
+	// Name identifies the view in URLs.
+	Name  string
+	Title string
+	// keys returns the groups a book belongs to.
+	keys func(Book) []string
+	// order sorts the books of a group.
+	order storage.SortOrder
+}
+
+// Views are the ways the catalog can be browsed besides the folder layout.
+var Views = []View{
+	{Name: "author", Title: "Authors", keys: authorKeys, order: storage.SortTitle},
+	{Name: "series", Title: "Series", keys: seriesKeys, order: storage.SortSeries},
+	{Name: "language", Title: "Languages", keys: languageKeys, order: storage.SortTitle},
+	{Name: "publisher", Title: "Publishers", keys: publisherKeys, order: storage.SortTitle},
+	{Name: "subject", Title: "Subjects", keys: subjectKeys, order: storage.SortTitle},
+	{Name: "letter", Title: "Titles", keys: letterKeys, order: storage.SortTitle},
+}
+
+// Has reports whether b belongs to the group key of the view, ignoring case.
+func (v View) Has(b Book, key string) bool {
+	for _, k := range v.keys(b) {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ViewByName returns the view called name.
+func ViewByName(name string) (View, bool) {
+	for _, v := range Views {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return View{}, false
+}
+
+func nonEmpty(s ...string) []string {
+	var out []string
+	for _, v := range s {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// authorKeys groups books by the sort name of each of their authors, so
+// "Frank Herbert" and "Herbert, Frank" end up together.
+func authorKeys(b Book) []string {
+	var names []string
+	for _, a := range storage.Authors(b.Metadata) {
+		names = append(names, a.SortAs)
+	}
+	return nonEmpty(names...)
+}
+
+func seriesKeys(b Book) []string {
+	series, _ := storage.Series(b.Metadata)
+	return nonEmpty(series)
+}
+
+func languageKeys(b Book) []string {
+	return nonEmpty(strings.ToLower(b.Metadata.GetLanguage()))
+}
+
+func publisherKeys(b Book) []string {
+	return nonEmpty(b.Metadata.GetPublisher())
+}
+
+func subjectKeys(b Book) []string {
+	var labels []string
+	for _, s := range storage.Subjects(b.Metadata) {
+		labels = append(labels, s.Label)
+	}
+	return nonEmpty(labels...)
+}
+
+// letterKeys groups books by the first letter of their title, with titles
+// starting with a digit or symbol under "#".
+func letterKeys(b Book) []string {
+	title := b.Metadata.GetTitle()
+	if title == "" {
+		title = b.Name
+	}
+	for _, r := range title {
+		if unicode.IsLetter(r) {
+			return []string{string(unicode.ToUpper(r))}
+		}
+		if !unicode.IsSpace(r) {
+			break
+		}
+	}
+	return []string{"#"}
+}
+
+// Group is a value of a view and the number of books having it.
+type Group struct {
+	Key   string
+	Count int
+	// Updated is when the most recently updated book of the group changed.
+	Updated time.Time
+}
+
+// Groups returns the groups of view ordered by key, ignoring case.
+func (x *Index) Groups(view View) []Group {
+	counts := make(map[string]int)
+	updated := make(map[string]time.Time)
+	// keys differing in case only are merged under the first one seen
+	canonical := make(map[string]string)
+	for _, b := range x.Books() {
+		for _, k := range view.keys(b) {
+			folded := strings.ToLower(k)
+			if c, ok := canonical[folded]; ok {
+				k = c
+			} else {
+				canonical[folded] = k
+			}
+			counts[k]++
+			if b.Updated.After(updated[k]) {
+				updated[k] = b.Updated
+			}
+		}
+	}
+
+	groups := make([]Group, 0, len(counts))
+	for k, n := range counts {
+		groups = append(groups, Group{Key: k, Count: n, Updated: updated[k]})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return strings.ToLower(groups[i].Key) < strings.ToLower(groups[j].Key)
+	})
+	return groups
+}
+
+// Group returns the books of view having key, in the order of the view.
+func (x *Index) Group(view View, key string) []Book {
+	var out []Book
+	for _, b := range x.Books() {
+		if view.Has(b, key) {
+			out = append(out, b)
+		}
+	}
+
+	if less := storage.EntryLess(view.order); less != nil {
+		sort.SliceStable(out, func(i, j int) bool { return less(out[i].Entry, out[j].Entry) })
+	}
+	return out
+}
+
+// Recent returns the first n books in order, e.g. the most recently added.
+func (x *Index) Recent(order storage.SortOrder, n int) []Book {
+	books := x.Books()
+	if less := storage.EntryLess(order); less != nil {
+		sort.SliceStable(books, func(i, j int) bool { return less(books[i].Entry, books[j].Entry) })
+	}
+	return books[:min(n, len(books))]
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SortOrder selects how List orders entries.
+type SortOrder string
+
+const (
+	// SortDefault lists books by author, then by file name.
+	SortDefault   SortOrder = ""
+	SortTitle     SortOrder = "title"
+	SortAuthor    SortOrder = "author"
+	SortAdded     SortOrder = "added"
+	SortUpdated   SortOrder = "updated"
+	SortPublished SortOrder = "published"
+	SortSeries    SortOrder = "series"
+)
+
+// ListOptions filter and order the entries returned by List. The zero value
+// lists everything in the default order.
+type ListOptions struct {
+	Sort SortOrder
+	// Language keeps books in this language only.
+	Language string
+	// Format keeps books of this media type only.
+	Format string
+	// HasCover keeps books with a cover only.
+	HasCover bool
+}
+
+// Filtered reports whether the options drop any entries.
+func (o ListOptions) Filtered() bool {
+	return o.Language != "" || o.Format != "" || o.HasCover
+}
+
+// matchFormat reports whether any of the formats of e passes the format
+// filter.
+func (o ListOptions) matchFormat(e Entry) bool {
+	if o.Format == "" {
+		return true
+	}
+	if len(e.Files) == 0 {
+		return MediaType(e.Type) == o.Format
+	}
+	for _, f := range e.Files {
+		if MediaType(f.Type) == o.Format {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether e passes the filters. Folders always pass, and books
+// pass the format filter when any of their files is in that format.
+func (o ListOptions) Match(e Entry) bool {
+	if e.Aquisition == "subsection" {
+		return true
+	}
+	if !o.matchFormat(e) {
+		return false
+	}
+	if o.Language != "" && !strings.EqualFold(e.Metadata.GetLanguage(), o.Language) {
+		return false
+	}
+	if o.HasCover && !e.Metadata.HasCover() {
+		return false
+	}
+	return true
+}
+
+// MediaType returns contentType without parameters such as charset.
+func MediaType(contentType string) string {
+	if t, _, err := mime.ParseMediaType(contentType); err == nil {
+		return t
+	}
+	return contentType
+}
+
+// SortEntries orders entries in place. Folders come first, and entries that
+// compare equal keep the default author and name order.
+func SortEntries(entries []Entry, order SortOrder) {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Metadata.GetCreator() < entries[j].Metadata.GetCreator()
+	})
+
+	less := EntryLess(order)
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if af, bf := a.Aquisition == "subsection", b.Aquisition == "subsection"; af != bf {
+			return af
+		}
+		return less != nil && less(a, b)
+	})
+}
+
+// EntryLess returns the comparison of books for order, or nil for the
+// default order.
+func EntryLess(order SortOrder) func(a, b Entry) bool {
+	switch order {
+	case SortTitle:
+		return func(a, b Entry) bool { return sortTitle(a) < sortTitle(b) }
+	case SortAuthor:
+		return func(a, b Entry) bool { return SortName(a.Metadata.GetCreator()) < SortName(b.Metadata.GetCreator()) }
+	case SortAdded:
+		return func(a, b Entry) bool { return a.Added.After(b.Added) }
+	case SortUpdated:
+		return func(a, b Entry) bool { return a.Updated.After(b.Updated) }
+	case SortPublished:
+		return func(a, b Entry) bool { return Date(a.Metadata) > Date(b.Metadata) }
+	case SortSeries:
+		return seriesLess
+	}
+	return nil
+}
+
+func sortTitle(e Entry) string {
+	if t := e.Metadata.GetTitle(); t != "" {
+		return strings.ToLower(t)
+	}
+	return strings.ToLower(e.Name)
+}
+
+// SortName returns the name of a person in "last, first" order, so authors
+// sort by family name. Names already containing a comma are kept.
+func SortName(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.Contains(name, ",") {
+		return name
+	}
+	fields := strings.Fields(name)
+	if len(fields) == 1 {
+		return name
+	}
+	last := len(fields) - 1
+	return fields[last] + ", " + strings.Join(fields[:last], " ")
+}
+
+// seriesLess orders books by series and position, books without a series
+// last.
+func seriesLess(a, b Entry) bool {
+	as, ai := Series(a.Metadata)
+	bs, bi := Series(b.Metadata)
+	if (as == "") != (bs == "") {
+		return as != ""
+	}
+	if as != bs {
+		return strings.ToLower(as) < strings.ToLower(bs)
+	}
+	an, aerr := strconv.ParseFloat(ai, 64)
+	bn, berr := strconv.ParseFloat(bi, 64)
+	if aerr == nil && berr == nil {
+		return an < bn
+	}
+	return ai < bi
+}
+
+// NaturalLess compares strings with embedded numbers by value, so that
+// "track 2" sorts before "track 10", ignoring case.
+func NaturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		ca, sa := utf8.DecodeRuneInString(a)
+		cb, sb := utf8.DecodeRuneInString(b)
+		if isASCIIDigit(ca) && isASCIIDigit(cb) {
+			na, ra := leadingDigits(a)
+			nb, rb := leadingDigits(b)
+			ta, tb := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(ta) != len(tb) {
+				return len(ta) < len(tb)
+			}
+			if ta != tb {
+				return ta < tb
+			}
+			a, b = ra, rb
+			continue
+		}
+
+		la, lb := unicode.ToLower(ca), unicode.ToLower(cb)
+		if la != lb {
+			return la < lb
+		}
+		a, b = a[sa:], b[sb:]
+	}
+	return len(a) < len(b)
+}
+
+func isASCIIDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func leadingDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+type seriesMeta struct {
+	NOOPMetadata
+	title, series, index, creator string
+}
+
+func (m seriesMeta) GetTitle() string       { return m.title }
+func (m seriesMeta) GetSeries() string      { return m.series }
+func (m seriesMeta) GetSeriesIndex() string { return m.index }
+func (m seriesMeta) GetCreator() string     { return m.creator }
+
+func TestSortEntries(t *testing.T) {
+	entry := func(name, title, series, index string) Entry {
+		return Entry{Name: name, Metadata: seriesMeta{title: title, series: series, index: index}}
+	}
+	entries := []Entry{
+		entry("a.epub", "Zebra", "", ""),
+		entry("b.epub", "apple", "Saga", "10"),
+		entry("c.epub", "Mango", "Saga", "2"),
+		{Name: "Folder", Aquisition: "subsection", Metadata: NOOPMetadata{}},
+	}
+
+	names := func() []string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Name)
+		}
+		return out
+	}
+
+	SortEntries(entries, SortTitle)
+	if got, want := names(), []string{"Folder", "b.epub", "c.epub", "a.epub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SortTitle = %v, want %v", got, want)
+	}
+	SortEntries(entries, SortSeries)
+	if got, want := names(), []string{"Folder", "c.epub", "b.epub", "a.epub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SortSeries = %v, want %v", got, want)
+	}
+}
+
+func TestSortEntriesDefault(t *testing.T) {
+	entry := func(name, creator string) Entry {
+		return Entry{Name: name, Metadata: seriesMeta{creator: creator}}
+	}
+	entries := []Entry{
+		entry("z.epub", "Banks"),
+		entry("b.pdf", ""),
+		{Name: "Zeta", Aquisition: "subsection", Metadata: NOOPMetadata{}},
+		entry("a.epub", "Banks"),
+		{Name: "Alpha", Aquisition: "subsection", Metadata: NOOPMetadata{}},
+		entry("c.epub", "Asimov"),
+	}
+
+	SortEntries(entries, SortDefault)
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name)
+	}
+	if want := []string{"Alpha", "Zeta", "b.pdf", "c.epub", "a.epub", "z.epub"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SortDefault = %v, want %v", got, want)
+	}
+}
+
+func TestSortName(t *testing.T) {
+	for in, want := range map[string]string{
+		"Frank Herbert":    "Herbert, Frank",
+		"J. R. R. Tolkien": "Tolkien, J. R. R.",
+		"Tolkien, J.":      "Tolkien, J.",
+		"Homer":            "Homer",
+	} {
+		if got := SortName(in); got != want {
+			t.Errorf("SortName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"track 2.mp3", "track 10.mp3", true},
+		{"track 10.mp3", "track 2.mp3", false},
+		{"01.mp3", "1.mp3", false},
+		{"Disc 1 - 9.mp3", "Disc 2 - 1.mp3", true},
+		{"Ωδή 2.mp3", "ωδή 10.mp3", true},
+		{"Ωb.mp3", "ωa.mp3", false},
+	}
+	for _, tt := range tests {
+		if got := NaturalLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("NaturalLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import "strings"
+
+// Person is an author or contributor of a book.
+type Person struct {
+	Name string
+	// SortAs is the name used for sorting, e.g. "Herbert, Frank".
+	SortAs string
+	// Role is a MARC relator code such as "aut", "trl" or "nrt".
+	Role string
+}
+
+// Subject is a subject heading or tag of a book.
+type Subject struct {
+	Term string
+	// Scheme names the vocabulary of Term, e.g. "BISAC".
+	Scheme string
+	Label  string
+}
+
+// CatalogMetadata is implemented by the metadata of formats that record
+// several authors, subjects or identifiers.
+type CatalogMetadata interface {
+	Metadata
+	GetAuthors() []Person
+	GetContributors() []Person
+	GetSubjects() []Subject
+	// GetIdentifiers returns every identifier of the book, as URNs when
+	// the scheme is known, e.g. "urn:isbn:9780441013593".
+	GetIdentifiers() []string
+	GetRights() string
+}
+
+// Authors returns the authors of m, each with a sort name.
+func Authors(m Metadata) []Person {
+	var out []Person
+	if cm, ok := m.(CatalogMetadata); ok {
+		out = cm.GetAuthors()
+	} else if c := m.GetCreator(); c != "" {
+		out = []Person{{Name: c, Role: "aut"}}
+	}
+	for i := range out {
+		if out[i].SortAs == "" {
+			out[i].SortAs = SortName(out[i].Name)
+		}
+	}
+	return out
+}
+
+// Contributors returns the people other than authors credited in m.
+func Contributors(m Metadata) []Person {
+	if cm, ok := m.(CatalogMetadata); ok {
+		return cm.GetContributors()
+	}
+	if c := m.GetContributor(); c != "" {
+		return []Person{{Name: c}}
+	}
+	return nil
+}
+
+// Subjects returns the subjects of m. Formats with a single subject string
+// are split on commas and semicolons.
+func Subjects(m Metadata) []Subject {
+	if cm, ok := m.(CatalogMetadata); ok {
+		return cm.GetSubjects()
+	}
+	var out []Subject
+	for _, s := range strings.FieldsFunc(m.GetSubject(), func(r rune) bool { return r == ',' || r == ';' }) {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, Subject{Term: s, Label: s})
+		}
+	}
+	return out
+}
+
+// Identifiers returns the identifiers of m.
+func Identifiers(m Metadata) []string {
+	if cm, ok := m.(CatalogMetadata); ok {
+		return cm.GetIdentifiers()
+	}
+	if id := m.GetIdentifier(); id != "" {
+		return []string{id}
+	}
+	return nil
+}
+
+// RatedMetadata is implemented by the metadata of formats that record the
+// age readers of a book should have.
+type RatedMetadata interface {
+	Metadata
+	// GetAgeRating returns the minimum age of readers, or 0 when unknown.
+	GetAgeRating() int
+}
+
+// AgeRating returns the minimum age of the readers of m, or 0 when unknown.
+func AgeRating(m Metadata) int {
+	if rm, ok := m.(RatedMetadata); ok {
+		return rm.GetAgeRating()
+	}
+	return 0
+}
+
+// Rights returns the copyright statement of m.
+func Rights(m Metadata) string {
+	if cm, ok := m.(CatalogMetadata); ok {
+		return cm.GetRights()
+	}
+	return ""
+}
@@ -8,12 +8,23 @@ import (
 type Store interface {
 	// Get returns the content of the file at the given path.
 	PathType(path string) PathType
-	List(path string) ([]Entry, error)
+	// List returns the entries of the folder at path that pass the filters
+	// of opts, in the order it selects.
+	List(path string, opts ListOptions) ([]Entry, error)
+	// Entry returns the listing entry of a single book.
+	Entry(path string) (*Entry, error)
 	File(path string) *File
 	Cover(path string) *File
 	Thumbnail(path string) *File
 }
 
+// PageStore is implemented by stores that serve the pages of comics one by
+// one, for the OPDS Page Streaming Extension.
+type PageStore interface {
+	// Page returns the page image n, counting from 0, of the book at path.
+	Page(path string, n int) *File
+}
+
 type PathType string
 
 const (
@@ -21,22 +32,56 @@ const (
 	PathTypeFile       PathType = "file"
 	PathTypeNavigation PathType = "application/atom+xml;profile=opds-catalog;kind=navigation"
 	PathTypeAquisition PathType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	// PathTypeAudiobook is a folder holding the tracks of a single audiobook.
+	PathTypeAudiobook PathType = "application/audiobook+json"
 )
 
 type File struct {
 	ContentType   string
 	ContentLength int64
-	Reader        io.ReadCloser
+	// Reader is seekable so clients can resume downloads with range
+	// requests.
+	Reader io.ReadSeekCloser
+	// ModTime is when the content last changed, used to validate If-Range
+	// requests. It is the zero time when unknown.
+	ModTime time.Time
+}
+
+// NopSeekCloser returns r with a Close method that does nothing, for content
+// held in memory.
+func NopSeekCloser(r io.ReadSeeker) io.ReadSeekCloser {
+	return nopSeekCloser{r}
 }
 
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
 type Entry struct {
 	Name       string
 	Type       string
 	Aquisition string
 	Updated    time.Time
-	Metadata   Metadata
+	// Added is when the book was added to the library.
+	Added    time.Time
+	Metadata Metadata
+	// Files lists the files holding the book in different formats, the one
+	// named by Name first. It is empty for folders.
+	Files []BookFile
 }
 
+// BookFile is one of the files of a book, such as its EPUB or PDF edition.
+type BookFile struct {
+	// Name is the file name, in the folder of the entry.
+	Name   string
+	Type   string
+	Length int64
+}
+
+// Metadata describes a book. Extractors living outside this repository should
+// embed NOOPMetadata so they keep compiling when getters are added.
 type Metadata interface {
 	GetTitle() string
 	GetLanguage() string
@@ -62,3 +107,84 @@ func (NOOPMetadata) GetSubject() string     { return "" }
 func (NOOPMetadata) GetDescription() string { return "" }
 func (NOOPMetadata) HasCover() bool         { return false }
 func (NOOPMetadata) HasThumbnail() bool     { return false }
+
+// SeriesMetadata is implemented by the metadata of formats that record the
+// series a book belongs to.
+type SeriesMetadata interface {
+	Metadata
+	GetSeries() string
+	// GetSeriesIndex returns the position in the series, e.g. "2" or "2.5".
+	GetSeriesIndex() string
+}
+
+// Series returns the series of m and the position of the book in it, or
+// empty strings when m does not record one.
+func Series(m Metadata) (name, index string) {
+	if sm, ok := m.(SeriesMetadata); ok {
+		return sm.GetSeries(), sm.GetSeriesIndex()
+	}
+	return "", ""
+}
+
+// DateMetadata is implemented by the metadata of formats that record when a
+// book was published.
+type DateMetadata interface {
+	Metadata
+	// GetDate returns the publication date as YYYY, YYYY-MM or YYYY-MM-DD.
+	GetDate() string
+}
+
+// Date returns the publication date of m, or an empty string.
+func Date(m Metadata) string {
+	if dm, ok := m.(DateMetadata); ok {
+		return dm.GetDate()
+	}
+	return ""
+}
+
+// PagedMetadata is implemented by the metadata of books made of page images,
+// such as comics.
+type PagedMetadata interface {
+	Metadata
+	GetPageCount() int
+}
+
+// PageCount returns the number of page images of m, or 0 when its pages
+// can not be served one by one.
+func PageCount(m Metadata) int {
+	if pm, ok := m.(PagedMetadata); ok {
+		return pm.GetPageCount()
+	}
+	return 0
+}
+
+// AudioMetadata is implemented by the metadata of audiobooks.
+type AudioMetadata interface {
+	Metadata
+	GetNarrator() string
+	GetDuration() time.Duration
+	// GetTracks returns the audio files in reading order. Single file
+	// audiobooks return one track with an empty Name.
+	GetTracks() []Track
+	GetChapters() []Chapter
+}
+
+// Track is one audio file of an audiobook.
+type Track struct {
+	// Name is the file name relative to the audiobook folder.
+	Name          string
+	Title         string
+	ContentType   string
+	ContentLength int64
+	Duration      time.Duration
+}
+
+// Chapter is a navigation point inside an audiobook.
+type Chapter struct {
+	Title string
+	// Track is the index in GetTracks the chapter starts in.
+	Track int
+	// Start is the offset of the chapter in its track.
+	Start    time.Duration
+	Duration time.Duration
+}
@@ -0,0 +1,70 @@
+package users
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Position is where a user stopped reading a book in the web reader.
+type Position struct {
+	// Chapter is the index of the document of the book in reading order.
+	Chapter int `json:"chapter"`
+	// Progress is how far into the chapter, from 0 to 1.
+	Progress float64   `json:"progress"`
+	Updated  time.Time `json:"updated"`
+}
+
+// positionKey returns the key of the position of user in book. User names
+// can't contain control characters, so the separator is unambiguous.
+func positionKey(user, book string) []byte {
+	return []byte(user + "\x00" + book)
+}
+
+// SetPosition records where user stopped reading book, the path of the book
+// in the store. The user is empty while the catalog is open to everyone.
+func (db *DB) SetPosition(user, book string, p Position) error {
+	p.Updated = time.Now()
+	v, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return db.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(positionsBucket).Put(positionKey(user, book), v)
+	})
+}
+
+// Position returns where user stopped reading book, and false when they
+// never opened it.
+func (db *DB) Position(user, book string) (Position, bool, error) {
+	var p Position
+	found := false
+	err := db.view(func(tx *bolt.Tx) error {
+		v := tx.Bucket(positionsBucket).Get(positionKey(user, book))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &p)
+	})
+	return p, found, err
+}
+
+// deletePositions deletes the positions of user.
+func deletePositions(tx *bolt.Tx, user string) error {
+	b := tx.Bucket(positionsBucket)
+	prefix := positionKey(user, "")
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, bytes.Clone(k))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
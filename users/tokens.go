@@ -0,0 +1,178 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// lastUsedResolution is how often the last use of a token is recorded, so
+// readers fetching a feed and its covers don't write to the database for
+// every request.
+const lastUsedResolution = time.Minute
+
+// Token signs in a device of a user that can't do HTTP authentication,
+// with the secret put in the catalog URL. Only a hash of the secret is
+// stored, so it can't be shown again.
+type Token struct {
+	// ID names the token for revoking it.
+	ID       string    `json:"id"`
+	User     string    `json:"user"`
+	Device   string    `json:"device"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used,omitempty"`
+}
+
+// tokenKey returns the key of the token secret in the tokens bucket.
+func tokenKey(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+func putToken(b *bolt.Bucket, key []byte, t Token) error {
+	v, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, v)
+}
+
+// deleteTokens deletes the tokens match returns true for.
+func deleteTokens(tx *bolt.Tx, match func(Token) bool) error {
+	b := tx.Bucket(tokensBucket)
+	var keys [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var t Token
+		if err := json.Unmarshal(v, &t); err != nil {
+			return err
+		}
+		if match(t) {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddToken creates a token for the device of user, returning its secret.
+func (db *DB) AddToken(user, device string) (string, Token, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", Token{}, err
+	}
+	secret := hex.EncodeToString(b)
+	key := tokenKey(secret)
+	t := Token{ID: string(key[:8]), User: user, Device: device, Created: time.Now()}
+
+	err := db.update(func(tx *bolt.Tx) error {
+		if tx.Bucket(usersBucket).Get([]byte(user)) == nil {
+			return ErrNotFound
+		}
+		return putToken(tx.Bucket(tokensBucket), key, t)
+	})
+	if err != nil {
+		return "", Token{}, err
+	}
+	return secret, t, nil
+}
+
+// Tokens returns the tokens of user, or of every user when user is empty,
+// ordered by user and creation.
+func (db *DB) Tokens(user string) ([]Token, error) {
+	var out []Token
+	err := db.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).ForEach(func(k, v []byte) error {
+			var t Token
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			if user == "" || t.User == user {
+				out = append(out, t)
+			}
+			return nil
+		})
+	})
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].User != out[j].User {
+			return out[i].User < out[j].User
+		}
+		return out[i].Created.Before(out[j].Created)
+	})
+	return out, err
+}
+
+// RevokeToken deletes the token with id.
+func (db *DB) RevokeToken(id string) error {
+	found := false
+	err := db.update(func(tx *bolt.Tx) error {
+		return deleteTokens(tx, func(t Token) bool {
+			if t.ID == id {
+				found = true
+			}
+			return t.ID == id
+		})
+	})
+	if err == nil && !found {
+		err = ErrNotFound
+	}
+	return err
+}
+
+// UseToken returns the token of secret and records it was used now, or
+// ErrInvalid when there is no such token.
+func (db *DB) UseToken(secret string) (Token, error) {
+	key := tokenKey(secret)
+	var t Token
+	found := false
+	err := db.view(func(tx *bolt.Tx) error {
+		v := tx.Bucket(tokensBucket).Get(key)
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &t)
+	})
+	if err != nil {
+		return Token{}, err
+	}
+	if !found {
+		return Token{}, ErrInvalid
+	}
+
+	now := time.Now()
+	db.mu.Lock()
+	prev, ok := db.lastUsed[t.ID]
+	db.mu.Unlock()
+	if ok && now.Sub(prev) < lastUsedResolution || now.Sub(t.LastUsed) < lastUsedResolution {
+		return t, nil
+	}
+	t.LastUsed = now
+	err = db.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tokensBucket)
+		// the token may have been revoked meanwhile
+		if b.Get(key) == nil {
+			return ErrInvalid
+		}
+		return putToken(b, key, t)
+	})
+	if err != nil {
+		return Token{}, err
+	}
+	db.mu.Lock()
+	db.lastUsed[t.ID] = now
+	db.mu.Unlock()
+	return t, nil
+}
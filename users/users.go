@@ -0,0 +1,284 @@
+/*
+Package users keeps the accounts allowed to read the catalog in a bbolt
+database. The database is held open while in use, so the user subcommands
+can only edit it while the server is stopped.
+*/
+package users
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrExists   = errors.New("users: user already exists")
+	ErrNotFound = errors.New("users: no such user")
+	// ErrInvalid is returned for a wrong user name or password, which are
+	// not told apart.
+	ErrInvalid = errors.New("users: invalid user name or password")
+	// ErrName is returned for user names that can not be sent with HTTP
+	// Basic authentication.
+	ErrName = errors.New("users: user names must not be empty nor contain colons or control characters")
+	// ErrPassword is returned for empty passwords.
+	ErrPassword = errors.New("users: password must not be empty")
+	// ErrLocked is returned by Open when another process, such as the
+	// server, holds the database.
+	ErrLocked = errors.New("users: database is in use by another process")
+)
+
+// lockTimeout is how long Open waits for another process holding the
+// database, such as the server while a user subcommand runs.
+const lockTimeout = 5 * time.Second
+
+var (
+	usersBucket     = []byte("users")
+	tokensBucket    = []byte("tokens")
+	positionsBucket = []byte("positions")
+)
+
+// User is an account of the catalog.
+type User struct {
+	Name         string    `json:"name"`
+	PasswordHash []byte    `json:"password_hash"`
+	Created      time.Time `json:"created"`
+}
+
+// DB is the database of users stored in a file.
+type DB struct {
+	path string
+	bolt *bolt.DB
+
+	mu sync.Mutex
+	// verified remembers the passwords checked already, so clients sending
+	// them with every request don't pay for bcrypt every time.
+	verified map[string]verified
+	// lastUsed is when tokens were last recorded as used, by ID.
+	lastUsed map[string]time.Time
+}
+
+type verified struct {
+	// hash is the stored password hash when the password was checked, so
+	// a reset password is checked again.
+	hash []byte
+	sum  [sha256.Size]byte
+}
+
+// Open returns the database of users in the file path, creating it when it
+// does not exist.
+func Open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	bdb, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: lockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{path: path, bolt: bdb, verified: make(map[string]verified), lastUsed: make(map[string]time.Time)}
+	err = db.update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{usersBucket, tokensBucket, positionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		bdb.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close releases the database file.
+func (db *DB) Close() error {
+	return db.bolt.Close()
+}
+
+// Path returns the file of the database.
+func (db *DB) Path() string {
+	return db.path
+}
+
+// update runs fn in a read-write transaction. The buckets exist once Open
+// returned.
+func (db *DB) update(fn func(tx *bolt.Tx) error) error {
+	return db.bolt.Update(fn)
+}
+
+// view runs fn in a read-only transaction, which runs alongside other
+// readers and the writer.
+func (db *DB) view(fn func(tx *bolt.Tx) error) error {
+	return db.bolt.View(fn)
+}
+
+func get(b *bolt.Bucket, name string) (User, error) {
+	var u User
+	v := b.Get([]byte(name))
+	if v == nil {
+		return u, ErrNotFound
+	}
+	err := json.Unmarshal(v, &u)
+	return u, err
+}
+
+func put(b *bolt.Bucket, u User) error {
+	v, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(u.Name), v)
+}
+
+func validName(name string) bool {
+	return name != "" && !strings.ContainsRune(name, ':') && strings.IndexFunc(name, unicode.IsControl) < 0
+}
+
+func hashPassword(password string) ([]byte, error) {
+	if password == "" {
+		return nil, ErrPassword
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// Add creates the user name with password.
+func (db *DB) Add(name, password string) error {
+	if !validName(name) {
+		return ErrName
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(usersBucket)
+		if b.Get([]byte(name)) != nil {
+			return ErrExists
+		}
+		return put(b, User{Name: name, PasswordHash: hash, Created: time.Now()})
+	})
+}
+
+// Remove deletes the user name, their tokens and reading positions.
+func (db *DB) Remove(name string) error {
+	return db.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(usersBucket)
+		if b.Get([]byte(name)) == nil {
+			return ErrNotFound
+		}
+		if err := deleteTokens(tx, func(t Token) bool { return t.User == name }); err != nil {
+			return err
+		}
+		if err := deletePositions(tx, name); err != nil {
+			return err
+		}
+		return b.Delete([]byte(name))
+	})
+}
+
+// SetPassword replaces the password of the user name.
+func (db *DB) SetPassword(name, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(usersBucket)
+		u, err := get(b, name)
+		if err != nil {
+			return err
+		}
+		u.PasswordHash = hash
+		return put(b, u)
+	})
+}
+
+// Get returns the user name.
+func (db *DB) Get(name string) (User, error) {
+	u, err := User{}, ErrNotFound
+	verr := db.view(func(tx *bolt.Tx) error {
+		u, err = get(tx.Bucket(usersBucket), name)
+		return nil
+	})
+	if verr != nil {
+		return User{}, verr
+	}
+	return u, err
+}
+
+// List returns every user ordered by name.
+func (db *DB) List() ([]User, error) {
+	var out []User
+	err := db.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(k, v []byte) error {
+			var u User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return err
+			}
+			out = append(out, u)
+			return nil
+		})
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, err
+}
+
+// Empty reports whether there are no users, in which case the catalog is
+// open to everyone.
+func (db *DB) Empty() (bool, error) {
+	empty := true
+	err := db.view(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(usersBucket).Cursor().First()
+		empty = k == nil
+		return nil
+	})
+	return empty, err
+}
+
+// dummyHash is compared against when the user does not exist, so the time
+// taken does not tell whether it does.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// Authenticate returns the user name when password is theirs, and
+// ErrInvalid otherwise.
+func (db *DB) Authenticate(name, password string) (User, error) {
+	u, err := db.Get(name)
+	if errors.Is(err, ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, ErrInvalid
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	sum := sha256.Sum256([]byte(password))
+	db.mu.Lock()
+	v, ok := db.verified[name]
+	db.mu.Unlock()
+	if ok && bytes.Equal(v.hash, u.PasswordHash) && subtle.ConstantTimeCompare(v.sum[:], sum[:]) == 1 {
+		return u, nil
+	}
+
+	if err := bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)); err != nil {
+		return User{}, ErrInvalid
+	}
+	db.mu.Lock()
+	db.verified[name] = verified{hash: u.PasswordHash, sum: sum}
+	db.mu.Unlock()
+	return u, nil
+}
@@ -0,0 +1,189 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDB(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "data", "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if empty, err := db.Empty(); err != nil || !empty {
+		t.Fatalf("Empty = %v, %v on a new database", empty, err)
+	}
+
+	if err := db.Add("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Add("alice", "other"); !errors.Is(err, ErrExists) {
+		t.Errorf("Add existing user err = %v", err)
+	}
+	for _, name := range []string{"", "a:b", "a\nb"} {
+		if err := db.Add(name, "secret"); !errors.Is(err, ErrName) {
+			t.Errorf("Add(%q) err = %v", name, err)
+		}
+	}
+	if err := db.Add("bob", ""); !errors.Is(err, ErrPassword) {
+		t.Errorf("Add with empty password err = %v", err)
+	}
+
+	if _, err := db.Authenticate("alice", "secret"); err != nil {
+		t.Errorf("Authenticate err = %v", err)
+	}
+	// the second time is answered from the verified passwords
+	if _, err := db.Authenticate("alice", "secret"); err != nil {
+		t.Errorf("Authenticate again err = %v", err)
+	}
+	if _, err := db.Authenticate("alice", "wrong"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Authenticate wrong password err = %v", err)
+	}
+	if _, err := db.Authenticate("nobody", "secret"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Authenticate unknown user err = %v", err)
+	}
+
+	if err := db.SetPassword("alice", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Authenticate("alice", "secret"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Authenticate old password err = %v", err)
+	}
+	if _, err := db.Authenticate("alice", "new"); err != nil {
+		t.Errorf("Authenticate new password err = %v", err)
+	}
+
+	if err := db.Remove("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Remove("alice"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove missing user err = %v", err)
+	}
+	if _, err := db.Authenticate("alice", "new"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Authenticate removed user err = %v", err)
+	}
+	if list, err := db.List(); err != nil || len(list) != 0 {
+		t.Errorf("List = %v, %v", list, err)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, _, err := db.AddToken("alice", "kobo"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AddToken for missing user err = %v", err)
+	}
+	db.Add("alice", "secret")
+	db.Add("bob", "secret")
+
+	secret, tok, err := db.AddToken("alice", "kobo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AddToken("bob", "phone")
+	used, err := db.UseToken(secret)
+	if err != nil || used.User != "alice" || used.Device != "kobo" || used.LastUsed.IsZero() {
+		t.Errorf("UseToken = %+v, %v", used, err)
+	}
+	if _, err := db.UseToken("wrong"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("UseToken wrong secret err = %v", err)
+	}
+	if list, err := db.Tokens("alice"); err != nil || len(list) != 1 || list[0].ID != tok.ID || list[0].LastUsed.IsZero() {
+		t.Errorf("Tokens(alice) = %+v, %v", list, err)
+	}
+	if list, _ := db.Tokens(""); len(list) != 2 {
+		t.Errorf("Tokens of everyone = %+v", list)
+	}
+
+	if err := db.RevokeToken(tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RevokeToken(tok.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RevokeToken again err = %v", err)
+	}
+	if _, err := db.UseToken(secret); !errors.Is(err, ErrInvalid) {
+		t.Errorf("UseToken revoked err = %v", err)
+	}
+
+	// removing a user deletes their tokens
+	db.Remove("bob")
+	if list, _ := db.Tokens(""); len(list) != 0 {
+		t.Errorf("Tokens after removing bob = %+v", list)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Add("alice", "secret")
+	db.Add("al", "secret")
+
+	if _, ok, err := db.Position("alice", "/a.epub"); ok || err != nil {
+		t.Errorf("Position of unread book = %v, %v", ok, err)
+	}
+	if err := db.SetPosition("alice", "/a.epub", Position{Chapter: 3, Progress: 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	db.SetPosition("al", "/a.epub", Position{Chapter: 1})
+	p, ok, err := db.Position("alice", "/a.epub")
+	if !ok || err != nil || p.Chapter != 3 || p.Progress != 0.5 || p.Updated.IsZero() {
+		t.Errorf("Position = %+v, %v, %v", p, ok, err)
+	}
+
+	// removing a user deletes their positions only
+	db.Remove("al")
+	if _, ok, _ := db.Position("al", "/a.epub"); ok {
+		t.Error("Position of removed user found")
+	}
+	if _, ok, _ := db.Position("alice", "/a.epub"); !ok {
+		t.Error("Position of alice deleted with al")
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "users.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Add("alice", "secret")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := db.Authenticate("alice", "secret"); err != nil {
+					t.Errorf("Authenticate err = %v", err)
+					return
+				}
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				book := fmt.Sprintf("/%d/%d.epub", i, j)
+				if err := db.SetPosition("alice", book, Position{Chapter: j}); err != nil {
+					t.Errorf("SetPosition err = %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if p, ok, err := db.Position("alice", "/7/19.epub"); !ok || err != nil || p.Chapter != 19 {
+		t.Errorf("Position = %+v, %v, %v", p, ok, err)
+	}
+}